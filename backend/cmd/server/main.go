@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"habit-tracker/internal/config"
 	"habit-tracker/internal/handler"
 	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/notify"
 	"habit-tracker/internal/repository"
 	"habit-tracker/internal/service"
 	"habit-tracker/pkg/logger"
@@ -18,23 +21,108 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
-	// Initialize repository
-	repo, err := repository.NewRecordRepository(&cfg.Database)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(&cfg.Database, os.Args[2:]); err != nil {
+			logger.Fatal("Migration failed: %v", err)
+		}
+		return
+	}
+
+	calendar, err := service.ParseCalendar(cfg.Locale.Timezone, cfg.Locale.WeekStart)
+	if err != nil {
+		logger.Fatal("Invalid locale settings: %v", err)
+	}
+
+	// Initialize database
+	db, err := repository.Open(&cfg.Database)
 	if err != nil {
-		logger.Fatal("Failed to initialize repository: %v", err)
+		logger.Fatal("Failed to initialize database: %v", err)
 	}
+	defer db.Close()
 
-	// Initialize service
-	svc := service.NewRecordService(repo)
+	// Initialize repositories
+	recordRepo := repository.NewRecordRepository(db)
+	habitRepo := repository.NewHabitRepository(db)
+	userRepo := repository.NewUserRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	backupRepo := repository.NewBackupRepository(db)
+	goalRepo := repository.NewGoalRepository(db)
+	reminderRepo := repository.NewReminderRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	emailRepo := repository.NewEmailRepository(db)
 
-	// Initialize handler
+	// Initialize services
+	calendarSvc := service.NewCalendarService(userRepo, calendar, cfg.SMTP.Host != "")
+	webhookSvc := service.NewWebhookService(webhookRepo, recordRepo, habitRepo, userRepo, calendarSvc, cfg.Webhooks.AllowedHosts)
+	svc := service.NewRecordService(recordRepo, habitRepo, webhookSvc, cfg.Records.MaxFutureDays)
+	habitSvc := service.NewHabitService(habitRepo)
+	streakSvc := service.NewStreakService(recordRepo, habitRepo)
+	statsSvc := service.NewStatsService(recordRepo)
+	authSvc := service.NewAuthService(userRepo, sessionRepo, apiKeyRepo, cfg.Auth.SessionTTL)
+	if password := cfg.Auth.DefaultUserPassword; password != "" {
+		if err := authSvc.SetInitialPassword(repository.DefaultUsername, password); err != nil {
+			logger.Fatal("Failed to set the password of user %q: %v", repository.DefaultUsername, err)
+		}
+	}
+	apiKeySvc := service.NewAPIKeyService(apiKeyRepo)
+	backupSvc := service.NewBackupService(recordRepo, habitRepo, goalRepo, reminderRepo, backupRepo, webhookSvc)
+	goalSvc := service.NewGoalService(goalRepo, habitRepo, recordRepo)
+	scheduleSvc := service.NewScheduleService(habitRepo, recordRepo)
+	notifiers := map[string]notify.Notifier{notify.Log: notify.LogNotifier{}}
+	var email *notify.SMTPNotifier
+	if cfg.SMTP.Host != "" {
+		email, err = notify.NewSMTPNotifier(cfg.SMTP, emailRepo)
+		if err != nil {
+			logger.Fatal("Invalid SMTP settings: %v", err)
+		}
+		notifiers[notify.Email] = email
+	}
+	reminderSvc := service.NewReminderService(reminderRepo, habitRepo, recordRepo, userRepo, calendarSvc, notifiers)
+	var summarySvc service.SummaryService
+	if email != nil {
+		summarySvc = service.NewSummaryService(userRepo, habitRepo, recordRepo, calendarSvc, email)
+	}
+
+	// Initialize handlers
 	h := handler.NewRecordHandler(svc)
+	habitHandler := handler.NewHabitHandler(habitSvc, scheduleSvc)
+	statsHandler := handler.NewStatsHandler(streakSvc, statsSvc)
+	authHandler := handler.NewAuthHandler(authSvc, calendarSvc)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeySvc)
+	backupHandler := handler.NewBackupHandler(backupSvc)
+	goalHandler := handler.NewGoalHandler(goalSvc)
+	reminderHandler := handler.NewReminderHandler(reminderSvc)
+	webhookHandler := handler.NewWebhookHandler(webhookSvc)
 
 	// Setup routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/records", h.HandleRecords)
 	mux.HandleFunc("/api/records/", h.HandleRecord)
+	mux.HandleFunc("/api/records/export", h.HandleExport)
+	mux.HandleFunc("/api/records/import", h.HandleImport)
+	mux.HandleFunc("/api/records/batch", h.HandleBatch)
+	mux.HandleFunc("/api/trash", h.HandleTrash)
 	mux.HandleFunc("/api/stats", h.HandleStats)
+	mux.HandleFunc("/api/stats/streaks", statsHandler.HandleStreaks)
+	mux.HandleFunc("/api/stats/heatmap", statsHandler.HandleHeatmap)
+	mux.HandleFunc("/api/stats/series", statsHandler.HandleSeries)
+	mux.HandleFunc("/api/habits", habitHandler.HandleHabits)
+	mux.HandleFunc("/api/habits/", habitHandler.HandleHabit)
+	mux.HandleFunc("/api/goals", goalHandler.HandleGoals)
+	mux.HandleFunc("/api/goals/", goalHandler.HandleGoal)
+	mux.HandleFunc("/api/reminders", reminderHandler.HandleReminders)
+	mux.HandleFunc("/api/reminders/", reminderHandler.HandleReminder)
+	mux.HandleFunc("/api/webhooks", webhookHandler.HandleWebhooks)
+	mux.HandleFunc("/api/webhooks/", webhookHandler.HandleWebhook)
+	mux.HandleFunc("/api/auth/register", authHandler.HandleRegister)
+	mux.HandleFunc("/api/auth/login", authHandler.HandleLogin)
+	mux.HandleFunc("/api/auth/logout", authHandler.HandleLogout)
+	mux.HandleFunc("/api/auth/me", authHandler.HandleMe)
+	mux.HandleFunc("/api/keys", apiKeyHandler.HandleKeys)
+	mux.HandleFunc("/api/keys/", apiKeyHandler.HandleKey)
+	mux.HandleFunc("/api/backup", backupHandler.HandleBackup)
+	mux.HandleFunc("/api/restore", backupHandler.HandleRestore)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -42,8 +130,11 @@ func main() {
 
 	// Apply middleware
 	var handler http.Handler = mux
+	handler = middleware.Locale(calendarSvc)(handler)
+	handler = middleware.Auth(authSvc, "/api/auth/register", "/api/auth/login")(handler)
 	handler = middleware.CORS(cfg.Server.AllowOrigins)(handler)
 	handler = middleware.Logging(handler)
+	handler = middleware.AssignRequestID(handler)
 	handler = middleware.Recovery(handler)
 
 	// Start server
@@ -52,12 +143,48 @@ func main() {
 		Handler: handler,
 	}
 
+	// Background jobs
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if retention := cfg.Records.TrashRetention; retention > 0 {
+		go service.Every(ctx, time.Hour, "purge trash", func() error {
+			return svc.PurgeTrash(retention)
+		})
+	}
+	if email != nil {
+		go service.Every(ctx, notify.EmailSendInterval, "send email", func() error {
+			return email.Send(ctx, time.Now())
+		})
+		go service.Every(ctx, time.Hour, "send weekly summaries", func() error {
+			return summarySvc.Dispatch(ctx, time.Now())
+		})
+	}
+	if interval := cfg.Reminders.CheckInterval; interval > 0 {
+		go service.Every(ctx, interval, "send reminders", func() error {
+			return reminderSvc.Dispatch(ctx, time.Now())
+		})
+	}
+	if interval := cfg.Webhooks.DeliveryInterval; interval > 0 {
+		go service.Every(ctx, interval, "deliver webhooks", func() error {
+			return webhookSvc.Deliver(ctx, time.Now())
+		})
+		go service.Every(ctx, time.Hour, "check streaks for webhooks", func() error {
+			return webhookSvc.CheckStreaks(time.Now())
+		})
+	}
+	if retention := cfg.Webhooks.LogRetention; retention > 0 {
+		go service.Every(ctx, time.Hour, "purge webhook deliveries", func() error {
+			return webhookSvc.PurgeDeliveries(retention)
+		})
+	}
+
 	// Graceful shutdown
 	go func() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
 		logger.Info("Shutting down server...")
+		stop()
 		server.Close()
 	}()
 
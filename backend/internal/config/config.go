@@ -3,11 +3,19 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Auth      AuthConfig
+	Locale    LocaleConfig
+	Records   RecordsConfig
+	Reminders RemindersConfig
+	Webhooks  WebhooksConfig
+	SMTP      SMTPConfig
 }
 
 type ServerConfig struct {
@@ -16,8 +24,65 @@ type ServerConfig struct {
 }
 
 type DatabaseConfig struct {
-	Driver string // sqlite or mysql
-	DSN    string
+	Driver      string // sqlite, mysql or postgres
+	DSN         string
+	AutoMigrate bool // apply pending migrations on startup
+}
+
+type AuthConfig struct {
+	SessionTTL time.Duration
+	// DefaultUserPassword is set on startup as the password of the default
+	// user, which owns the data written before accounts existed, while that
+	// user has none.
+	DefaultUserPassword string
+}
+
+type RecordsConfig struct {
+	// MaxFutureDays is how many days past the user's today a record may be
+	// dated, to allow for clients whose clock or zone is a little ahead.
+	MaxFutureDays int
+	// TrashRetention is how long deleted records can be restored before
+	// they are purged. Zero keeps them forever.
+	TrashRetention time.Duration
+}
+
+type RemindersConfig struct {
+	// CheckInterval is how often due reminders are looked for. Zero turns
+	// reminders off.
+	CheckInterval time.Duration
+}
+
+type WebhooksConfig struct {
+	// DeliveryInterval is how often queued events are posted. Zero turns
+	// webhook delivery off; events of record changes are still queued, but
+	// streaks are not checked.
+	DeliveryInterval time.Duration
+	// LogRetention is how long finished deliveries are kept in the
+	// delivery log. Zero keeps them forever.
+	LogRetention time.Duration
+	// AllowedHosts are host names and IP addresses webhooks may reach even
+	// though they are, or resolve to, loopback, private or link-local
+	// addresses, which are refused otherwise.
+	AllowedHosts []string
+}
+
+// SMTPConfig is the mail server email notifications are sent through.
+type SMTPConfig struct {
+	Host     string // "" turns email off, unless in test mode
+	Port     int
+	TLS      string // starttls, tls (implicit, usually port 465) or none
+	Username string // "" to send without authenticating
+	Password string
+	From     string // address, optionally with a name: Habit Tracker <noreply@example.com>
+	// TestMode sends to a local SMTP sink such as MailHog, by default
+	// localhost:1025 without TLS or authentication.
+	TestMode bool
+}
+
+// LocaleConfig is the calendar used for users who have not chosen their own.
+type LocaleConfig struct {
+	Timezone  string // IANA name, or Local for the server's zone
+	WeekStart string // weekday name
 }
 
 func Load() *Config {
@@ -27,9 +92,54 @@ func Load() *Config {
 			AllowOrigins: getEnv("CORS_ORIGINS", "*"),
 		},
 		Database: DatabaseConfig{
-			Driver: getEnv("DB_DRIVER", "sqlite"),
-			DSN:    getEnv("DB_DSN", "data.db"),
+			Driver:      getEnv("DB_DRIVER", "sqlite"),
+			DSN:         getEnv("DB_DSN", "data.db"),
+			AutoMigrate: getEnvBool("DB_AUTO_MIGRATE", true),
+		},
+		Auth: AuthConfig{
+			SessionTTL:          time.Duration(getEnvInt("SESSION_TTL_HOURS", 720)) * time.Hour,
+			DefaultUserPassword: os.Getenv("DEFAULT_USER_PASSWORD"),
+		},
+		Locale: LocaleConfig{
+			Timezone:  getEnv("DEFAULT_TIMEZONE", "Local"),
+			WeekStart: getEnv("DEFAULT_WEEK_START", "sunday"),
+		},
+		Records: RecordsConfig{
+			MaxFutureDays:  getEnvInt("RECORD_MAX_FUTURE_DAYS", 1),
+			TrashRetention: time.Duration(getEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		},
+		Reminders: RemindersConfig{
+			CheckInterval: time.Duration(getEnvInt("REMINDER_CHECK_SECONDS", 60)) * time.Second,
 		},
+		Webhooks: WebhooksConfig{
+			DeliveryInterval: time.Duration(getEnvInt("WEBHOOK_DELIVERY_SECONDS", 5)) * time.Second,
+			LogRetention:     time.Duration(getEnvInt("WEBHOOK_LOG_RETENTION_DAYS", 30)) * 24 * time.Hour,
+			AllowedHosts:     getEnvList("WEBHOOK_ALLOWED_HOSTS"),
+		},
+		SMTP: loadSMTP(),
+	}
+}
+
+// loadSMTP reads the SMTP settings, whose defaults depend on test mode.
+func loadSMTP() SMTPConfig {
+	if getEnvBool("SMTP_TEST_MODE", false) {
+		return SMTPConfig{
+			Host:     getEnv("SMTP_HOST", "localhost"),
+			Port:     getEnvInt("SMTP_PORT", 1025),
+			TLS:      getEnv("SMTP_TLS", "none"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     getEnv("SMTP_FROM", "Habit Tracker <habit-tracker@localhost>"),
+			TestMode: true,
+		}
+	}
+	return SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     getEnvInt("SMTP_PORT", 587),
+		TLS:      getEnv("SMTP_TLS", "starttls"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
 	}
 }
 
@@ -48,3 +158,23 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvList splits a comma-separated variable, dropping empty items.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
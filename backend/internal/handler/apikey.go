@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+type APIKeyHandler struct {
+	service service.APIKeyService
+}
+
+func NewAPIKeyHandler(svc service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: svc}
+}
+
+func (h *APIKeyHandler) HandleKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getAll(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *APIKeyHandler) HandleKey(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := h.service.Revoke(middleware.UserID(r.Context()), id); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			respondError(w, http.StatusNotFound, "api key not found")
+			return
+		}
+		logger.Error("Failed to revoke api key: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to revoke api key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *APIKeyHandler) getAll(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.GetAll(middleware.UserID(r.Context()))
+	if err != nil {
+		logger.Error("Failed to get api keys: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get api keys")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	key, err := h.service.Create(middleware.UserID(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, "invalid input")
+			return
+		}
+		logger.Error("Failed to create api key: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to create api key")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, key)
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+type AuthHandler struct {
+	service   service.AuthService
+	calendars service.CalendarService
+}
+
+func NewAuthHandler(svc service.AuthService, calendars service.CalendarService) *AuthHandler {
+	return &AuthHandler{service: svc, calendars: calendars}
+}
+
+func (h *AuthHandler) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req model.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	resp, err := h.service.Register(&req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, "username must be 3-50 letters, digits, '_', '.' or '-' and password 8-72 characters")
+			return
+		}
+		if errors.Is(err, service.ErrUsernameTaken) {
+			respondError(w, http.StatusConflict, "username already taken")
+			return
+		}
+		logger.Error("Failed to register user: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to register")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+func (h *AuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req model.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	resp, err := h.service.Login(&req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			respondError(w, http.StatusUnauthorized, "invalid username or password")
+			return
+		}
+		logger.Error("Failed to log in: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to log in")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (h *AuthHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := h.service.Logout(middleware.BearerToken(r)); err != nil {
+		logger.Error("Failed to log out: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to log out")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) HandleMe(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, middleware.User(r.Context()))
+	case http.MethodPatch:
+		h.updateSettings(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *AuthHandler) updateSettings(w http.ResponseWriter, r *http.Request) {
+	var req model.UpdateSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	user, err := h.calendars.UpdateSettings(middleware.User(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to update settings: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to update settings")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, user)
+}
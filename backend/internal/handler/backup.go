@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+const maxRestoreSize = 50 << 20
+
+type BackupHandler struct {
+	service service.BackupService
+}
+
+func NewBackupHandler(svc service.BackupService) *BackupHandler {
+	return &BackupHandler{service: svc}
+}
+
+func (h *BackupHandler) HandleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	backup, err := h.service.Backup(middleware.UserID(r.Context()))
+	if err != nil {
+		logger.Error("Failed to create backup: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to create backup")
+		return
+	}
+
+	filename := fmt.Sprintf("habit-tracker-%s.json", backup.ExportedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	respondJSON(w, http.StatusOK, backup)
+}
+
+func (h *BackupHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var backup model.Backup
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRestoreSize)).Decode(&backup); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid backup document: "+err.Error())
+		return
+	}
+
+	result, err := h.service.Restore(middleware.Actor(r.Context()), &backup, r.URL.Query().Get("mode"))
+	if err != nil {
+		if errors.Is(err, service.ErrUnsupportedBackup) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("unsupported backup version %d", backup.Version))
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to restore backup: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to restore backup")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
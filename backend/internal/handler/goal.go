@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+type GoalHandler struct {
+	service service.GoalService
+}
+
+func NewGoalHandler(svc service.GoalService) *GoalHandler {
+	return &GoalHandler{service: svc}
+}
+
+func (h *GoalHandler) HandleGoals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getAll(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *GoalHandler) HandleGoal(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/goals/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	switch action {
+	case "":
+	case "progress":
+		h.progress(w, r, id)
+		return
+	default:
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getByID(w, r, id)
+	case http.MethodPut:
+		h.update(w, r, id)
+	case http.MethodDelete:
+		h.delete(w, r, id)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *GoalHandler) getAll(w http.ResponseWriter, r *http.Request) {
+	var habitID int64
+	if v := r.URL.Query().Get("habitId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid habitId")
+			return
+		}
+		habitID = id
+	}
+
+	goals, err := h.service.GetAll(middleware.UserID(r.Context()), habitID)
+	if err != nil {
+		logger.Error("Failed to get goals: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get goals")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, goals)
+}
+
+func (h *GoalHandler) getByID(w http.ResponseWriter, r *http.Request, id int64) {
+	goal, err := h.service.GetByID(middleware.UserID(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, service.ErrGoalNotFound) {
+			respondError(w, http.StatusNotFound, "goal not found")
+			return
+		}
+		logger.Error("Failed to get goal: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get goal")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, goal)
+}
+
+func (h *GoalHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req model.GoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	goal, err := h.service.Create(middleware.UserID(r.Context()), middleware.Calendar(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusBadRequest, "habit not found")
+			return
+		}
+		logger.Error("Failed to create goal: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to create goal")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, goal)
+}
+
+func (h *GoalHandler) update(w http.ResponseWriter, r *http.Request, id int64) {
+	var req model.GoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	goal, err := h.service.Update(middleware.UserID(r.Context()), id, middleware.Calendar(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrGoalNotFound) {
+			respondError(w, http.StatusNotFound, "goal not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusBadRequest, "habit not found")
+			return
+		}
+		logger.Error("Failed to update goal: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to update goal")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, goal)
+}
+
+func (h *GoalHandler) delete(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := h.service.Delete(middleware.UserID(r.Context()), id); err != nil {
+		if errors.Is(err, service.ErrGoalNotFound) {
+			respondError(w, http.StatusNotFound, "goal not found")
+			return
+		}
+		logger.Error("Failed to delete goal: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete goal")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *GoalHandler) progress(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	progress, err := h.service.Progress(middleware.UserID(r.Context()), id, middleware.Calendar(r.Context()))
+	if err != nil {
+		if errors.Is(err, service.ErrGoalNotFound) {
+			respondError(w, http.StatusNotFound, "goal not found")
+			return
+		}
+		logger.Error("Failed to get goal progress: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get goal progress")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, progress)
+}
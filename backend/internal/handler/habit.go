@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+type HabitHandler struct {
+	service   service.HabitService
+	schedules service.ScheduleService
+}
+
+func NewHabitHandler(svc service.HabitService, schedules service.ScheduleService) *HabitHandler {
+	return &HabitHandler{service: svc, schedules: schedules}
+}
+
+func (h *HabitHandler) HandleHabits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getAll(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *HabitHandler) HandleHabit(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/habits/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	switch action {
+	case "":
+	case "completion":
+		h.completion(w, r, id)
+		return
+	default:
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getByID(w, r, id)
+	case http.MethodPut:
+		h.update(w, r, id)
+	case http.MethodDelete:
+		h.delete(w, r, id)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *HabitHandler) getAll(w http.ResponseWriter, r *http.Request) {
+	includeArchived := r.URL.Query().Get("archived") == "true"
+
+	habits, err := h.service.GetAll(middleware.UserID(r.Context()), includeArchived)
+	if err != nil {
+		logger.Error("Failed to get habits: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get habits")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, habits)
+}
+
+func (h *HabitHandler) getByID(w http.ResponseWriter, r *http.Request, id int64) {
+	habit, err := h.service.GetByID(middleware.UserID(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusNotFound, "habit not found")
+			return
+		}
+		logger.Error("Failed to get habit: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get habit")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, habit)
+}
+
+func (h *HabitHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateHabitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	habit, err := h.service.Create(middleware.UserID(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitExists) {
+			respondError(w, http.StatusConflict, "habit already exists")
+			return
+		}
+		logger.Error("Failed to create habit: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to create habit")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, habit)
+}
+
+func (h *HabitHandler) update(w http.ResponseWriter, r *http.Request, id int64) {
+	var req model.UpdateHabitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	habit, err := h.service.Update(middleware.UserID(r.Context()), id, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusNotFound, "habit not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitExists) {
+			respondError(w, http.StatusConflict, "habit already exists")
+			return
+		}
+		logger.Error("Failed to update habit: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to update habit")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, habit)
+}
+
+func (h *HabitHandler) delete(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := h.service.Delete(middleware.UserID(r.Context()), id); err != nil {
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusNotFound, "habit not found")
+			return
+		}
+		if errors.Is(err, service.ErrHabitInUse) {
+			respondError(w, http.StatusConflict, "habit has records, archive it instead")
+			return
+		}
+		logger.Error("Failed to delete habit: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete habit")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HabitHandler) completion(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	query := &model.CompletionQuery{From: r.URL.Query().Get("from"), To: r.URL.Query().Get("to")}
+	completion, err := h.schedules.Completion(middleware.UserID(r.Context()), id, middleware.Calendar(r.Context()), query)
+	if err != nil {
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusNotFound, "habit not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to get habit completion: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get habit completion")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, completion)
+}
@@ -3,10 +3,13 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"habit-tracker/internal/middleware"
 	"habit-tracker/internal/model"
 	"habit-tracker/internal/service"
 	"habit-tracker/pkg/logger"
@@ -32,32 +35,140 @@ func (h *RecordHandler) HandleRecords(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *RecordHandler) HandleRecord(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/records/")
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/records/"), "/")
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "invalid id")
 		return
 	}
+	switch action {
+	case "":
+	case "restore":
+		h.restore(w, r, id)
+		return
+	case "history":
+		h.history(w, r, id)
+		return
+	default:
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		h.getByID(w, r, id)
+		return
+	}
 
+	version, ok := ifMatch(r)
+	if !ok {
+		respondError(w, http.StatusPreconditionFailed, "record has been modified")
+		return
+	}
 	switch r.Method {
-	case http.MethodGet:
-		h.getByID(w, id)
 	case http.MethodPut:
-		h.update(w, r, id)
+		h.update(w, r, id, version)
+	case http.MethodPatch:
+		h.patch(w, r, id, version)
 	case http.MethodDelete:
-		h.delete(w, id)
+		h.delete(w, r, id, version)
 	default:
 		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
 	}
 }
 
+// HandleTrash lists the user's deleted records.
+func (h *RecordHandler) HandleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	records, err := h.service.ListTrash(middleware.UserID(r.Context()))
+	if err != nil {
+		logger.Error("Failed to list trash: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to list trash")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, records)
+}
+
+func (h *RecordHandler) restore(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	record, err := h.service.Restore(middleware.Actor(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, service.ErrRecordNotFound) {
+			respondError(w, http.StatusNotFound, "record not found in trash")
+			return
+		}
+		logger.Error("Failed to restore record: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to restore record")
+		return
+	}
+
+	respondRecord(w, http.StatusOK, record)
+}
+
+func (h *RecordHandler) history(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	revisions, err := h.service.History(middleware.UserID(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, service.ErrRecordNotFound) {
+			respondError(w, http.StatusNotFound, "record not found")
+			return
+		}
+		logger.Error("Failed to get record history: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get record history")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, revisions)
+}
+
+// recordETag is the entity tag of a record at version.
+func recordETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatch reads the record version a write is conditional on. It returns 0
+// when there is no If-Match header or it is "*", and false when the header
+// cannot match any version, such as a weak or foreign tag.
+func ifMatch(r *http.Request) (int64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// respondRecord writes a record along with its ETag.
+func respondRecord(w http.ResponseWriter, status int, record *model.Record) {
+	w.Header().Set("ETag", recordETag(record.Version))
+	respondJSON(w, status, record)
+}
+
 func (h *RecordHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
-	stats, err := h.service.GetStats()
+	stats, err := h.service.GetStats(middleware.UserID(r.Context()), middleware.Calendar(r.Context()))
 	if err != nil {
 		logger.Error("Failed to get stats: %v", err)
 		respondError(w, http.StatusInternalServerError, "failed to get stats")
@@ -68,18 +179,68 @@ func (h *RecordHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *RecordHandler) getAll(w http.ResponseWriter, r *http.Request) {
-	records, err := h.service.GetAll()
+	filter, err := parseRecordFilter(r)
 	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.service.List(middleware.UserID(r.Context()), filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
 		logger.Error("Failed to get records: %v", err)
 		respondError(w, http.StatusInternalServerError, "failed to get records")
 		return
 	}
 
-	respondJSON(w, http.StatusOK, records)
+	respondJSON(w, http.StatusOK, page)
+}
+
+func parseRecordFilter(r *http.Request) (*model.RecordFilter, error) {
+	q := r.URL.Query()
+	filter := &model.RecordFilter{
+		From:    q.Get("from"),
+		To:      q.Get("to"),
+		Content: q.Get("content"),
+		Sort:    q.Get("sort"),
+		Order:   q.Get("order"),
+		After:   q.Get("after"),
+	}
+
+	ints := []struct {
+		name string
+		dest *int
+	}{
+		{"minDuration", &filter.MinDuration},
+		{"maxDuration", &filter.MaxDuration},
+		{"limit", &filter.Limit},
+	}
+	for _, p := range ints {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dest = n
+		}
+	}
+
+	if v := q.Get("habitId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid habitId")
+		}
+		filter.HabitID = id
+	}
+
+	return filter, nil
 }
 
-func (h *RecordHandler) getByID(w http.ResponseWriter, id int64) {
-	record, err := h.service.GetByID(id)
+func (h *RecordHandler) getByID(w http.ResponseWriter, r *http.Request, id int64) {
+	record, err := h.service.GetByID(middleware.UserID(r.Context()), id)
 	if err != nil {
 		if errors.Is(err, service.ErrRecordNotFound) {
 			respondError(w, http.StatusNotFound, "record not found")
@@ -90,7 +251,7 @@ func (h *RecordHandler) getByID(w http.ResponseWriter, id int64) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, record)
+	respondRecord(w, http.StatusOK, record)
 }
 
 func (h *RecordHandler) create(w http.ResponseWriter, r *http.Request) {
@@ -100,10 +261,14 @@ func (h *RecordHandler) create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	record, err := h.service.Create(&req)
+	record, err := h.service.Create(middleware.Actor(r.Context()), middleware.Calendar(r.Context()), &req)
 	if err != nil {
 		if errors.Is(err, service.ErrInvalidInput) {
-			respondError(w, http.StatusBadRequest, "invalid input")
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusBadRequest, "habit not found")
 			return
 		}
 		logger.Error("Failed to create record: %v", err)
@@ -111,24 +276,32 @@ func (h *RecordHandler) create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, record)
+	respondRecord(w, http.StatusCreated, record)
 }
 
-func (h *RecordHandler) update(w http.ResponseWriter, r *http.Request, id int64) {
+func (h *RecordHandler) update(w http.ResponseWriter, r *http.Request, id, version int64) {
 	var req model.UpdateRecordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	record, err := h.service.Update(id, &req)
+	record, err := h.service.Update(middleware.Actor(r.Context()), id, version, middleware.Calendar(r.Context()), &req)
 	if err != nil {
 		if errors.Is(err, service.ErrRecordNotFound) {
 			respondError(w, http.StatusNotFound, "record not found")
 			return
 		}
+		if errors.Is(err, service.ErrRecordModified) {
+			respondError(w, http.StatusPreconditionFailed, "record has been modified")
+			return
+		}
 		if errors.Is(err, service.ErrInvalidInput) {
-			respondError(w, http.StatusBadRequest, "invalid input")
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusBadRequest, "habit not found")
 			return
 		}
 		logger.Error("Failed to update record: %v", err)
@@ -136,15 +309,55 @@ func (h *RecordHandler) update(w http.ResponseWriter, r *http.Request, id int64)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, record)
+	respondRecord(w, http.StatusOK, record)
 }
 
-func (h *RecordHandler) delete(w http.ResponseWriter, id int64) {
-	if err := h.service.Delete(id); err != nil {
+// maxPatchSize bounds the body of a PATCH request; a record is far smaller.
+const maxPatchSize = 64 << 10
+
+func (h *RecordHandler) patch(w http.ResponseWriter, r *http.Request, id, version int64) {
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	record, err := h.service.Patch(middleware.Actor(r.Context()), id, version, middleware.Calendar(r.Context()), patch)
+	if err != nil {
 		if errors.Is(err, service.ErrRecordNotFound) {
 			respondError(w, http.StatusNotFound, "record not found")
 			return
 		}
+		if errors.Is(err, service.ErrRecordModified) {
+			respondError(w, http.StatusPreconditionFailed, "record has been modified")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusBadRequest, "habit not found")
+			return
+		}
+		logger.Error("Failed to patch record: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to update record")
+		return
+	}
+
+	respondRecord(w, http.StatusOK, record)
+}
+
+func (h *RecordHandler) delete(w http.ResponseWriter, r *http.Request, id, version int64) {
+	if err := h.service.Delete(middleware.Actor(r.Context()), id, version); err != nil {
+		if errors.Is(err, service.ErrRecordNotFound) {
+			respondError(w, http.StatusNotFound, "record not found")
+			return
+		}
+		if errors.Is(err, service.ErrRecordModified) {
+			respondError(w, http.StatusPreconditionFailed, "record has been modified")
+			return
+		}
 		logger.Error("Failed to delete record: %v", err)
 		respondError(w, http.StatusInternalServerError, "failed to delete record")
 		return
@@ -167,3 +380,30 @@ func respondError(w http.ResponseWriter, status int, message string) {
 		Error:   message,
 	})
 }
+
+// respondInvalid reports input the service rejected, listing the fields at
+// fault when the service named them.
+func respondInvalid(w http.ResponseWriter, err error) {
+	respondJSON(w, http.StatusBadRequest, invalidResponse(err))
+}
+
+func invalidResponse(err error) model.APIResponse {
+	resp := model.APIResponse{Success: false, Error: err.Error(), Code: "invalid_input"}
+
+	var fields []*service.FieldError
+	var all *service.ValidationError
+	var one *service.FieldError
+	if errors.As(err, &all) {
+		fields = all.Fields
+	} else if errors.As(err, &one) {
+		fields = []*service.FieldError{one}
+	}
+	if len(fields) > 0 {
+		resp.Code = "validation_failed"
+		resp.Field = fields[0].Field
+		for _, f := range fields {
+			resp.Fields = append(resp.Fields, model.FieldError{Field: f.Field, Code: f.Code, Message: f.Message})
+		}
+	}
+	return resp
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+// maxBatchSize bounds the body of a batch request.
+const maxBatchSize = 1 << 20
+
+// HandleBatch applies a list of record writes in one transaction. The
+// response is 200 whenever the batch ran, with a result for each operation.
+func (h *RecordHandler) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req model.BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchSize)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	outcomes, err := h.service.Batch(middleware.Actor(r.Context()), middleware.Calendar(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to run record batch: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to run batch")
+		return
+	}
+
+	resp := model.BatchResponse{Mode: req.Mode, Results: make([]model.BatchResult, len(outcomes))}
+	for i, outcome := range outcomes {
+		result := batchResult(req.Operations[i].Op, outcome)
+		result.Index = i
+		if outcome.Err == nil {
+			resp.Applied++
+		} else {
+			resp.Failed++
+		}
+		resp.Results[i] = result
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// batchResult describes an operation's outcome with the status and error
+// the same write would have had as a request of its own.
+func batchResult(op string, outcome service.BatchOutcome) model.BatchResult {
+	result := model.BatchResult{Op: op, Record: outcome.Record}
+	err := outcome.Err
+	switch {
+	case err == nil && op == "create":
+		result.Status = http.StatusCreated
+	case err == nil && op == "delete":
+		result.Status = http.StatusNoContent
+	case err == nil:
+		result.Status = http.StatusOK
+	case errors.Is(err, service.ErrBatchAborted):
+		result.Status, result.Error = http.StatusFailedDependency, err.Error()
+	case errors.Is(err, service.ErrRecordNotFound):
+		result.Status, result.Error = http.StatusNotFound, "record not found"
+	case errors.Is(err, service.ErrRecordModified):
+		result.Status, result.Error = http.StatusPreconditionFailed, "record has been modified"
+	case errors.Is(err, service.ErrHabitNotFound):
+		result.Status, result.Error = http.StatusBadRequest, "habit not found"
+	case errors.Is(err, service.ErrInvalidInput):
+		invalid := invalidResponse(err)
+		result.Status, result.Error, result.Code, result.Fields = http.StatusBadRequest, invalid.Error, invalid.Code, invalid.Fields
+	default:
+		logger.Error("Failed to apply batch operation: %v", err)
+		result.Status, result.Error = http.StatusInternalServerError, "failed to apply operation"
+	}
+	return result
+}
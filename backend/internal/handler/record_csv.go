@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+// csvColumns are the columns written by export and, unless the request maps
+// them to other headers, expected by import.
+var csvColumns = []string{"date", "habit", "content", "duration", "notes"}
+
+const maxImportSize = 10 << 20
+
+func (h *RecordHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+		respondError(w, http.StatusBadRequest, "unsupported format")
+		return
+	}
+
+	filter, err := parseRecordFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Headers are sent with the first row, so errors before it can still be
+	// reported as JSON.
+	var out *csv.Writer
+	err = h.service.Export(middleware.UserID(r.Context()), filter, func(record *model.Record, habit string) error {
+		if out == nil {
+			out = startCSV(w)
+		}
+		return out.Write([]string{
+			record.Date.String(),
+			habit,
+			record.Content,
+			strconv.Itoa(record.Duration),
+			record.Notes,
+		})
+	})
+	if err != nil {
+		if out != nil {
+			// The response is already under way and can only be cut short.
+			logger.Error("Failed to export records: %v", err)
+			out.Flush()
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to export records: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to export records")
+		return
+	}
+
+	if out == nil {
+		out = startCSV(w)
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		logger.Error("Failed to write export: %v", err)
+	}
+}
+
+func startCSV(w http.ResponseWriter) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="records.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write(csvColumns)
+	return out
+}
+
+// HandleImport reads a CSV file whose first line names its columns. Columns
+// are matched to fields by name; a query parameter named after a field, such
+// as ?duration=Minutes, picks a differently named column for it.
+func (h *RecordHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	rows, err := readImportRows(http.MaxBytesReader(w, r.Body, maxImportSize), r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.service.Import(middleware.Actor(r.Context()), middleware.Calendar(r.Context()), rows)
+	if err != nil {
+		logger.Error("Failed to import records: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to import records")
+		return
+	}
+
+	if len(result.Errors) > 0 {
+		respondJSON(w, http.StatusUnprocessableEntity, result)
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+func readImportRows(body io.Reader, r *http.Request) ([]model.ImportRow, error) {
+	in := csv.NewReader(body)
+	in.FieldsPerRecord = -1
+	in.TrimLeadingSpace = true
+
+	header, err := in.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %v", err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	q := r.URL.Query()
+	columns := make(map[string]int, len(csvColumns))
+	for _, field := range csvColumns {
+		name := field
+		if v := q.Get(field); v != "" {
+			name = strings.ToLower(strings.TrimSpace(v))
+		}
+		if i, ok := index[name]; ok {
+			columns[field] = i
+		} else if q.Get(field) != "" {
+			return nil, fmt.Errorf("column %q not found", q.Get(field))
+		}
+	}
+	for _, field := range []string{"date", "duration"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("missing %s column", field)
+		}
+	}
+	if _, ok := columns["content"]; !ok {
+		if _, ok := columns["habit"]; !ok {
+			return nil, errors.New("missing content or habit column")
+		}
+	}
+
+	var rows []model.ImportRow
+	for {
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %v", err)
+		}
+
+		line, _ := in.FieldPos(0)
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return record[i]
+		}
+		rows = append(rows, model.ImportRow{
+			Line:     line,
+			Date:     field("date"),
+			Habit:    field("habit"),
+			Content:  field("content"),
+			Duration: field("duration"),
+			Notes:    field("notes"),
+		})
+	}
+	return rows, nil
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+type ReminderHandler struct {
+	service service.ReminderService
+}
+
+func NewReminderHandler(svc service.ReminderService) *ReminderHandler {
+	return &ReminderHandler{service: svc}
+}
+
+func (h *ReminderHandler) HandleReminders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getAll(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *ReminderHandler) HandleReminder(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/reminders/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getByID(w, r, id)
+	case http.MethodPut:
+		h.update(w, r, id)
+	case http.MethodDelete:
+		h.delete(w, r, id)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *ReminderHandler) getAll(w http.ResponseWriter, r *http.Request) {
+	reminders, err := h.service.GetAll(middleware.UserID(r.Context()))
+	if err != nil {
+		logger.Error("Failed to get reminders: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get reminders")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, reminders)
+}
+
+func (h *ReminderHandler) getByID(w http.ResponseWriter, r *http.Request, id int64) {
+	reminder, err := h.service.GetByID(middleware.UserID(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, service.ErrReminderNotFound) {
+			respondError(w, http.StatusNotFound, "reminder not found")
+			return
+		}
+		logger.Error("Failed to get reminder: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get reminder")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, reminder)
+}
+
+func (h *ReminderHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req model.ReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	reminder, err := h.service.Create(middleware.UserID(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusBadRequest, "habit not found")
+			return
+		}
+		logger.Error("Failed to create reminder: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to create reminder")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, reminder)
+}
+
+func (h *ReminderHandler) update(w http.ResponseWriter, r *http.Request, id int64) {
+	var req model.ReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	reminder, err := h.service.Update(middleware.UserID(r.Context()), id, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrReminderNotFound) {
+			respondError(w, http.StatusNotFound, "reminder not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		if errors.Is(err, service.ErrHabitNotFound) {
+			respondError(w, http.StatusBadRequest, "habit not found")
+			return
+		}
+		logger.Error("Failed to update reminder: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to update reminder")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, reminder)
+}
+
+func (h *ReminderHandler) delete(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := h.service.Delete(middleware.UserID(r.Context()), id); err != nil {
+		if errors.Is(err, service.ErrReminderNotFound) {
+			respondError(w, http.StatusNotFound, "reminder not found")
+			return
+		}
+		logger.Error("Failed to delete reminder: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete reminder")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
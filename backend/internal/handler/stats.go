@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+type StatsHandler struct {
+	streaks service.StreakService
+	stats   service.StatsService
+}
+
+func NewStatsHandler(streaks service.StreakService, stats service.StatsService) *StatsHandler {
+	return &StatsHandler{streaks: streaks, stats: stats}
+}
+
+func (h *StatsHandler) HandleStreaks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	report, err := h.streaks.GetStreaks(middleware.UserID(r.Context()), middleware.Calendar(r.Context()))
+	if err != nil {
+		logger.Error("Failed to get streaks: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get streaks")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+func (h *StatsHandler) HandleHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	query := &model.HeatmapQuery{
+		From:   q.Get("from"),
+		To:     q.Get("to"),
+		Metric: q.Get("metric"),
+	}
+	if v := q.Get("habitId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid habitId")
+			return
+		}
+		query.HabitID = id
+	}
+
+	heatmap, err := h.stats.GetHeatmap(middleware.UserID(r.Context()), middleware.Calendar(r.Context()), query)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to get heatmap: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get heatmap")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, heatmap)
+}
+
+func (h *StatsHandler) HandleSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	query := &model.SeriesQuery{
+		Interval: q.Get("interval"),
+		From:     q.Get("from"),
+		To:       q.Get("to"),
+		GroupBy:  q.Get("groupBy"),
+	}
+	if v := q.Get("habitId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid habitId")
+			return
+		}
+		query.HabitID = id
+	}
+
+	series, err := h.stats.GetSeries(middleware.UserID(r.Context()), middleware.Calendar(r.Context()), query)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to get series: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get series")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, series)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"habit-tracker/internal/middleware"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/service"
+	"habit-tracker/pkg/logger"
+)
+
+type WebhookHandler struct {
+	service service.WebhookService
+}
+
+func NewWebhookHandler(svc service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: svc}
+}
+
+func (h *WebhookHandler) HandleWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getAll(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/webhooks/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	switch action {
+	case "":
+	case "deliveries":
+		h.deliveries(w, r, id)
+		return
+	default:
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.getByID(w, r, id)
+	case http.MethodPut:
+		h.update(w, r, id)
+	case http.MethodDelete:
+		h.delete(w, r, id)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *WebhookHandler) getAll(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.service.GetAll(middleware.UserID(r.Context()))
+	if err != nil {
+		logger.Error("Failed to get webhooks: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get webhooks")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, webhooks)
+}
+
+func (h *WebhookHandler) getByID(w http.ResponseWriter, r *http.Request, id int64) {
+	webhook, err := h.service.GetByID(middleware.UserID(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			respondError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		logger.Error("Failed to get webhook: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get webhook")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req model.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	webhook, err := h.service.Create(middleware.UserID(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to create webhook: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to create webhook")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) update(w http.ResponseWriter, r *http.Request, id int64) {
+	var req model.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	webhook, err := h.service.Update(middleware.UserID(r.Context()), id, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			respondError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInput) {
+			respondInvalid(w, err)
+			return
+		}
+		logger.Error("Failed to update webhook: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to update webhook")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) delete(w http.ResponseWriter, r *http.Request, id int64) {
+	if err := h.service.Delete(middleware.UserID(r.Context()), id); err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			respondError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		logger.Error("Failed to delete webhook: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) deliveries(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	deliveries, err := h.service.Deliveries(middleware.UserID(r.Context()), id)
+	if err != nil {
+		if errors.Is(err, service.ErrWebhookNotFound) {
+			respondError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		logger.Error("Failed to get webhook deliveries: %v", err)
+		respondError(w, http.StatusInternalServerError, "failed to get webhook deliveries")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, deliveries)
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/pkg/logger"
+)
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	calendarKey
+	requestIDKey
+)
+
+// Authenticator resolves a bearer token to its principal. It returns nil for
+// missing, unknown or expired tokens and an error only when the lookup fails.
+type Authenticator interface {
+	Authenticate(token string) (*model.Principal, error)
+}
+
+// WithPrincipal returns a copy of ctx that carries the authenticated caller.
+func WithPrincipal(ctx context.Context, principal *model.Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// Principal returns the authenticated caller stored in ctx, or nil.
+func Principal(ctx context.Context) *model.Principal {
+	principal, _ := ctx.Value(principalKey).(*model.Principal)
+	return principal
+}
+
+// User returns the acting user stored in ctx, or nil if there is none.
+func User(ctx context.Context) *model.User {
+	if principal := Principal(ctx); principal != nil {
+		return principal.User
+	}
+	return nil
+}
+
+// UserID returns the acting user's id stored in ctx, or 0 if there is none.
+func UserID(ctx context.Context) int64 {
+	if user := User(ctx); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// Actor returns who is acting in ctx, for the audit trail: the user, the API
+// key they authenticated with if any, and the id of the request.
+func Actor(ctx context.Context) *model.Actor {
+	actor := &model.Actor{RequestID: RequestID(ctx)}
+	if principal := Principal(ctx); principal != nil {
+		actor.UserID = principal.User.ID
+		actor.APIKeyID = principal.APIKeyID
+	}
+	return actor
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// Auth rejects requests to /api/* that do not carry a valid bearer token,
+// except for the public paths given, and stores the authenticated principal
+// in the request context. Scoped API keys are only let through to the
+// endpoints their scopes cover, and no API key to the endpoints that need a
+// session.
+func Auth(auth Authenticator, publicPaths ...string) func(http.Handler) http.Handler {
+	public := make(map[string]bool, len(publicPaths))
+	for _, p := range publicPaths {
+		public[p] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") || public[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, err := auth.Authenticate(BearerToken(r))
+			if err != nil {
+				logger.Error("Failed to authenticate request: %v", err)
+				writeError(w, http.StatusInternalServerError, "failed to authenticate")
+				return
+			}
+			if principal == nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="habit-tracker"`)
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			if principal.APIKeyID != 0 && sessionOnly(r.URL.Path) {
+				writeError(w, http.StatusForbidden, "this endpoint requires a login session")
+				return
+			}
+			if len(principal.Scopes) > 0 && !hasScope(principal.Scopes, requiredScope(r)) {
+				writeError(w, http.StatusForbidden, "api key lacks the required scope")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// sessionOnlyPaths are the API path prefixes that cannot be reached with an
+// API key at all, whatever its scopes: a key must not be able to mint keys,
+// nor take or replace all of the user's data at once.
+var sessionOnlyPaths = []string{"/api/keys", "/api/backup", "/api/restore"}
+
+func sessionOnly(path string) bool {
+	for _, prefix := range sessionOnlyPaths {
+		if underPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// underPrefix reports whether path is prefix or below it.
+func underPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// scopeResources maps API path prefixes to the resource named in scopes.
+// Paths not listed here cannot be reached with a scoped API key.
+var scopeResources = []struct {
+	prefix   string
+	resource string
+}{
+	{"/api/records", "records"},
+	{"/api/trash", "records"},
+	{"/api/habits", "habits"},
+	{"/api/goals", "habits"},
+	{"/api/reminders", "habits"},
+	{"/api/stats", "stats"},
+}
+
+// requiredScope returns the scope a request needs, such as "records:read"
+// for reads and "records:write" for everything else, or "" when no scope
+// grants access to the path.
+func requiredScope(r *http.Request) string {
+	for _, s := range scopeResources {
+		if !underPrefix(r.URL.Path, s.prefix) {
+			continue
+		}
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return s.resource + ":read"
+		}
+		return s.resource + ":write"
+	}
+	return ""
+}
+
+func hasScope(scopes []string, scope string) bool {
+	if scope == "" {
+		return false
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(model.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
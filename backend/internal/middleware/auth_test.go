@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"habit-tracker/internal/model"
+)
+
+type stubAuthenticator map[string]*model.Principal
+
+func (a stubAuthenticator) Authenticate(token string) (*model.Principal, error) {
+	return a[token], nil
+}
+
+func TestAuth(t *testing.T) {
+	user := &model.User{ID: 1, Username: "alice"}
+	auth := stubAuthenticator{
+		"session":   {User: user},
+		"ht_full":   {User: user, APIKeyID: 1},
+		"ht_scoped": {User: user, APIKeyID: 2, Scopes: []string{"records:read", "records:write"}},
+	}
+	handler := Auth(auth, "/api/auth/login")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"", http.MethodPost, "/api/auth/login", http.StatusNoContent},
+		{"", http.MethodGet, "/api/records", http.StatusUnauthorized},
+		{"unknown", http.MethodGet, "/api/records", http.StatusUnauthorized},
+		{"session", http.MethodPost, "/api/keys", http.StatusNoContent},
+		{"session", http.MethodGet, "/api/backup", http.StatusNoContent},
+		{"session", http.MethodPost, "/api/restore", http.StatusNoContent},
+		{"ht_full", http.MethodGet, "/api/records", http.StatusNoContent},
+		{"ht_full", http.MethodGet, "/api/keys", http.StatusForbidden},
+		{"ht_full", http.MethodPost, "/api/keys", http.StatusForbidden},
+		{"ht_full", http.MethodDelete, "/api/keys/3", http.StatusForbidden},
+		{"ht_full", http.MethodGet, "/api/backup", http.StatusForbidden},
+		{"ht_full", http.MethodPost, "/api/restore", http.StatusForbidden},
+		{"ht_scoped", http.MethodPost, "/api/records", http.StatusNoContent},
+		{"ht_scoped", http.MethodGet, "/api/habits", http.StatusForbidden},
+		{"ht_scoped", http.MethodPost, "/api/keys", http.StatusForbidden},
+		{"ht_scoped", http.MethodGet, "/api/backup", http.StatusForbidden},
+		{"ht_scoped", http.MethodPost, "/api/restore", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s with %q = %d, want %d", tt.method, tt.path, tt.token, rec.Code, tt.want)
+		}
+	}
+}
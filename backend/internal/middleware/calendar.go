@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+// TimezoneHeader names an IANA time zone that overrides the user's own for a
+// single request.
+const TimezoneHeader = "X-Timezone"
+
+// CalendarResolver picks the calendar a user's request is reckoned in.
+type CalendarResolver interface {
+	Calendar(user *model.User, timezone string) (*model.Calendar, error)
+}
+
+// WithCalendar returns a copy of ctx that carries the request's calendar.
+func WithCalendar(ctx context.Context, cal *model.Calendar) context.Context {
+	return context.WithValue(ctx, calendarKey, cal)
+}
+
+// Calendar returns the calendar stored in ctx, or UTC with weeks starting on
+// Sunday if there is none.
+func Calendar(ctx context.Context) *model.Calendar {
+	if cal, ok := ctx.Value(calendarKey).(*model.Calendar); ok {
+		return cal
+	}
+	return &model.Calendar{Location: time.UTC, WeekStart: time.Sunday}
+}
+
+// Locale stores the calendar of the authenticated user's requests in their
+// context. It must run after Auth.
+func Locale(resolver CalendarResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := User(r.Context())
+			if user == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cal, err := resolver.Calendar(user, r.Header.Get(TimezoneHeader))
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithCalendar(r.Context(), cal)))
+		})
+	}
+}
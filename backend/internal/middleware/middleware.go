@@ -11,8 +11,9 @@ func CORS(allowOrigins string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", allowOrigins)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Timezone, If-Match, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
 			w.Header().Set("Access-Control-Max-Age", "86400")
 
 			if r.Method == http.MethodOptions {
@@ -32,7 +33,7 @@ func Logging(next http.Handler) http.Handler {
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(wrapped, r)
 
-		logger.Info("%s %s %d %v", r.Method, r.URL.Path, wrapped.statusCode, time.Since(start))
+		logger.Info("%s %s %d %v [%s]", r.Method, r.URL.Path, wrapped.statusCode, time.Since(start), RequestID(r.Context()))
 	})
 }
 
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// API key scopes. A key without scopes has the same access as its owner.
+const (
+	ScopeRecordsRead  = "records:read"
+	ScopeRecordsWrite = "records:write"
+	ScopeHabitsRead   = "habits:read"
+	ScopeHabitsWrite  = "habits:write"
+	ScopeStatsRead    = "stats:read"
+)
+
+type APIKey struct {
+	ID         int64      `json:"id" db:"id"`
+	UserID     int64      `json:"-" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	LastUsedAt *time.Time `json:"lastUsedAt" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" validate:"required"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedAPIKey carries the plain key, which is only ever shown once.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// Backup is a self-contained copy of one user's data. Ids only link entries
+// within the document, such as a record's HabitID; a restore assigns new ones.
+type Backup struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exportedAt"`
+	Habits     []Habit    `json:"habits"`
+	Records    []Record   `json:"records"`
+	Goals      []Goal     `json:"goals"`     // since version 2
+	Reminders  []Reminder `json:"reminders"` // since version 3
+}
+
+// RestoreResult counts what a restore added. Skipped counts records, goals and
+// reminders that were already present when merging.
+type RestoreResult struct {
+	Habits    int `json:"habits"`
+	Records   int `json:"records"`
+	Goals     int `json:"goals"`
+	Reminders int `json:"reminders"`
+	Skipped   int `json:"skipped"`
+	// Replaced holds the live records a replace deleted, to be announced
+	// like other deletions; it is not part of the response.
+	Replaced []Record `json:"-"`
+}
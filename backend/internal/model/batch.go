@@ -0,0 +1,46 @@
+package model
+
+// Batch modes.
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// BatchRequest is a list of record writes made in one transaction. In the
+// atomic mode, the default, they are applied only if every one succeeds; in
+// best_effort mode each succeeds or fails on its own.
+type BatchRequest struct {
+	Mode       string           `json:"mode"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is one write of a batch. Op is create, update or delete;
+// update and delete name the record by ID and may give the Version they are
+// based on, like If-Match does for single writes.
+type BatchOperation struct {
+	Op      string               `json:"op"`
+	ID      int64                `json:"id"`
+	Version int64                `json:"version"`
+	Record  *UpdateRecordRequest `json:"record"`
+}
+
+// BatchResponse reports the outcome of every operation of a batch, in order.
+type BatchResponse struct {
+	Mode    string        `json:"mode"`
+	Applied int           `json:"applied"`
+	Failed  int           `json:"failed"`
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome of one operation. Status is the HTTP status the
+// operation would have had on its own, or 424 for an operation of an atomic
+// batch that succeeded but was rolled back because another failed.
+type BatchResult struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	Status int          `json:"status"`
+	Record *Record      `json:"record,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Code   string       `json:"code,omitempty"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
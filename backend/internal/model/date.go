@@ -0,0 +1,98 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// DateLayout is the only form in which dates are read and written.
+const DateLayout = "2006-01-02"
+
+// Date is a calendar day, without a time of day or a zone. It reads and
+// writes as YYYY-MM-DD in JSON and in the database. The zero Date is empty.
+type Date struct {
+	t time.Time // midnight UTC
+}
+
+// ParseDate reads a YYYY-MM-DD date. Other forms, such as 2024-1-5, and days
+// that do not exist, such as 2024-02-30, are rejected.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateLayout, s)
+	if err != nil || len(s) != len(DateLayout) {
+		return Date{}, fmt.Errorf("invalid date %q", s)
+	}
+	return Date{t: t}, nil
+}
+
+// NewDate returns the given day, normalizing out-of-range values the way
+// time.Date does.
+func NewDate(year int, month time.Month, day int) Date {
+	return Date{t: time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// DateOf returns the day t falls on in t's location.
+func DateOf(t time.Time) Date {
+	return NewDate(t.Year(), t.Month(), t.Day())
+}
+
+func (d Date) IsZero() bool { return d.t.IsZero() }
+
+// Time returns midnight UTC at the start of d.
+func (d Date) Time() time.Time { return d.t }
+
+func (d Date) Weekday() time.Weekday { return d.t.Weekday() }
+
+func (d Date) AddDays(n int) Date { return Date{t: d.t.AddDate(0, 0, n)} }
+
+func (d Date) Before(other Date) bool { return d.t.Before(other.t) }
+
+func (d Date) After(other Date) bool { return d.t.After(other.t) }
+
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.t.Format(DateLayout)
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText reads a YYYY-MM-DD date; empty text is the zero Date.
+func (d *Date) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = Date{}
+		return nil
+	}
+	parsed, err := ParseDate(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan reads a date stored as text, or as a DATE by drivers that return
+// those as times.
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Date{}
+		return nil
+	case time.Time:
+		*d = DateOf(v)
+		return nil
+	case []byte:
+		return d.UnmarshalText(v)
+	case string:
+		return d.UnmarshalText([]byte(v))
+	default:
+		return fmt.Errorf("cannot scan %T into a date", src)
+	}
+}
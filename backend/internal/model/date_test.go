@@ -0,0 +1,43 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	for _, s := range []string{"2024-13-45", "2024-02-30", "2024-1-5", "2024-01-05T00:00:00Z", "yesterday", ""} {
+		if d, err := ParseDate(s); err == nil {
+			t.Errorf("ParseDate(%q) = %s, want an error", s, d)
+		}
+	}
+	if d, err := ParseDate("2024-02-29"); err != nil || d != NewDate(2024, time.February, 29) {
+		t.Errorf("ParseDate(2024-02-29) = %s, %v", d, err)
+	}
+}
+
+func TestDate_JSON(t *testing.T) {
+	var r Record
+	if err := json.Unmarshal([]byte(`{"date":"2024-03-09"}`), &r); err != nil || r.Date != NewDate(2024, time.March, 9) {
+		t.Fatalf("Unmarshal() date = %s, %v", r.Date, err)
+	}
+	if err := json.Unmarshal([]byte(`{"date":"2024-3-9"}`), &r); err == nil {
+		t.Error("Unmarshal() of 2024-3-9 error = nil, want an error")
+	}
+
+	out, _ := json.Marshal(struct{ Date Date }{NewDate(2024, time.March, 9)})
+	if string(out) != `{"Date":"2024-03-09"}` {
+		t.Errorf("Marshal() = %s", out)
+	}
+}
+
+func TestDate_Scan(t *testing.T) {
+	want := NewDate(2024, time.March, 9)
+	for _, src := range []interface{}{"2024-03-09", []byte("2024-03-09"), time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)} {
+		var d Date
+		if err := d.Scan(src); err != nil || d != want {
+			t.Errorf("Scan(%#v) = %s, %v, want %s", src, d, err, want)
+		}
+	}
+}
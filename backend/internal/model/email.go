@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// QueuedEmail is a rendered message waiting in the send queue. It stays
+// queued until it is sent or given up on, so that a restart loses nothing.
+type QueuedEmail struct {
+	ID            int64
+	To            string
+	Message       []byte
+	Attempts      int
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
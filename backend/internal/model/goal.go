@@ -0,0 +1,74 @@
+package model
+
+import "time"
+
+// Goal metrics.
+const (
+	GoalCount    = "count"
+	GoalDuration = "duration"
+)
+
+// Goal periods.
+const (
+	GoalDaily   = "daily"
+	GoalWeekly  = "weekly"
+	GoalMonthly = "monthly"
+)
+
+// Goal is a target for a habit: a number of records, or of minutes, in each
+// day, week or month from StartDate until EndDate, or for good when EndDate
+// is nil.
+type Goal struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	HabitID   int64     `json:"habitId"`
+	Metric    string    `json:"metric"`
+	Period    string    `json:"period"`
+	Target    int       `json:"target"`
+	StartDate Date      `json:"startDate"`
+	EndDate   *Date     `json:"endDate,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GoalRequest creates or replaces a goal. StartDate defaults to today, or to
+// the current start of a replaced goal, and an empty EndDate leaves the goal
+// open-ended.
+type GoalRequest struct {
+	HabitID   int64  `json:"habitId" validate:"required"`
+	Metric    string `json:"metric" validate:"required"`
+	Period    string `json:"period" validate:"required"`
+	Target    int    `json:"target" validate:"required,min=1"`
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+}
+
+// ImportedGoal is a validated goal from a backup waiting to be written. Its
+// habit is looked up by HabitName inside the restore transaction.
+type ImportedGoal struct {
+	Goal      Goal
+	HabitName string
+}
+
+// GoalProgress is how a goal has gone so far, one entry per period. HitRate
+// is the percentage of finished periods that met the target; the period
+// that is still running is listed but not counted.
+type GoalProgress struct {
+	Goal     *Goal        `json:"goal"`
+	Periods  []GoalPeriod `json:"periods"`
+	Finished int          `json:"finished"`
+	Met      int          `json:"met"`
+	HitRate  float64      `json:"hitRate"`
+}
+
+// GoalPeriod is one day, week or month of a goal, cut to the goal's dates.
+// Percent is how much of the target Value reaches, at most 100.
+type GoalPeriod struct {
+	Start    Date    `json:"start"`
+	End      Date    `json:"end"`
+	Value    int     `json:"value"`
+	Target   int     `json:"target"`
+	Percent  float64 `json:"percent"`
+	Met      bool    `json:"met"`
+	Finished bool    `json:"finished"`
+}
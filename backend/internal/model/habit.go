@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+type Habit struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"-" db:"user_id"`
+	Name      string    `json:"name" db:"name"`
+	Color     string    `json:"color" db:"color"`
+	Icon      string    `json:"icon" db:"icon"`
+	Unit      string    `json:"unit" db:"unit"`
+	Archived  bool      `json:"archived" db:"archived"`
+	Schedule  *Schedule `json:"schedule" db:"schedule"` // nil when due every day
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type CreateHabitRequest struct {
+	Name     string    `json:"name" validate:"required,max=100"`
+	Color    string    `json:"color" validate:"max=20"`
+	Icon     string    `json:"icon" validate:"max=50"`
+	Unit     string    `json:"unit" validate:"max=20"`
+	Schedule *Schedule `json:"schedule"`
+}
+
+type UpdateHabitRequest struct {
+	Name     string    `json:"name" validate:"required,max=100"`
+	Color    string    `json:"color" validate:"max=20"`
+	Icon     string    `json:"icon" validate:"max=50"`
+	Unit     string    `json:"unit" validate:"max=20"`
+	Archived bool      `json:"archived"`
+	Schedule *Schedule `json:"schedule"`
+}
@@ -0,0 +1,32 @@
+package model
+
+// DayTotal is the activity logged on one day.
+type DayTotal struct {
+	Date     Date `json:"date"`
+	Count    int  `json:"count"`
+	Duration int  `json:"duration"`
+}
+
+type HeatmapDay struct {
+	DayTotal
+	Value int `json:"value"`
+	Level int `json:"level"`
+}
+
+// Heatmap lists the days with activity between From and To; days that are
+// missing had none and are level 0. A day is level n+1 when its value is
+// above Thresholds[n-1] and at most Thresholds[n].
+type Heatmap struct {
+	From       Date         `json:"from"`
+	To         Date         `json:"to"`
+	Metric     string       `json:"metric"`
+	Thresholds []int        `json:"thresholds"`
+	Days       []HeatmapDay `json:"days"`
+}
+
+type HeatmapQuery struct {
+	From    string
+	To      string
+	Metric  string
+	HabitID int64
+}
@@ -3,26 +3,32 @@ package model
 import "time"
 
 type Record struct {
-	ID        int64     `json:"id" db:"id"`
-	Date      string    `json:"date" db:"date"`
-	Content   string    `json:"content" db:"content"`
-	Duration  int       `json:"duration" db:"duration"`
-	Notes     string    `json:"notes" db:"notes"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	ID        int64      `json:"id" db:"id"`
+	UserID    int64      `json:"-" db:"user_id"`
+	HabitID   int64      `json:"habitId" db:"habit_id"`
+	Date      Date       `json:"date" db:"date"`
+	Content   string     `json:"content" db:"content"`
+	Duration  int        `json:"duration" db:"duration"`
+	Notes     string     `json:"notes" db:"notes"`
+	Version   int64      `json:"version" db:"version"` // incremented on every write
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time  `json:"updatedAt" db:"updated_at"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty" db:"deleted_at"` // set while the record is in the trash
 }
 
 type CreateRecordRequest struct {
+	HabitID  int64  `json:"habitId"`
 	Date     string `json:"date" validate:"required"`
-	Content  string `json:"content" validate:"required"`
-	Duration int    `json:"duration" validate:"required,min=1"`
+	Content  string `json:"content" validate:"max=255"`
+	Duration int    `json:"duration" validate:"required,min=1,max=1440"`
 	Notes    string `json:"notes"`
 }
 
 type UpdateRecordRequest struct {
+	HabitID  int64  `json:"habitId"`
 	Date     string `json:"date" validate:"required"`
-	Content  string `json:"content" validate:"required"`
-	Duration int    `json:"duration" validate:"required,min=1"`
+	Content  string `json:"content" validate:"max=255"`
+	Duration int    `json:"duration" validate:"required,min=1,max=1440"`
 	Notes    string `json:"notes"`
 }
 
@@ -34,7 +40,81 @@ type Stats struct {
 }
 
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success bool         `json:"success"`
+	Data    interface{}  `json:"data,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Code    string       `json:"code,omitempty"`
+	Field   string       `json:"field,omitempty"` // the first request field that Error is about
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ActivityDate is a day on which a habit has at least one record.
+type ActivityDate struct {
+	HabitID int64 `json:"habitId"`
+	Date    Date  `json:"date"`
+}
+
+// RecordFilter narrows, orders and pages the records returned by a listing.
+type RecordFilter struct {
+	From        string
+	To          string
+	HabitID     int64
+	Content     string
+	MinDuration int
+	MaxDuration int
+	Sort        string
+	Order       string
+	Limit       int
+	After       string
+
+	// Cursor is the decoded form of After, filled in by the service.
+	Cursor *RecordCursor
+}
+
+// RecordCursor marks the last record of a page by its sort key and id.
+type RecordCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    int64       `json:"id"`
+}
+
+type RecordPage struct {
+	Items      []Record `json:"items"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+	Total      int      `json:"total"`
+}
+
+// ImportRow is one data row of an imported CSV file, already mapped from the
+// file's columns. Line is the row's line number in the file.
+type ImportRow struct {
+	Line     int
+	Date     string
+	Habit    string
+	Content  string
+	Duration string
+	Notes    string
+}
+
+// ImportedRecord is a validated import row waiting to be written. Its habit is
+// looked up or created by HabitName inside the import transaction.
+type ImportedRecord struct {
+	Record    Record
+	HabitName string
+}
+
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ImportResult struct {
+	Imported int           `json:"imported"`
+	Errors   []ImportError `json:"errors"`
 }
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// Reminder asks for a notification at a local time of day when a habit is
+// due and nothing has been recorded for it yet that day.
+type Reminder struct {
+	ID       int64    `json:"id"`
+	UserID   int64    `json:"-"`
+	HabitID  int64    `json:"habitId"`
+	Time     string   `json:"time"`               // HH:MM
+	Weekdays []string `json:"weekdays,omitempty"` // empty for every day the habit is due
+	Timezone string   `json:"timezone,omitempty"` // IANA name, "" for the user's zone
+	Channel  string   `json:"channel"`
+	Enabled  bool     `json:"enabled"`
+	// LastFiredOn is the local day the reminder last fired, so that it
+	// fires at most once a day however often the server restarts.
+	LastFiredOn *Date     `json:"lastFiredOn,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type ReminderRequest struct {
+	HabitID  int64    `json:"habitId" validate:"required"`
+	Time     string   `json:"time" validate:"required"`
+	Weekdays []string `json:"weekdays"`
+	Timezone string   `json:"timezone"`
+	Channel  string   `json:"channel"`
+	Enabled  *bool    `json:"enabled"` // true when omitted
+}
+
+// ImportedReminder is a validated reminder from a backup waiting to be
+// written. Its habit is looked up by HabitName inside the restore transaction.
+type ImportedReminder struct {
+	Reminder  Reminder
+	HabitName string
+}
+
+// Notification is a message for a user, sent through one of the notifier
+// channels.
+type Notification struct {
+	UserID   int64
+	Username string
+	Email    string // "" if the user has not given one
+	Channel  string
+	Subject  string
+	Body     string
+}
@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// Actor is who makes a change, for the audit trail: the user, the API key
+// they used if any, and the id of the request the change was made in.
+type Actor struct {
+	UserID    int64
+	APIKeyID  int64
+	RequestID string
+}
+
+// Revision actions.
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// RecordRevision is one entry in the history of a record. Before is nil for
+// a create and After is nil for a delete.
+type RecordRevision struct {
+	ID        int64           `json:"id"`
+	RecordID  int64           `json:"recordId"`
+	Version   int64           `json:"version"` // the record's version after the change
+	Action    string          `json:"action"`
+	UserID    int64           `json:"userId"`
+	APIKeyID  int64           `json:"apiKeyId,omitempty"`
+	RequestID string          `json:"requestId,omitempty"`
+	Before    *RecordSnapshot `json:"before"`
+	After     *RecordSnapshot `json:"after"`
+	Changes   []FieldChange   `json:"changes"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// RecordSnapshot is the state of a record's fields at one revision.
+type RecordSnapshot struct {
+	HabitID   int64      `json:"habitId"`
+	Date      Date       `json:"date"`
+	Content   string     `json:"content"`
+	Duration  int        `json:"duration"`
+	Notes     string     `json:"notes"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"` // while in the trash
+}
+
+// SnapshotOf returns the fields of record that revisions keep.
+func SnapshotOf(record *Record) *RecordSnapshot {
+	return &RecordSnapshot{
+		HabitID:   record.HabitID,
+		Date:      record.Date,
+		Content:   record.Content,
+		Duration:  record.Duration,
+		Notes:     record.Notes,
+		DeletedAt: record.DeletedAt,
+	}
+}
+
+// FieldChange is one field that differs between the two sides of a revision.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
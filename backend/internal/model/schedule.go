@@ -0,0 +1,56 @@
+package model
+
+// Schedule frequencies.
+const (
+	ScheduleDaily   = "daily"
+	ScheduleWeekly  = "weekly"
+	ScheduleMonthly = "monthly"
+)
+
+// Schedule is when a habit is meant to be done, a small subset of an RRULE:
+//
+//   - daily: every Interval days
+//   - weekly with Weekdays: on those days of every Interval-th week
+//   - weekly or monthly with Times: on any Times days of each week or month
+//
+// Anchor is a day the schedule falls on, which fixes the phase of an
+// Interval above 1. A habit without a schedule is due every day.
+type Schedule struct {
+	Frequency string   `json:"frequency"`
+	Interval  int      `json:"interval,omitempty"`
+	Weekdays  []string `json:"weekdays,omitempty"`
+	Times     int      `json:"times,omitempty"`
+	Anchor    *Date    `json:"anchor,omitempty"`
+}
+
+// Occurrence is a span in which a scheduled habit is due on Required
+// different days: a single day for schedules with fixed days, a week or
+// month for the others.
+type Occurrence struct {
+	Start    Date `json:"start"`
+	End      Date `json:"end"`
+	Required int  `json:"required"`
+	Done     int  `json:"done"`
+	Met      bool `json:"met"`
+	Finished bool `json:"finished"`
+}
+
+// Completion is how well a habit kept to its schedule over a range of dates.
+// Rate is the percentage of finished occurrences that were met.
+type Completion struct {
+	HabitID     int64        `json:"habitId"`
+	Schedule    *Schedule    `json:"schedule"`
+	From        Date         `json:"from"`
+	To          Date         `json:"to"`
+	Occurrences []Occurrence `json:"occurrences"`
+	Finished    int          `json:"finished"`
+	Met         int          `json:"met"`
+	Rate        float64      `json:"rate"`
+}
+
+// CompletionQuery selects the dates of a completion report, by default the
+// 30 days ending today.
+type CompletionQuery struct {
+	From string
+	To   string
+}
@@ -0,0 +1,44 @@
+package model
+
+// SeriesTotal is the activity in one bucket of a series, for one group when
+// the series is grouped.
+type SeriesTotal struct {
+	Bucket   Date
+	Key      string
+	Count    int
+	Duration int
+}
+
+// SeriesBucket covers the interval starting on Start. Average is the mean
+// duration of its records.
+type SeriesBucket struct {
+	Start    Date    `json:"start"`
+	Count    int     `json:"count"`
+	Duration int     `json:"duration"`
+	Average  float64 `json:"average"`
+}
+
+type SeriesGroup struct {
+	Key     string         `json:"key"`
+	Buckets []SeriesBucket `json:"buckets"`
+}
+
+// Series lists every bucket between From and To, including empty ones. The
+// first and last buckets may extend past the range; only records inside it
+// are counted. Groups is set when the series is grouped.
+type Series struct {
+	Interval string         `json:"interval"`
+	From     Date           `json:"from"`
+	To       Date           `json:"to"`
+	GroupBy  string         `json:"groupBy,omitempty"`
+	Buckets  []SeriesBucket `json:"buckets"`
+	Groups   []SeriesGroup  `json:"groups,omitempty"`
+}
+
+type SeriesQuery struct {
+	Interval string
+	From     string
+	To       string
+	GroupBy  string
+	HabitID  int64
+}
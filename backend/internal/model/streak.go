@@ -0,0 +1,24 @@
+package model
+
+type Streak struct {
+	Current      int    `json:"current"`
+	Longest      int    `json:"longest"`
+	CurrentStart string `json:"currentStart,omitempty"`
+	CurrentEnd   string `json:"currentEnd,omitempty"`
+	LongestStart string `json:"longestStart,omitempty"`
+	LongestEnd   string `json:"longestEnd,omitempty"`
+}
+
+// HabitStreak is the streak of one habit, counted in occurrences of its
+// schedule when it has one.
+type HabitStreak struct {
+	HabitID  int64     `json:"habitId"`
+	Name     string    `json:"name"`
+	Schedule *Schedule `json:"schedule,omitempty"`
+	Streak
+}
+
+type StreakReport struct {
+	Overall Streak        `json:"overall"`
+	Habits  []HabitStreak `json:"habits"`
+}
@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+type User struct {
+	ID            int64     `json:"id" db:"id"`
+	Username      string    `json:"username" db:"username"`
+	PasswordHash  string    `json:"-" db:"password_hash"`
+	Timezone      string    `json:"timezone" db:"timezone"`            // IANA name, "" for the server default
+	WeekStart     string    `json:"weekStart" db:"week_start"`         // weekday name, "" for the server default
+	Email         string    `json:"email" db:"email"`                  // where email notifications go, "" for none
+	WeeklySummary bool      `json:"weeklySummary" db:"weekly_summary"` // email a summary of each week once it is over
+	SummarySentOn *Date     `json:"-" db:"summary_sent_on"`            // first day of the week the last summary went out in
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type Session struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"userId" db:"user_id"`
+	TokenHash string    `json:"-" db:"token_hash"`
+	ExpiresAt time.Time `json:"expiresAt" db:"expires_at"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type RegisterRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// UpdateSettingsRequest changes the fields that are set; an empty string
+// returns a setting to the server default.
+type UpdateSettingsRequest struct {
+	Timezone  *string `json:"timezone"`
+	WeekStart *string `json:"weekStart"`
+	Email     *string `json:"email"`
+	// WeeklySummary needs an email address to send the summaries to.
+	WeeklySummary *bool `json:"weeklySummary"`
+}
+
+// Calendar is how a request reckons days: the zone that decides which date
+// it is, and the day weeks start on.
+type Calendar struct {
+	Location  *time.Location
+	WeekStart time.Weekday
+}
+
+type AuthResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      *User     `json:"user"`
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	User     *User
+	APIKeyID int64
+	Scopes   []string
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook events.
+const (
+	EventRecordCreated = "record.created"
+	EventRecordUpdated = "record.updated"
+	EventRecordDeleted = "record.deleted"
+	EventStreakBroken  = "streak.broken"
+)
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook subscribes a URL to events of its user. Failures counts the
+// delivery attempts that failed in a row; too many disable the webhook.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	Failures  int       `json:"failures"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type WebhookRequest struct {
+	URL     string   `json:"url" validate:"required"`
+	Secret  string   `json:"secret"` // generated on create, kept on update when omitted
+	Events  []string `json:"events" validate:"required"`
+	Enabled *bool    `json:"enabled"` // true when omitted
+}
+
+// CreatedWebhook carries the signing secret, which is only ever shown once.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// Event is the JSON body posted to webhooks.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// RecordEvent is the data of the record events: the record as written, or as
+// it was when deleted.
+type RecordEvent struct {
+	Record *Record `json:"record"`
+}
+
+// StreakBrokenEvent is the data of streak.broken: a habit's streak of Length
+// days, or scheduled occurrences, ended on End and was not kept up.
+type StreakBrokenEvent struct {
+	HabitID int64  `json:"habitId"`
+	Name    string `json:"name"`
+	Length  int    `json:"length"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+}
+
+// WebhookDelivery is one event on its way to one webhook, kept as the
+// delivery log.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhookId"`
+	EventID        string          `json:"eventId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"` // while pending
+	ResponseStatus int             `json:"responseStatus,omitempty"`
+	Error          string          `json:"error,omitempty"` // of the last attempt
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+}
@@ -0,0 +1,28 @@
+// Package notify delivers notifications to users. Each channel, such as the
+// server log, is a Notifier; which ones are available is decided at startup.
+package notify
+
+import (
+	"context"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/pkg/logger"
+)
+
+// Log is the name of the channel that writes notifications to the log.
+const Log = "log"
+
+type Notifier interface {
+	// Notify delivers n, or returns an error if it may not have been
+	// delivered.
+	Notify(ctx context.Context, n *model.Notification) error
+}
+
+// LogNotifier writes notifications to the server log. It is always
+// available, which makes it handy for trying reminders out.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, n *model.Notification) error {
+	logger.Info("Notification for %s (user %d): %s: %s", n.Username, n.UserID, n.Subject, n.Body)
+	return nil
+}
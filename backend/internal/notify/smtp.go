@@ -0,0 +1,314 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"habit-tracker/internal/config"
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+	"habit-tracker/pkg/logger"
+)
+
+// Email is the name of the channel that sends notifications by email.
+const Email = "email"
+
+// ErrNoAddress is returned for notifications to users who have not given an
+// email address. Trying again will not help until they do.
+var ErrNoAddress = errors.New("user has no email address")
+
+// TLS modes of SMTPConfig.
+const (
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+	TLSNone     = "none"
+)
+
+// EmailSendInterval is how often Send should run.
+const EmailSendInterval = 10 * time.Second
+
+const (
+	smtpTimeout       = 30 * time.Second
+	emailBatchSize    = 20
+	maxEmailAttempts  = 5
+	defaultEmailRetry = time.Minute
+)
+
+var textBody = texttemplate.Must(texttemplate.New("text").Parse(`Hi {{.Username}},
+
+{{.Body}}
+
+--
+Habit Tracker
+`))
+
+var htmlBody = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family: sans-serif; color: #333;">
+<p>Hi {{.Username}},</p>
+<p>{{.Body}}</p>
+<p style="color: #999; font-size: 12px;">Habit Tracker</p>
+</body>
+</html>
+`))
+
+// SMTPNotifier sends notifications by email. Notify only renders and queues
+// the message; Send sends the queue, retrying failed sends with exponential
+// backoff. The queue is kept in the database, so messages still queued when
+// the server stops are sent once it is back.
+type SMTPNotifier struct {
+	cfg   config.SMTPConfig
+	from  *mail.Address
+	queue repository.EmailRepository
+	// send delivers one message; replaced in tests.
+	send func(e *model.QueuedEmail) error
+	// retryDelay is the wait before the first retry, doubled for each retry
+	// after it.
+	retryDelay time.Duration
+	now        func() time.Time
+}
+
+// NewSMTPNotifier returns a notifier that queues messages in queue and sends
+// them through the server in cfg.
+func NewSMTPNotifier(cfg config.SMTPConfig, queue repository.EmailRepository) (*SMTPNotifier, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("no SMTP host")
+	}
+	switch cfg.TLS {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("unknown TLS mode %q, want %s, %s or %s", cfg.TLS, TLSStartTLS, TLSImplicit, TLSNone)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %v", cfg.From, err)
+	}
+
+	n := &SMTPNotifier{
+		cfg:        cfg,
+		from:       from,
+		queue:      queue,
+		retryDelay: defaultEmailRetry,
+		now:        time.Now,
+	}
+	n.send = n.dial
+	return n, nil
+}
+
+// Notify queues n for sending. It fails only if n cannot be sent at all or
+// cannot be queued.
+func (s *SMTPNotifier) Notify(ctx context.Context, n *model.Notification) error {
+	if n.Email == "" {
+		return ErrNoAddress
+	}
+	msg, err := s.render(n)
+	if err != nil {
+		return err
+	}
+	return s.queue.Enqueue(&model.QueuedEmail{To: n.Email, Message: msg, NextAttemptAt: s.now()})
+}
+
+// Send sends the queued messages that are due at now. It is meant to run
+// every EmailSendInterval; several servers may run it against one database.
+func (s *SMTPNotifier) Send(ctx context.Context, now time.Time) error {
+	due, err := s.queue.ListDue(now, emailBatchSize)
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := s.attempt(&due[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attempt claims and sends e. A failed message is kept for a later attempt
+// unless it has had all its attempts or the server rejected it for good. The
+// claim outlasts a send, so that if this server stops halfway another one
+// takes the message over once it runs out.
+func (s *SMTPNotifier) attempt(e *model.QueuedEmail) error {
+	claimed, err := s.queue.Claim(e.ID, e.Attempts, s.now().Add(2*smtpTimeout))
+	if err != nil || !claimed {
+		return err
+	}
+	e.Attempts++
+
+	err = s.send(e)
+	if err == nil {
+		return s.queue.Delete(e.ID)
+	}
+	if e.Attempts >= maxEmailAttempts || permanent(err) {
+		logger.Error("Failed to send email to %s after %d attempts, giving up: %v", e.To, e.Attempts, err)
+		return s.queue.Delete(e.ID)
+	}
+
+	delay := s.retryDelay << (e.Attempts - 1)
+	logger.Error("Failed to send email to %s, retrying in %s: %v", e.To, delay, err)
+	return s.queue.Retry(e.ID, s.now().Add(delay))
+}
+
+// permanent reports whether err is a 5xx reply, which sending again will not
+// change.
+func permanent(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500
+}
+
+// render builds a multipart/alternative message with a plain-text and an
+// HTML body.
+func (s *SMTPNotifier) render(n *model.Notification) ([]byte, error) {
+	subject := n.Subject
+	if s.cfg.TestMode {
+		subject = "[TEST] " + subject
+	}
+	data := struct{ Username, Subject, Body string }{n.Username, subject, n.Body}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		execute     func(*bytes.Buffer) error
+	}{
+		{"text/plain", func(b *bytes.Buffer) error { return textBody.Execute(b, data) }},
+		{"text/html", func(b *bytes.Buffer) error { return htmlBody.Execute(b, data) }},
+	} {
+		var content bytes.Buffer
+		if err := part.execute(&content); err != nil {
+			return nil, err
+		}
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(content.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	id, err := s.messageID()
+	if err != nil {
+		return nil, err
+	}
+	to := mail.Address{Name: n.Username, Address: n.Email}
+
+	var msg bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", s.from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", s.now().Format(time.RFC1123Z)},
+		{"Message-ID", id},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func (s *SMTPNotifier) messageID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(s.from.Address, "@"); at >= 0 {
+		domain = s.from.Address[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
+
+// dial sends e through the configured server.
+func (s *SMTPNotifier) dial(e *model.QueuedEmail) error {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(e.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(e.Message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
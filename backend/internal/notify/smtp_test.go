@@ -0,0 +1,354 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/config"
+	"habit-tracker/internal/model"
+)
+
+func newTestNotifier(t *testing.T, cfg config.SMTPConfig) *SMTPNotifier {
+	t.Helper()
+	if cfg.Host == "" {
+		cfg.Host = "localhost"
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = TLSNone
+	}
+	if cfg.From == "" {
+		cfg.From = "Habit Tracker <noreply@example.com>"
+	}
+	n, err := NewSMTPNotifier(cfg, &memoryQueue{})
+	if err != nil {
+		t.Fatalf("NewSMTPNotifier() error = %v", err)
+	}
+	return n
+}
+
+// memoryQueue is an EmailRepository kept in memory.
+type memoryQueue struct {
+	emails []model.QueuedEmail
+	nextID int64
+}
+
+func (q *memoryQueue) Enqueue(email *model.QueuedEmail) error {
+	q.nextID++
+	email.ID = q.nextID
+	q.emails = append(q.emails, *email)
+	return nil
+}
+
+func (q *memoryQueue) ListDue(now time.Time, limit int) ([]model.QueuedEmail, error) {
+	var due []model.QueuedEmail
+	for _, e := range q.emails {
+		if !e.NextAttemptAt.After(now) && len(due) < limit {
+			due = append(due, e)
+		}
+	}
+	return due, nil
+}
+
+func (q *memoryQueue) Claim(id int64, attempts int, until time.Time) (bool, error) {
+	for i := range q.emails {
+		if q.emails[i].ID == id && q.emails[i].Attempts == attempts {
+			q.emails[i].Attempts++
+			q.emails[i].NextAttemptAt = until
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (q *memoryQueue) Retry(id int64, at time.Time) error {
+	for i := range q.emails {
+		if q.emails[i].ID == id {
+			q.emails[i].NextAttemptAt = at
+		}
+	}
+	return nil
+}
+
+func (q *memoryQueue) Delete(id int64) error {
+	for i := range q.emails {
+		if q.emails[i].ID == id {
+			q.emails = append(q.emails[:i], q.emails[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+var reminder = &model.Notification{
+	UserID:   1,
+	Username: "bob",
+	Email:    "bob@example.com",
+	Channel:  Email,
+	Subject:  "Reminder: Gym <3",
+	Body:     "Nothing has been recorded for Gym <3 today (2024-03-11) yet.",
+}
+
+func TestNewSMTPNotifier(t *testing.T) {
+	for name, cfg := range map[string]config.SMTPConfig{
+		"no host":          {TLS: TLSNone, From: "noreply@example.com"},
+		"unknown TLS mode": {Host: "localhost", TLS: "ssl", From: "noreply@example.com"},
+		"no from address":  {Host: "localhost", TLS: TLSNone},
+	} {
+		if _, err := NewSMTPNotifier(cfg, &memoryQueue{}); err == nil {
+			t.Errorf("NewSMTPNotifier() with %s succeeded, want an error", name)
+		}
+	}
+}
+
+func TestSMTPNotifier_Render(t *testing.T) {
+	n := newTestNotifier(t, config.SMTPConfig{TestMode: true})
+	raw, err := n.render(reminder)
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("render() = %q, not a message: %v", raw, err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "[TEST] Reminder: Gym <3" {
+		t.Errorf("Subject = %q, want the test-mode subject", subject)
+	}
+	if to := msg.Header.Get("To"); to != `"bob" <bob@example.com>` {
+		t.Errorf("To = %q", to)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("Message-ID = %q, want one in the sender's domain", msg.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+	bodies := make(map[string]string)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		body, _ := io.ReadAll(part) // quoted-printable is decoded by the reader
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[contentType] = string(body)
+	}
+	if !strings.Contains(bodies["text/plain"], "Hi bob,") || !strings.Contains(bodies["text/plain"], "Gym <3 today") {
+		t.Errorf("text body = %q", bodies["text/plain"])
+	}
+	if !strings.Contains(bodies["text/html"], "Gym &lt;3 today") {
+		t.Errorf("HTML body = %q, want the notification escaped", bodies["text/html"])
+	}
+}
+
+func TestSMTPNotifier_NoAddress(t *testing.T) {
+	n := newTestNotifier(t, config.SMTPConfig{})
+	if err := n.Notify(context.Background(), &model.Notification{Username: "bob", Subject: "Hi"}); !errors.Is(err, ErrNoAddress) {
+		t.Errorf("Notify() error = %v, want %v", err, ErrNoAddress)
+	}
+}
+
+func TestSMTPNotifier_Retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures []error
+		want     int // attempts
+	}{
+		{"sent at once", nil, 1},
+		{"sent after temporary failures", []error{errors.New("connection refused"), &textproto.Error{Code: 421, Msg: "try again later"}}, 3},
+		{"rejected", []error{&textproto.Error{Code: 550, Msg: "no such user"}}, 1},
+		{"never sent", []error{io.EOF, io.EOF, io.EOF, io.EOF, io.EOF, io.EOF}, maxEmailAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNotifier(t, config.SMTPConfig{})
+			now := time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC)
+			n.now = func() time.Time { return now }
+
+			attempts := 0
+			n.send = func(e *model.QueuedEmail) error {
+				attempts++
+				if attempts <= len(tt.failures) {
+					return tt.failures[attempts-1]
+				}
+				return nil
+			}
+
+			ctx := context.Background()
+			if err := n.Notify(ctx, reminder); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			for i := 0; i < 2*maxEmailAttempts; i++ {
+				if err := n.Send(ctx, now); err != nil {
+					t.Fatalf("Send() error = %v", err)
+				}
+				now = now.Add(time.Hour)
+			}
+			if attempts != tt.want {
+				t.Errorf("made %d attempts, want %d", attempts, tt.want)
+			}
+			if queued := n.queue.(*memoryQueue).emails; len(queued) != 0 {
+				t.Errorf("%d messages left in the queue, want none", len(queued))
+			}
+		})
+	}
+}
+
+func TestSMTPNotifier_Backoff(t *testing.T) {
+	n := newTestNotifier(t, config.SMTPConfig{})
+	queue := n.queue.(*memoryQueue)
+	now := time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+
+	attempts := 0
+	n.send = func(e *model.QueuedEmail) error {
+		attempts++
+		return io.EOF
+	}
+	ctx := context.Background()
+	n.Notify(ctx, reminder)
+
+	for _, step := range []struct {
+		after time.Duration
+		want  int
+	}{
+		{0, 1},
+		{n.retryDelay - time.Second, 1},
+		{time.Second, 2},
+		{2*n.retryDelay - time.Second, 2},
+		{time.Second, 3},
+	} {
+		now = now.Add(step.after)
+		n.Send(ctx, now)
+		if attempts != step.want {
+			t.Fatalf("%d attempts by %s, want %d", attempts, now.Format(time.TimeOnly), step.want)
+		}
+	}
+
+	// Another server sharing the queue, say after a restart, takes over.
+	other := newTestNotifier(t, config.SMTPConfig{})
+	other.queue = queue
+	other.send = func(e *model.QueuedEmail) error { return nil }
+	now = now.Add(4 * n.retryDelay)
+	if err := other.Send(ctx, now); err != nil || len(queue.emails) != 0 {
+		t.Errorf("Send() by another notifier error = %v, queue = %d messages, want it sent", err, len(queue.emails))
+	}
+}
+
+func TestSMTPNotifier_SendsThroughServer(t *testing.T) {
+	sink := newSMTPSink(t)
+	port, _ := strconv.Atoi(sink.port)
+	n := newTestNotifier(t, config.SMTPConfig{Host: "127.0.0.1", Port: port})
+
+	raw, err := n.render(reminder)
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	if err := n.dial(&model.QueuedEmail{To: reminder.Email, Message: raw}); err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+
+	got := <-sink.received
+	if got.from != "noreply@example.com" || got.to != "bob@example.com" {
+		t.Errorf("envelope = %s -> %s, want noreply@example.com -> bob@example.com", got.from, got.to)
+	}
+	if msg, err := mail.ReadMessage(strings.NewReader(got.data)); err != nil || msg.Header.Get("Message-ID") == "" {
+		t.Errorf("server received %q, want the rendered message", got.data)
+	}
+
+	n.cfg.TLS = TLSStartTLS
+	if err := n.dial(&model.QueuedEmail{To: reminder.Email, Message: raw}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("dial() with starttls to a server without it error = %v, want it refused", err)
+	}
+}
+
+type sinkMessage struct {
+	from, to, data string
+}
+
+// smtpSink is a minimal SMTP server, like MailHog, that accepts every
+// message without TLS or authentication.
+type smtpSink struct {
+	port     string
+	received chan sinkMessage
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &smtpSink{port: port, received: make(chan sinkMessage, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP sink")
+
+	var msg sinkMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(line[len("MAIL"):], " FROM:"), "<>")
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = strings.Trim(strings.TrimPrefix(line[len("RCPT"):], " TO:"), "<>")
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := io.ReadAll(bufio.NewReader(text.DotReader()))
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			s.received <- msg
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Not implemented")
+		}
+	}
+}
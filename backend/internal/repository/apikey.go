@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type APIKeyRepository interface {
+	Create(key *model.APIKey) error
+	GetByHash(keyHash string) (*model.APIKey, error)
+	GetAll(userID int64) ([]model.APIKey, error)
+	Revoke(userID, id int64) error
+	TouchLastUsed(id int64, at time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *DB
+}
+
+func NewAPIKeyRepository(db *DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) Create(key *model.APIKey) error {
+	now := time.Now()
+	id, err := insert(r.db,
+		`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, " "), now,
+	)
+	if err != nil {
+		return err
+	}
+
+	key.ID = id
+	key.CreatedAt = now
+	return nil
+}
+
+func (r *apiKeyRepository) GetByHash(keyHash string) (*model.APIKey, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, name, prefix, key_hash, scopes, last_used_at, revoked_at, created_at FROM api_keys WHERE key_hash = ?`,
+		keyHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := scanAPIKeys(rows)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	return &keys[0], nil
+}
+
+func (r *apiKeyRepository) GetAll(userID int64) ([]model.APIKey, error) {
+	rows, err := r.db.Query(
+		`SELECT id, user_id, name, prefix, key_hash, scopes, last_used_at, revoked_at, created_at FROM api_keys WHERE user_id = ? ORDER BY id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+func scanAPIKeys(rows *sql.Rows) ([]model.APIKey, error) {
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		var key model.APIKey
+		var scopes string
+		var lastUsed, revoked sql.NullTime
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &lastUsed, &revoked, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+		if lastUsed.Valid {
+			key.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			key.RevokedAt = &revoked.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *apiKeyRepository) Revoke(userID, id int64) error {
+	result, err := r.db.Exec(
+		`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now(), id, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *apiKeyRepository) TouchLastUsed(id int64, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, at, id)
+	return err
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"strings"
+
+	"habit-tracker/internal/model"
+)
+
+type BackupRepository interface {
+	Restore(actor *model.Actor, habits []model.Habit, records []model.ImportedRecord, goals []model.ImportedGoal,
+		reminders []model.ImportedReminder, replace bool) (*model.RestoreResult, error)
+}
+
+type backupRepository struct {
+	db *DB
+}
+
+func NewBackupRepository(db *DB) BackupRepository {
+	return &backupRepository{db: db}
+}
+
+// Restore writes habits, records, goals and reminders in one transaction.
+// Replacing first deletes everything the user owns, recording the deletion of
+// each live record; merging keeps it, matches habits by name and skips
+// records, goals and reminders identical to one already stored. Written
+// records get their ids; skipped ones keep none.
+func (r *backupRepository) Restore(actor *model.Actor, habits []model.Habit, records []model.ImportedRecord, goals []model.ImportedGoal,
+	reminders []model.ImportedReminder, replace bool) (*model.RestoreResult, error) {
+	userID := actor.UserID
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &model.RestoreResult{}
+	if replace {
+		if result.Replaced, err = reviseDeletions(tx, actor); err != nil {
+			return nil, err
+		}
+		for _, stmt := range []string{
+			`DELETE FROM records WHERE user_id = ?`,
+			`DELETE FROM goals WHERE user_id = ?`,
+			`DELETE FROM reminders WHERE user_id = ?`,
+			`DELETE FROM habits WHERE user_id = ?`,
+		} {
+			if _, err := tx.Exec(stmt, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resolver := newHabitResolver(tx, userID)
+	for i := range habits {
+		if _, err := resolver.resolve(&habits[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range records {
+		record := &records[i].Record
+		record.UserID = userID
+
+		id, err := resolver.resolve(&model.Habit{Name: records[i].HabitName})
+		if err != nil {
+			return nil, err
+		}
+		record.HabitID = id
+
+		if !replace {
+			exists, err := recordExists(tx, record)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				result.Skipped++
+				continue
+			}
+		}
+
+		if err := insertRecord(tx, actor, record); err != nil {
+			return nil, err
+		}
+		result.Records++
+	}
+
+	for i := range goals {
+		goal := &goals[i].Goal
+		goal.UserID = userID
+
+		id, err := resolver.resolve(&model.Habit{Name: goals[i].HabitName})
+		if err != nil {
+			return nil, err
+		}
+		goal.HabitID = id
+
+		if !replace {
+			exists, err := goalExists(tx, goal)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				result.Skipped++
+				continue
+			}
+		}
+
+		if err := insertGoal(tx, goal); err != nil {
+			return nil, err
+		}
+		result.Goals++
+	}
+
+	for i := range reminders {
+		reminder := &reminders[i].Reminder
+		reminder.UserID = userID
+
+		id, err := resolver.resolve(&model.Habit{Name: reminders[i].HabitName})
+		if err != nil {
+			return nil, err
+		}
+		reminder.HabitID = id
+
+		if !replace {
+			exists, err := reminderExists(tx, reminder)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				result.Skipped++
+				continue
+			}
+		}
+
+		if err := insertReminder(tx, reminder); err != nil {
+			return nil, err
+		}
+		result.Reminders++
+	}
+	result.Habits = resolver.created
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func recordExists(q querier, record *model.Record) (bool, error) {
+	var count int
+	err := q.QueryRow(
+		`SELECT COUNT(*) FROM records WHERE user_id = ? AND deleted_at IS NULL AND habit_id = ? AND date = ? AND content = ? AND duration = ? AND COALESCE(notes, '') = ?`,
+		record.UserID, record.HabitID, record.Date, record.Content, record.Duration, record.Notes,
+	).Scan(&count)
+	return count > 0, err
+}
+
+func goalExists(q querier, goal *model.Goal) (bool, error) {
+	var endDate string
+	if goal.EndDate != nil {
+		endDate = goal.EndDate.String()
+	}
+	var count int
+	err := q.QueryRow(
+		`SELECT COUNT(*) FROM goals WHERE user_id = ? AND habit_id = ? AND metric = ? AND period = ? AND target = ? AND start_date = ?
+		AND COALESCE(end_date, '') = ?`,
+		goal.UserID, goal.HabitID, goal.Metric, goal.Period, goal.Target, goal.StartDate, endDate,
+	).Scan(&count)
+	return count > 0, err
+}
+
+func reminderExists(q querier, reminder *model.Reminder) (bool, error) {
+	var count int
+	err := q.QueryRow(
+		`SELECT COUNT(*) FROM reminders WHERE user_id = ? AND habit_id = ? AND remind_at = ? AND weekdays = ? AND timezone = ? AND channel = ?`,
+		reminder.UserID, reminder.HabitID, reminder.Time, strings.Join(reminder.Weekdays, ","), reminder.Timezone, reminder.Channel,
+	).Scan(&count)
+	return count > 0, err
+}
+
+// reviseDeletions appends a delete revision for each of the actor's live
+// records, before a restore replaces them, and returns the records.
+func reviseDeletions(q querier, actor *model.Actor) ([]model.Record, error) {
+	rows, err := q.Query(
+		`SELECT id, user_id, COALESCE(habit_id, 0), date, content, duration, notes, version, created_at, updated_at FROM records WHERE user_id = ? AND deleted_at IS NULL ORDER BY id`,
+		actor.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var records []model.Record
+	for rows.Next() {
+		var record model.Record
+		if err := rows.Scan(&record.ID, &record.UserID, &record.HabitID, &record.Date, &record.Content, &record.Duration, &record.Notes, &record.Version, &record.CreatedAt, &record.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		record := &records[i]
+		if err := insertRevision(q, actor, model.RevisionDelete, record.ID, record.Version+1, model.SnapshotOf(record), nil); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
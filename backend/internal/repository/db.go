@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"habit-tracker/internal/config"
+	"habit-tracker/pkg/logger"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open connects to the configured database and, unless automatic migration
+// is turned off, brings its schema up to date.
+func Open(cfg *config.DatabaseConfig) (*DB, error) {
+	db, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.AutoMigrate {
+		if err := Migrate(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate: %w", err)
+		}
+	}
+
+	logger.Info("Database connected: %s", cfg.Driver)
+	return db, nil
+}
+
+// Connect opens the configured database without touching its schema.
+func Connect(cfg *config.DatabaseConfig) (*DB, error) {
+	d, err := dialectFor(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(d.driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return &DB{DB: db, dialect: d}, nil
+}
+
+// stamp fills in creation and update times that are not set yet, so that
+// restored rows keep the times they were backed up with.
+func stamp(createdAt, updatedAt *time.Time) {
+	if createdAt.IsZero() {
+		*createdAt = time.Now()
+	}
+	if updatedAt.IsZero() {
+		*updatedAt = *createdAt
+	}
+}
+
+func nullableID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	sqlite   = "sqlite"
+	mysql    = "mysql"
+	postgres = "postgres"
+)
+
+// dialect captures what differs between the supported databases. Queries in
+// this package are written with ? placeholders and portable SQL; DB and Tx
+// adapt them through the dialect.
+type dialect struct {
+	name   string
+	driver string // database/sql driver name
+
+	// numbered placeholders ($1, $2, ...) instead of ?
+	numbered bool
+	// new ids are read with RETURNING id instead of LastInsertId
+	returning bool
+}
+
+var dialects = map[string]*dialect{
+	"sqlite":     {name: sqlite, driver: "sqlite3"},
+	"sqlite3":    {name: sqlite, driver: "sqlite3"},
+	"mysql":      {name: mysql, driver: "mysql"},
+	"postgres":   {name: postgres, driver: "postgres", numbered: true, returning: true},
+	"postgresql": {name: postgres, driver: "postgres", numbered: true, returning: true},
+}
+
+func dialectFor(driver string) (*dialect, error) {
+	d, ok := dialects[strings.ToLower(driver)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	return d, nil
+}
+
+// isUniqueViolation reports whether err is a database's refusal to write a
+// row that clashes with another on a UNIQUE column.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	var mysqlErr *mysqldriver.MySQLError
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &sqliteErr):
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == 1062 // ER_DUP_ENTRY
+	case errors.As(err, &pqErr):
+		return pqErr.Code == "23505" // unique_violation
+	}
+	return false
+}
+
+// rebind rewrites ? placeholders for databases that number them. Question
+// marks inside quoted strings are left alone.
+func (d *dialect) rebind(query string) string {
+	if !d.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote rune
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// dateBucket returns an expression for the first day, as YYYY-MM-DD, of the
+// day, week (starting on weekStart), month or year that the YYYY-MM-DD text
+// in expr falls in.
+func (d *dialect) dateBucket(interval, expr string, weekStart time.Weekday) string {
+	switch interval {
+	case "week":
+		switch d.name {
+		case mysql:
+			return fmt.Sprintf("DATE_FORMAT(DATE_SUB(%[1]s, INTERVAL (DAYOFWEEK(%[1]s) + 6 - %[2]d) %% 7 DAY), '%%Y-%%m-%%d')", expr, weekStart)
+		case postgres:
+			return fmt.Sprintf("TO_CHAR(CAST(%[1]s AS DATE) - (CAST(EXTRACT(DOW FROM CAST(%[1]s AS DATE)) AS INTEGER) + 7 - %[2]d) %% 7, 'YYYY-MM-DD')", expr, weekStart)
+		default:
+			return fmt.Sprintf("date(%[1]s, '-' || ((CAST(strftime('%%w', %[1]s) AS INTEGER) + 7 - %[2]d) %% 7) || ' days')", expr, weekStart)
+		}
+	case "month":
+		return d.concat(fmt.Sprintf("SUBSTR(%s, 1, 7)", expr), "'-01'")
+	case "year":
+		return d.concat(fmt.Sprintf("SUBSTR(%s, 1, 4)", expr), "'-01-01'")
+	default:
+		return expr
+	}
+}
+
+func (d *dialect) concat(parts ...string) string {
+	if d.name == mysql {
+		return "CONCAT(" + strings.Join(parts, ", ") + ")"
+	}
+	return strings.Join(parts, " || ")
+}
+
+// DB is a database handle that speaks the dialect of the database behind it.
+type DB struct {
+	*sql.DB
+	dialect *dialect
+}
+
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), args...)
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, dialect: db.dialect}, nil
+}
+
+func (db *DB) sqlDialect() *dialect { return db.dialect }
+
+// Tx is a transaction on a DB.
+type Tx struct {
+	*sql.Tx
+	dialect *dialect
+}
+
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
+}
+
+func (tx *Tx) sqlDialect() *dialect { return tx.dialect }
+
+// savepoint runs fn inside the savepoint name. When fn fails, the writes it
+// made are rolled back and the transaction stays usable, which Postgres
+// otherwise refuses after an error.
+func (tx *Tx) savepoint(name string, fn func() error) error {
+	if _, err := tx.Exec(`SAVEPOINT ` + name); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec(`ROLLBACK TO SAVEPOINT ` + name); rbErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	_, err := tx.Exec(`RELEASE SAVEPOINT ` + name)
+	return err
+}
+
+// querier is satisfied by both DB and Tx, so helpers written against it work
+// inside and outside transactions.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	sqlDialect() *dialect
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows, so one scan
+// function serves single lookups and lists.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// insert runs an INSERT statement and returns the id of the new row.
+func insert(q querier, query string, args ...interface{}) (int64, error) {
+	if q.sqlDialect().returning {
+		var id int64
+		err := q.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type EmailRepository interface {
+	Enqueue(email *model.QueuedEmail) error
+	// ListDue returns up to limit messages whose next attempt is due at now,
+	// oldest first.
+	ListDue(now time.Time, limit int) ([]model.QueuedEmail, error)
+	// Claim counts an attempt at a message that has had attempts so far and
+	// holds it until until, unless another run has claimed it first, and
+	// reports whether it did. Whoever claims it owns the attempt.
+	Claim(id int64, attempts int, until time.Time) (bool, error)
+	// Retry schedules the next attempt at a message.
+	Retry(id int64, at time.Time) error
+	// Delete removes a message that has been sent or given up on.
+	Delete(id int64) error
+}
+
+type emailRepository struct {
+	db *DB
+}
+
+func NewEmailRepository(db *DB) EmailRepository {
+	return &emailRepository{db: db}
+}
+
+func (r *emailRepository) Enqueue(email *model.QueuedEmail) error {
+	if email.CreatedAt.IsZero() {
+		email.CreatedAt = time.Now()
+	}
+	id, err := insert(r.db,
+		`INSERT INTO email_queue (recipient, message, attempts, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+		email.To, string(email.Message), email.Attempts, email.NextAttemptAt.UTC(), email.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	email.ID = id
+	return nil
+}
+
+func (r *emailRepository) ListDue(now time.Time, limit int) ([]model.QueuedEmail, error) {
+	rows, err := r.db.Query(
+		`SELECT id, recipient, message, attempts, next_attempt_at, created_at FROM email_queue
+		WHERE next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+		now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []model.QueuedEmail
+	for rows.Next() {
+		var e model.QueuedEmail
+		var message string
+		if err := rows.Scan(&e.ID, &e.To, &message, &e.Attempts, &e.NextAttemptAt, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Message = []byte(message)
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
+
+func (r *emailRepository) Claim(id int64, attempts int, until time.Time) (bool, error) {
+	result, err := r.db.Exec(
+		`UPDATE email_queue SET attempts = attempts + 1, next_attempt_at = ? WHERE id = ? AND attempts = ?`,
+		until.UTC(), id, attempts,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *emailRepository) Retry(id int64, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE email_queue SET next_attempt_at = ? WHERE id = ?`, at.UTC(), id)
+	return err
+}
+
+func (r *emailRepository) Delete(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM email_queue WHERE id = ?`, id)
+	return err
+}
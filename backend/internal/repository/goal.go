@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type GoalRepository interface {
+	Create(goal *model.Goal) error
+	GetByID(userID, id int64) (*model.Goal, error)
+	// GetAll returns the user's goals, only those of one habit when habitID
+	// is not 0.
+	GetAll(userID, habitID int64) ([]model.Goal, error)
+	Update(goal *model.Goal) error
+	Delete(userID, id int64) error
+}
+
+type goalRepository struct {
+	db *DB
+}
+
+func NewGoalRepository(db *DB) GoalRepository {
+	return &goalRepository{db: db}
+}
+
+const goalColumns = `id, user_id, habit_id, metric, period, target, start_date, end_date, created_at, updated_at`
+
+func (r *goalRepository) Create(goal *model.Goal) error {
+	return insertGoal(r.db, goal)
+}
+
+func insertGoal(q querier, goal *model.Goal) error {
+	stamp(&goal.CreatedAt, &goal.UpdatedAt)
+	id, err := insert(q,
+		`INSERT INTO goals (user_id, habit_id, metric, period, target, start_date, end_date, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		goal.UserID, goal.HabitID, goal.Metric, goal.Period, goal.Target, goal.StartDate, nullableDate(goal.EndDate), goal.CreatedAt, goal.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	goal.ID = id
+	return nil
+}
+
+func (r *goalRepository) GetByID(userID, id int64) (*model.Goal, error) {
+	goal, err := scanGoal(r.db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = ? AND user_id = ?`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (r *goalRepository) GetAll(userID, habitID int64) ([]model.Goal, error) {
+	query := `SELECT ` + goalColumns + ` FROM goals WHERE user_id = ?`
+	args := []interface{}{userID}
+	if habitID != 0 {
+		query += ` AND habit_id = ?`
+		args = append(args, habitID)
+	}
+	query += ` ORDER BY habit_id, id`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []model.Goal
+	for rows.Next() {
+		goal, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, *goal)
+	}
+	return goals, rows.Err()
+}
+
+func (r *goalRepository) Update(goal *model.Goal) error {
+	goal.UpdatedAt = time.Now()
+	result, err := r.db.Exec(
+		`UPDATE goals SET habit_id = ?, metric = ?, period = ?, target = ?, start_date = ?, end_date = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+		goal.HabitID, goal.Metric, goal.Period, goal.Target, goal.StartDate, nullableDate(goal.EndDate), goal.UpdatedAt, goal.ID, goal.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *goalRepository) Delete(userID, id int64) error {
+	result, err := r.db.Exec(`DELETE FROM goals WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanGoal(row rowScanner) (*model.Goal, error) {
+	goal := &model.Goal{}
+	var endDate model.Date
+	err := row.Scan(&goal.ID, &goal.UserID, &goal.HabitID, &goal.Metric, &goal.Period, &goal.Target, &goal.StartDate, &endDate, &goal.CreatedAt, &goal.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if !endDate.IsZero() {
+		goal.EndDate = &endDate
+	}
+	return goal, nil
+}
+
+func nullableDate(date *model.Date) interface{} {
+	if date == nil {
+		return nil
+	}
+	return *date
+}
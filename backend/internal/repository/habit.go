@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type HabitRepository interface {
+	Create(habit *model.Habit) error
+	GetByID(userID, id int64) (*model.Habit, error)
+	GetByName(userID int64, name string) (*model.Habit, error)
+	GetAll(userID int64, includeArchived bool) ([]model.Habit, error)
+	Update(habit *model.Habit) error
+	Delete(userID, id int64) error
+	CountRecords(userID, id int64) (int, error)
+}
+
+type habitRepository struct {
+	db querier
+}
+
+func NewHabitRepository(db *DB) HabitRepository {
+	return &habitRepository{db: db}
+}
+
+func (r *habitRepository) Create(habit *model.Habit) error {
+	return insertHabit(r.db, habit)
+}
+
+const habitColumns = `id, user_id, name, color, icon, unit, archived, schedule, created_at, updated_at`
+
+func insertHabit(q querier, habit *model.Habit) error {
+	schedule, err := scheduleState(habit.Schedule)
+	if err != nil {
+		return err
+	}
+
+	stamp(&habit.CreatedAt, &habit.UpdatedAt)
+	id, err := insert(q,
+		`INSERT INTO habits (user_id, name, color, icon, unit, archived, schedule, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		habit.UserID, habit.Name, habit.Color, habit.Icon, habit.Unit, habit.Archived, schedule, habit.CreatedAt, habit.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	habit.ID = id
+	return nil
+}
+
+// habitResolver maps habit names to ids inside a transaction, creating the
+// habits that do not exist yet.
+type habitResolver struct {
+	q       querier
+	userID  int64
+	ids     map[string]int64
+	created int
+}
+
+func newHabitResolver(q querier, userID int64) *habitResolver {
+	return &habitResolver{q: q, userID: userID, ids: make(map[string]int64)}
+}
+
+// resolve returns the id of the user's habit named like habit, inserting
+// habit when there is none.
+func (h *habitResolver) resolve(habit *model.Habit) (int64, error) {
+	habit.Name = strings.TrimSpace(habit.Name)
+	key := strings.ToLower(habit.Name)
+	if id, ok := h.ids[key]; ok {
+		return id, nil
+	}
+
+	existing, err := getHabitByName(h.q, h.userID, habit.Name)
+	if err != nil {
+		return 0, err
+	}
+	if existing == nil {
+		habit.UserID = h.userID
+		if err := insertHabit(h.q, habit); err != nil {
+			return 0, err
+		}
+		h.created++
+		existing = habit
+	}
+
+	h.ids[key] = existing.ID
+	return existing.ID, nil
+}
+
+func (r *habitRepository) GetByID(userID, id int64) (*model.Habit, error) {
+	return r.getOne(
+		`SELECT `+habitColumns+` FROM habits WHERE id = ? AND user_id = ?`,
+		id, userID,
+	)
+}
+
+// GetByName looks a habit up by name, ignoring case and surrounding whitespace.
+func (r *habitRepository) GetByName(userID int64, name string) (*model.Habit, error) {
+	return getHabitByName(r.db, userID, name)
+}
+
+func getHabitByName(q querier, userID int64, name string) (*model.Habit, error) {
+	return getHabit(q,
+		`SELECT `+habitColumns+` FROM habits WHERE user_id = ? AND LOWER(name) = LOWER(TRIM(?)) ORDER BY id LIMIT 1`,
+		userID, name,
+	)
+}
+
+func (r *habitRepository) getOne(query string, args ...interface{}) (*model.Habit, error) {
+	return getHabit(r.db, query, args...)
+}
+
+func getHabit(q querier, query string, args ...interface{}) (*model.Habit, error) {
+	habit, err := scanHabit(q.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return habit, nil
+}
+
+func (r *habitRepository) GetAll(userID int64, includeArchived bool) ([]model.Habit, error) {
+	query := `SELECT ` + habitColumns + ` FROM habits WHERE user_id = ?`
+	args := []interface{}{userID}
+	if !includeArchived {
+		query += ` AND archived = ?`
+		args = append(args, false)
+	}
+	query += ` ORDER BY name, id`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var habits []model.Habit
+	for rows.Next() {
+		habit, err := scanHabit(rows)
+		if err != nil {
+			return nil, err
+		}
+		habits = append(habits, *habit)
+	}
+	return habits, rows.Err()
+}
+
+func scanHabit(row rowScanner) (*model.Habit, error) {
+	habit := &model.Habit{}
+	var schedule sql.NullString
+	err := row.Scan(&habit.ID, &habit.UserID, &habit.Name, &habit.Color, &habit.Icon, &habit.Unit, &habit.Archived, &schedule, &habit.CreatedAt, &habit.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Valid {
+		habit.Schedule = &model.Schedule{}
+		if err := json.Unmarshal([]byte(schedule.String), habit.Schedule); err != nil {
+			return nil, err
+		}
+	}
+	return habit, nil
+}
+
+func scheduleState(schedule *model.Schedule) (interface{}, error) {
+	if schedule == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (r *habitRepository) Update(habit *model.Habit) error {
+	schedule, err := scheduleState(habit.Schedule)
+	if err != nil {
+		return err
+	}
+
+	habit.UpdatedAt = time.Now()
+	result, err := r.db.Exec(
+		`UPDATE habits SET name = ?, color = ?, icon = ?, unit = ?, archived = ?, schedule = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+		habit.Name, habit.Color, habit.Icon, habit.Unit, habit.Archived, schedule, habit.UpdatedAt, habit.ID, habit.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete removes a habit together with its goals and reminders, which
+// SQLite does not cascade to without foreign key enforcement.
+func (r *habitRepository) Delete(userID, id int64) error {
+	for _, stmt := range []string{
+		`DELETE FROM goals WHERE habit_id = ? AND user_id = ?`,
+		`DELETE FROM reminders WHERE habit_id = ? AND user_id = ?`,
+	} {
+		if _, err := r.db.Exec(stmt, id, userID); err != nil {
+			return err
+		}
+	}
+	result, err := r.db.Exec(`DELETE FROM habits WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *habitRepository) CountRecords(userID, id int64) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM records WHERE habit_id = ? AND user_id = ?`, id, userID).Scan(&count)
+	return count, err
+}
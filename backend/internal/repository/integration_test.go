@@ -0,0 +1,573 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/config"
+	"habit-tracker/internal/model"
+)
+
+// testDatabases opens every database the repository tests run against: a
+// fresh SQLite file, plus Postgres and MySQL when TEST_POSTGRES_DSN or
+// TEST_MYSQL_DSN name a scratch database. Those databases are wiped and
+// migrated from scratch.
+func testDatabases(t *testing.T) map[string]*DB {
+	t.Helper()
+
+	configs := map[string]config.DatabaseConfig{
+		sqlite: {Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "test.db")},
+	}
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		configs[postgres] = config.DatabaseConfig{Driver: "postgres", DSN: dsn}
+	}
+	if dsn := os.Getenv("TEST_MYSQL_DSN"); dsn != "" {
+		configs[mysql] = config.DatabaseConfig{Driver: "mysql", DSN: dsn}
+	}
+
+	dbs := make(map[string]*DB)
+	for name, cfg := range configs {
+		db, err := Connect(&cfg)
+		if err != nil {
+			t.Fatalf("%s: Connect() error = %v", name, err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		if err := Rollback(db, len(migrations)); err != nil {
+			t.Fatalf("%s: Rollback() error = %v", name, err)
+		}
+		if err := Migrate(db); err != nil {
+			t.Fatalf("%s: Migrate() error = %v", name, err)
+		}
+		dbs[name] = db
+	}
+	return dbs
+}
+
+func TestDialect_Rebind(t *testing.T) {
+	d, _ := dialectFor("postgres")
+	got := d.rebind(`SELECT * FROM records WHERE user_id = ? AND content LIKE ? ESCAPE '?' AND id > ?`)
+	want := `SELECT * FROM records WHERE user_id = $1 AND content LIKE $2 ESCAPE '?' AND id > $3`
+	if got != want {
+		t.Errorf("rebind() = %s, want %s", got, want)
+	}
+
+	d, _ = dialectFor("sqlite")
+	if q := `SELECT ?`; d.rebind(q) != q {
+		t.Errorf("rebind() changed a sqlite query: %s", d.rebind(q))
+	}
+
+	if _, err := dialectFor("oracle"); err == nil {
+		t.Error("dialectFor(oracle) error = nil, want an error")
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			states, err := MigrationStatus(db)
+			if err != nil {
+				t.Fatalf("MigrationStatus() error = %v", err)
+			}
+			for _, s := range states {
+				if s.AppliedAt == nil {
+					t.Errorf("migration %d_%s is pending after Migrate()", s.Version, s.Name)
+				}
+			}
+
+			if err := Rollback(db, len(migrations)); err != nil {
+				t.Fatalf("Rollback() error = %v", err)
+			}
+			if exists, _ := tableExists(db, "records"); exists {
+				t.Error("records table still exists after rolling everything back")
+			}
+			if err := Migrate(db); err != nil {
+				t.Fatalf("Migrate() after Rollback() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRepositories(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			user := &model.User{Username: "alice", PasswordHash: "x"}
+			if err := NewUserRepository(db).Create(user); err != nil || user.ID == 0 {
+				t.Fatalf("users.Create() id = %d, error = %v", user.ID, err)
+			}
+			if err := NewUserRepository(db).Create(&model.User{Username: "alice", PasswordHash: "y"}); !errors.Is(err, ErrUsernameExists) {
+				t.Fatalf("users.Create() of a taken name error = %v, want %v", err, ErrUsernameExists)
+			}
+			user.Timezone, user.WeekStart, user.Email, user.WeeklySummary = "Asia/Shanghai", "monday", "alice@example.com", true
+			if err := NewUserRepository(db).UpdateSettings(user); err != nil {
+				t.Fatalf("users.UpdateSettings() error = %v", err)
+			}
+			if found, err := NewUserRepository(db).GetByID(user.ID); err != nil || found.Timezone != user.Timezone || found.WeekStart != user.WeekStart || found.Email != user.Email || !found.WeeklySummary {
+				t.Fatalf("users.GetByID() = %+v, %v, want the updated settings", found, err)
+			}
+			week := day("2024-03-04")
+			if ok, err := NewUserRepository(db).SetSummarySent(user.ID, nil, &week); err != nil || !ok {
+				t.Fatalf("users.SetSummarySent() = %v, %v, want true", ok, err)
+			}
+			if ok, err := NewUserRepository(db).SetSummarySent(user.ID, nil, &week); err != nil || ok {
+				t.Errorf("users.SetSummarySent() from a stale week = %v, %v, want false", ok, err)
+			}
+			if recipients, err := NewUserRepository(db).ListSummaryRecipients(); err != nil || len(recipients) != 1 || recipients[0].SummarySentOn == nil || *recipients[0].SummarySentOn != week {
+				t.Fatalf("users.ListSummaryRecipients() = %+v, %v, want alice, sent on %s", recipients, err, week)
+			}
+			actor := &model.Actor{UserID: user.ID, RequestID: "test-request"}
+
+			habits := NewHabitRepository(db)
+			habit := &model.Habit{UserID: user.ID, Name: "Running"}
+			if err := habits.Create(habit); err != nil {
+				t.Fatalf("habits.Create() error = %v", err)
+			}
+			if found, err := habits.GetByName(user.ID, " running "); err != nil || found == nil || found.ID != habit.ID {
+				t.Fatalf("habits.GetByName() = %+v, %v, want habit %d", found, err, habit.ID)
+			}
+
+			goals := NewGoalRepository(db)
+			end := day("2024-03-31")
+			goal := &model.Goal{UserID: user.ID, HabitID: habit.ID, Metric: model.GoalCount, Period: model.GoalWeekly, Target: 3, StartDate: day("2024-01-01")}
+			if err := goals.Create(goal); err != nil || goal.ID == 0 {
+				t.Fatalf("goals.Create() id = %d, error = %v", goal.ID, err)
+			}
+			goal.Target, goal.EndDate = 4, &end
+			if err := goals.Update(goal); err != nil {
+				t.Fatalf("goals.Update() error = %v", err)
+			}
+			if found, err := goals.GetByID(user.ID, goal.ID); err != nil || found == nil || found.Target != 4 || found.EndDate == nil || *found.EndDate != end || found.StartDate != goal.StartDate {
+				t.Fatalf("goals.GetByID() = %+v, %v, want the updated goal", found, err)
+			}
+			swimming := &model.Habit{UserID: user.ID, Name: "Swimming", Schedule: &model.Schedule{Frequency: model.ScheduleWeekly, Interval: 1, Weekdays: []string{"monday", "friday"}}}
+			habits.Create(swimming)
+			if found, err := habits.GetByID(user.ID, swimming.ID); err != nil || found == nil || !reflect.DeepEqual(found.Schedule, swimming.Schedule) {
+				t.Fatalf("habits.GetByID() = %+v, %v, want the schedule %+v", found, err, swimming.Schedule)
+			}
+			swimming.Schedule = nil
+			if err := habits.Update(swimming); err != nil {
+				t.Fatalf("habits.Update() error = %v", err)
+			}
+			if found, err := habits.GetByID(user.ID, swimming.ID); err != nil || found.Schedule != nil {
+				t.Fatalf("habits.GetByID() = %+v, %v, want the schedule cleared", found, err)
+			}
+			goals.Create(&model.Goal{UserID: user.ID, HabitID: swimming.ID, Metric: model.GoalDuration, Period: model.GoalDaily, Target: 30, StartDate: day("2024-01-01")})
+			if all, err := goals.GetAll(user.ID, swimming.ID); err != nil || len(all) != 1 {
+				t.Fatalf("goals.GetAll() of one habit = %+v, %v, want 1 goal", all, err)
+			}
+			reminders := NewReminderRepository(db)
+			reminder := &model.Reminder{UserID: user.ID, HabitID: swimming.ID, Time: "07:30", Weekdays: []string{"monday", "friday"}, Channel: "log", Enabled: true}
+			if err := reminders.Create(reminder); err != nil || reminder.ID == 0 {
+				t.Fatalf("reminders.Create() id = %d, error = %v", reminder.ID, err)
+			}
+			monday := day("2024-03-11")
+			if ok, err := reminders.SetLastFired(reminder.ID, nil, &monday); err != nil || !ok {
+				t.Fatalf("reminders.SetLastFired() = %v, %v, want true", ok, err)
+			}
+			if ok, err := reminders.SetLastFired(reminder.ID, nil, &monday); err != nil || ok {
+				t.Errorf("reminders.SetLastFired() from a stale day = %v, %v, want false", ok, err)
+			}
+			if enabled, err := reminders.ListEnabled(); err != nil || len(enabled) != 1 || enabled[0].LastFiredOn == nil || *enabled[0].LastFiredOn != monday || !reflect.DeepEqual(enabled[0].Weekdays, reminder.Weekdays) {
+				t.Fatalf("reminders.ListEnabled() = %+v, %v, want the reminder fired on %s", enabled, err, monday)
+			}
+			reminder.Enabled = false
+			if err := reminders.Update(reminder); err != nil {
+				t.Fatalf("reminders.Update() error = %v", err)
+			}
+			if enabled, err := reminders.ListEnabled(); err != nil || len(enabled) != 0 {
+				t.Errorf("reminders.ListEnabled() after disabling = %+v, %v, want none", enabled, err)
+			}
+			if err := habits.Delete(user.ID, swimming.ID); err != nil {
+				t.Fatalf("habits.Delete() error = %v", err)
+			}
+			if all, err := reminders.GetAll(user.ID); err != nil || len(all) != 0 {
+				t.Errorf("reminders.GetAll() after deleting a habit = %+v, %v, want none", all, err)
+			}
+			if all, err := goals.GetAll(user.ID, 0); err != nil || len(all) != 1 || all[0].ID != goal.ID {
+				t.Errorf("goals.GetAll() after deleting a habit = %+v, %v, want only goal %d", all, err, goal.ID)
+			}
+			if err := goals.Delete(user.ID+1, goal.ID); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("goals.Delete() by another user error = %v, want %v", err, sql.ErrNoRows)
+			}
+
+			webhooks := NewWebhookRepository(db)
+			webhook := &model.Webhook{UserID: user.ID, URL: "https://example.com/hook", Secret: "0123456789abcdef", Events: []string{model.EventRecordCreated, model.EventStreakBroken}, Enabled: true}
+			if err := webhooks.Create(webhook); err != nil || webhook.ID == 0 {
+				t.Fatalf("webhooks.Create() id = %d, error = %v", webhook.ID, err)
+			}
+			if found, err := webhooks.GetByID(user.ID, webhook.ID); err != nil || found == nil || !reflect.DeepEqual(found.Events, webhook.Events) || found.Secret != webhook.Secret {
+				t.Fatalf("webhooks.GetByID() = %+v, %v, want %+v", found, err, webhook)
+			}
+			queued := time.Now().Add(-time.Minute)
+			delivery := &model.WebhookDelivery{WebhookID: webhook.ID, EventID: "e1", Event: model.EventRecordCreated, Payload: []byte(`{"id":"e1"}`), Status: model.DeliveryPending, NextAttemptAt: &queued}
+			for i, want := range []bool{true, false} {
+				if ok, err := webhooks.Enqueue(delivery); err != nil || ok != want {
+					t.Fatalf("webhooks.Enqueue() #%d = %v, %v, want %v", i+1, ok, err, want)
+				}
+			}
+			due, err := webhooks.ListDue(time.Now(), 10)
+			if err != nil || len(due) != 1 || string(due[0].Payload) != `{"id":"e1"}` {
+				t.Fatalf("webhooks.ListDue() = %+v, %v, want the queued delivery", due, err)
+			}
+			lease := time.Now().Add(time.Minute)
+			if ok, err := webhooks.Claim(delivery.ID, 0, lease); err != nil || !ok {
+				t.Fatalf("webhooks.Claim() = %v, %v, want true", ok, err)
+			}
+			if ok, err := webhooks.Claim(delivery.ID, 0, lease); err != nil || ok {
+				t.Errorf("webhooks.Claim() again = %v, %v, want false", ok, err)
+			}
+			if due, err := webhooks.ListDue(time.Now(), 10); err != nil || len(due) != 0 {
+				t.Errorf("webhooks.ListDue() while claimed = %+v, %v, want none", due, err)
+			}
+			delivered := time.Now()
+			delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.DeliveredAt = model.DeliveryDelivered, 1, nil, 204, &delivered
+			if err := webhooks.Finish(delivery); err != nil {
+				t.Fatalf("webhooks.Finish() error = %v", err)
+			}
+			if log, err := webhooks.ListDeliveries(webhook.ID, 10); err != nil || len(log) != 1 || log[0].Status != model.DeliveryDelivered || log[0].Attempts != 1 || log[0].DeliveredAt == nil || log[0].NextAttemptAt != nil {
+				t.Errorf("webhooks.ListDeliveries() = %+v, %v, want the delivered delivery", log, err)
+			}
+			for i, want := range []bool{false, true, false} {
+				if disabled, err := webhooks.AddFailure(webhook.ID, 2); err != nil || disabled != want {
+					t.Errorf("webhooks.AddFailure() #%d = %v, %v, want %v", i+1, disabled, err, want)
+				}
+			}
+			if enabled, err := webhooks.ListEnabled(); err != nil || len(enabled) != 0 {
+				t.Errorf("webhooks.ListEnabled() after failures = %+v, %v, want none", enabled, err)
+			}
+			if purged, err := webhooks.PurgeDeliveries(time.Now().Add(time.Minute)); err != nil || purged != 1 {
+				t.Errorf("webhooks.PurgeDeliveries() = %d, %v, want 1", purged, err)
+			}
+			if err := webhooks.Delete(user.ID, webhook.ID); err != nil {
+				t.Errorf("webhooks.Delete() error = %v", err)
+			}
+
+			emails := NewEmailRepository(db)
+			email := &model.QueuedEmail{To: "alice@example.com", Message: []byte("Subject: Hi\r\n\r\nHello"), NextAttemptAt: time.Now()}
+			if err := emails.Enqueue(email); err != nil || email.ID == 0 {
+				t.Fatalf("emails.Enqueue() id = %d, error = %v", email.ID, err)
+			}
+			if due, err := emails.ListDue(time.Now().Add(time.Second), 10); err != nil || len(due) != 1 || string(due[0].Message) != string(email.Message) || due[0].To != email.To {
+				t.Fatalf("emails.ListDue() = %+v, %v, want the queued message", due, err)
+			}
+			if ok, err := emails.Claim(email.ID, 0, time.Now().Add(time.Minute)); err != nil || !ok {
+				t.Fatalf("emails.Claim() = %v, %v, want true", ok, err)
+			}
+			if ok, err := emails.Claim(email.ID, 0, time.Now().Add(time.Minute)); err != nil || ok {
+				t.Errorf("emails.Claim() again = %v, %v, want false", ok, err)
+			}
+			if err := emails.Retry(email.ID, time.Now().Add(-time.Second)); err != nil {
+				t.Fatalf("emails.Retry() error = %v", err)
+			}
+			if due, err := emails.ListDue(time.Now(), 10); err != nil || len(due) != 1 || due[0].Attempts != 1 {
+				t.Errorf("emails.ListDue() after Retry() = %+v, %v, want the message after 1 attempt", due, err)
+			}
+			if err := emails.Delete(email.ID); err != nil {
+				t.Fatalf("emails.Delete() error = %v", err)
+			}
+			if due, err := emails.ListDue(time.Now().Add(time.Hour), 10); err != nil || len(due) != 0 {
+				t.Errorf("emails.ListDue() after Delete() = %+v, %v, want none", due, err)
+			}
+
+			records := NewRecordRepository(db)
+			for _, r := range []model.Record{
+				{Date: day("2024-01-15"), Content: "5k", Duration: 30},
+				{Date: day("2024-01-16"), Content: "10k", Duration: 60, Notes: "long"},
+				{Date: day("2024-01-17"), Content: "5k", Duration: 25},
+			} {
+				r.UserID, r.HabitID = user.ID, habit.ID
+				if err := records.Create(actor, &r); err != nil || r.ID == 0 {
+					t.Fatalf("records.Create() id = %d, error = %v", r.ID, err)
+				}
+			}
+
+			filter := &model.RecordFilter{Content: "5K", Sort: "duration", Order: "asc", Limit: 1}
+			page, err := records.List(user.ID, filter)
+			if err != nil || len(page) != 1 || page[0].Duration != 25 {
+				t.Fatalf("records.List() = %+v, %v, want the 25 minute record", page, err)
+			}
+			filter.Cursor = &model.RecordCursor{Sort: "duration", Value: page[0].Duration, ID: page[0].ID}
+			page, err = records.List(user.ID, filter)
+			if err != nil || len(page) != 1 || page[0].Duration != 30 {
+				t.Fatalf("records.List() second page = %+v, %v, want the 30 minute record", page, err)
+			}
+			if count, err := records.Count(user.ID, filter); err != nil || count != 2 {
+				t.Errorf("records.Count() = %d, %v, want 2", count, err)
+			}
+
+			err = records.Import(actor, []model.ImportedRecord{
+				{Record: model.Record{Date: day("2024-01-18"), Content: "Reading", Duration: 15}, HabitName: "Reading"},
+				{Record: model.Record{Date: day("2024-01-18"), Content: "5k", Duration: 20}, HabitName: "RUNNING"},
+			})
+			if err != nil {
+				t.Fatalf("records.Import() error = %v", err)
+			}
+			all, err := habits.GetAll(user.ID, true)
+			if err != nil || len(all) != 2 {
+				t.Errorf("habits after import = %+v, %v, want Running and Reading", all, err)
+			}
+
+			backups := NewBackupRepository(db)
+			importedGoal := model.ImportedGoal{
+				Goal:      model.Goal{Metric: model.GoalCount, Period: model.GoalWeekly, Target: 3, StartDate: day("2024-01-01")},
+				HabitName: "Running",
+			}
+			fired := day("2024-01-18")
+			importedReminder := model.ImportedReminder{
+				Reminder:  model.Reminder{Time: "07:30", Weekdays: []string{"monday"}, Channel: "log", Enabled: true, LastFiredOn: &fired},
+				HabitName: "Running",
+			}
+			restored := []model.ImportedRecord{
+				{Record: model.Record{Date: day("2024-01-15"), Content: "5k", Duration: 30}, HabitName: "Running"},
+				{Record: model.Record{Date: day("2024-01-19"), Content: "5k", Duration: 30}, HabitName: "Running"},
+			}
+			result, err := backups.Restore(actor, nil, restored, []model.ImportedGoal{importedGoal}, []model.ImportedReminder{importedReminder}, false)
+			if err != nil || result.Records != 1 || result.Goals != 1 || result.Reminders != 1 || result.Skipped != 1 {
+				t.Errorf("Restore() = %+v, %v, want 1 record, 1 goal and 1 reminder added and 1 skipped", result, err)
+			}
+			if restored[0].Record.ID != 0 || restored[1].Record.ID == 0 || len(result.Replaced) != 0 {
+				t.Errorf("Restore() gave ids %d and %d and replaced %d records, want only the written record to have an id",
+					restored[0].Record.ID, restored[1].Record.ID, len(result.Replaced))
+			}
+			result, err = backups.Restore(actor, nil, nil, []model.ImportedGoal{importedGoal}, []model.ImportedReminder{importedReminder}, false)
+			if err != nil || result.Goals != 0 || result.Reminders != 0 || result.Skipped != 2 {
+				t.Errorf("Restore() of a stored goal and reminder = %+v, %v, want them skipped", result, err)
+			}
+			if stored, err := NewReminderRepository(db).GetAll(user.ID); err != nil || len(stored) != 1 || stored[0].LastFiredOn == nil || *stored[0].LastFiredOn != fired {
+				t.Errorf("reminders after restore = %+v, %v, want the reminder with its last fired day", stored, err)
+			}
+
+			stats, err := records.GetStats(user.ID, "2024-01-17", "2024-01-01")
+			if err != nil || stats.TotalRecords != 6 || stats.TotalDuration != 180 || stats.ThisWeek != 4 || stats.ThisMonth != 6 {
+				t.Errorf("records.GetStats() = %+v, %v, want 6 records and 180 minutes, 4 this week", stats, err)
+			}
+
+			totals, err := records.GetDailyTotals(user.ID, &model.RecordFilter{From: "2024-01-17", To: "2024-01-18"})
+			if want := []model.DayTotal{{Date: day("2024-01-17"), Count: 1, Duration: 25}, {Date: day("2024-01-18"), Count: 2, Duration: 35}}; err != nil || !reflect.DeepEqual(totals, want) {
+				t.Errorf("records.GetDailyTotals() = %+v, %v, want %+v", totals, err, want)
+			}
+
+			series, err := records.GetSeries(user.ID, &model.RecordFilter{}, "week", time.Sunday, true)
+			wantSeries := []model.SeriesTotal{
+				{Bucket: day("2024-01-14"), Key: "10k", Count: 1, Duration: 60},
+				{Bucket: day("2024-01-14"), Key: "5k", Count: 4, Duration: 105},
+				{Bucket: day("2024-01-14"), Key: "Reading", Count: 1, Duration: 15},
+			}
+			if err == nil {
+				sort.Slice(series, func(i, j int) bool { return series[i].Key < series[j].Key })
+			}
+			if err != nil || !reflect.DeepEqual(series, wantSeries) {
+				t.Errorf("records.GetSeries() = %+v, %v, want %+v", series, err, wantSeries)
+			}
+
+			stale := page[0]
+			current := page[0]
+			current.Notes = "edited"
+			if err := records.Update(actor, &current); err != nil || current.Version != stale.Version+1 {
+				t.Errorf("records.Update() version = %d, %v, want %d", current.Version, err, stale.Version+1)
+			}
+			if err := records.Update(actor, &stale); !errors.Is(err, ErrStaleVersion) {
+				t.Errorf("records.Update() of a stale version error = %v, want %v", err, ErrStaleVersion)
+			}
+			if err := records.Delete(actor, stale.ID, stale.Version); !errors.Is(err, ErrStaleVersion) {
+				t.Errorf("records.Delete() of a stale version error = %v, want %v", err, ErrStaleVersion)
+			}
+			if err := records.Delete(&model.Actor{UserID: user.ID + 1}, page[0].ID, 0); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("records.Delete() by another user error = %v, want %v", err, sql.ErrNoRows)
+			}
+			if err := records.Delete(actor, current.ID, current.Version); err != nil {
+				t.Errorf("records.Delete() of the current version error = %v", err)
+			}
+
+			if found, err := records.GetByID(user.ID, current.ID); err != nil || found != nil {
+				t.Errorf("records.GetByID() of a deleted record = %+v, %v, want nothing", found, err)
+			}
+			if stats, err := records.GetStats(user.ID, "2024-01-17", "2024-01-01"); err != nil || stats.TotalRecords != 5 {
+				t.Errorf("records.GetStats() after delete = %+v, %v, want 5 records", stats, err)
+			}
+			if trash, err := records.ListTrash(user.ID); err != nil || len(trash) != 1 || trash[0].ID != current.ID || trash[0].DeletedAt == nil {
+				t.Errorf("records.ListTrash() = %+v, %v, want the deleted record", trash, err)
+			}
+			if err := records.Restore(actor, current.ID); err != nil {
+				t.Errorf("records.Restore() error = %v", err)
+			}
+			if err := records.Restore(actor, current.ID); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("records.Restore() of a live record error = %v, want %v", err, sql.ErrNoRows)
+			}
+			records.Delete(actor, current.ID, 0)
+			if purged, err := records.PurgeDeleted(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+				t.Errorf("records.PurgeDeleted() of recent trash = %d, %v, want 0", purged, err)
+			}
+			if purged, err := records.PurgeDeleted(time.Now().Add(time.Hour)); err != nil || purged != 1 {
+				t.Errorf("records.PurgeDeleted() = %d, %v, want 1", purged, err)
+			}
+
+			revisions, err := records.ListRevisions(user.ID, current.ID)
+			var actions []string
+			for _, rev := range revisions {
+				actions = append(actions, rev.Action)
+			}
+			if want := []string{"create", "update", "delete", "restore", "delete"}; err != nil || !reflect.DeepEqual(actions, want) {
+				t.Fatalf("records.ListRevisions() actions = %v, %v, want %v", actions, err, want)
+			}
+			update := revisions[1]
+			if update.RequestID != "test-request" || update.Version != 2 || update.Before.Notes != "" || update.After.Notes != "edited" || update.After.Date != day("2024-01-15") {
+				t.Errorf("records.ListRevisions() update = %+v, want notes edited at version 2", update)
+			}
+			if revisions[0].Before != nil || revisions[2].After != nil || revisions[3].After == nil {
+				t.Errorf("records.ListRevisions() = %+v, want no state before the create or after a delete", revisions)
+			}
+			if restore := revisions[3]; restore.Before == nil || restore.Before.DeletedAt == nil || restore.After.DeletedAt != nil || restore.Before.Notes != "edited" {
+				t.Errorf("records.ListRevisions() restore = %+v, want the trashed record before and the restored one after", restore)
+			}
+			if others, err := records.ListRevisions(user.ID+1, current.ID); err != nil || len(others) != 0 {
+				t.Errorf("records.ListRevisions() of another user = %+v, %v, want none", others, err)
+			}
+		})
+	}
+}
+
+func TestRecordRepository_InTx(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			user := &model.User{Username: "carol", PasswordHash: "x"}
+			if err := NewUserRepository(db).Create(user); err != nil {
+				t.Fatalf("users.Create() error = %v", err)
+			}
+			actor := &model.Actor{UserID: user.ID}
+			records := NewRecordRepository(db)
+			errFailed := errors.New("failed")
+
+			var kept, undone model.Record
+			err := records.InTx(func(tx RecordTx) error {
+				habit := &model.Habit{UserID: user.ID, Name: "Swimming"}
+				if err := tx.Habits().Create(habit); err != nil {
+					return err
+				}
+				kept = model.Record{UserID: user.ID, HabitID: habit.ID, Date: day("2024-02-01"), Content: "Swimming", Duration: 40}
+				if err := tx.Create(actor, &kept); err != nil {
+					return err
+				}
+				err := tx.Savepoint(func() error {
+					undone = model.Record{UserID: user.ID, HabitID: habit.ID, Date: day("2024-02-02"), Content: "Swimming", Duration: 50}
+					if err := tx.Create(actor, &undone); err != nil {
+						return err
+					}
+					// A failing statement aborts a Postgres transaction unless
+					// the savepoint is rolled back.
+					if _, err := tx.(*recordTx).tx.Exec(`SELECT * FROM no_such_table`); err == nil {
+						t.Error("query of a missing table succeeded")
+					}
+					return errFailed
+				})
+				if !errors.Is(err, errFailed) {
+					t.Errorf("tx.Savepoint() error = %v, want %v", err, errFailed)
+				}
+				return tx.Update(actor, &kept)
+			})
+			if err != nil {
+				t.Fatalf("records.InTx() error = %v", err)
+			}
+			if found, err := records.GetByID(user.ID, kept.ID); err != nil || found == nil || found.Version != 2 {
+				t.Errorf("records.GetByID() of the kept record = %+v, %v, want it at version 2", found, err)
+			}
+			if found, err := records.GetByID(user.ID, undone.ID); err != nil || found != nil {
+				t.Errorf("records.GetByID() of the record in the failed savepoint = %+v, %v, want nothing", found, err)
+			}
+
+			err = records.InTx(func(tx RecordTx) error {
+				if err := tx.Delete(actor, kept.ID, 0); err != nil {
+					return err
+				}
+				return errFailed
+			})
+			if !errors.Is(err, errFailed) {
+				t.Errorf("records.InTx() error = %v, want %v", err, errFailed)
+			}
+			if found, err := records.GetByID(user.ID, kept.ID); err != nil || found == nil {
+				t.Errorf("records.GetByID() after a rolled back delete = %+v, %v, want the record", found, err)
+			}
+		})
+	}
+}
+
+func TestDialect_DateBucket(t *testing.T) {
+	tests := []struct {
+		interval  string
+		weekStart time.Weekday
+		want      string
+	}{
+		{"day", time.Sunday, "2024-03-13"},
+		{"week", time.Sunday, "2024-03-10"},
+		{"week", time.Monday, "2024-03-11"},
+		{"week", time.Wednesday, "2024-03-13"},
+		{"week", time.Thursday, "2024-03-07"},
+		{"month", time.Sunday, "2024-03-01"},
+		{"year", time.Sunday, "2024-01-01"},
+	}
+
+	for name, db := range testDatabases(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.interval+"/"+tt.weekStart.String(), func(t *testing.T) {
+				var got string
+				query := `SELECT ` + db.dialect.dateBucket(tt.interval, "date", tt.weekStart) + ` FROM (SELECT '2024-03-13' AS date) d`
+				if err := db.QueryRow(query).Scan(&got); err != nil {
+					t.Fatalf("query error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("dateBucket(%s, %s) = %s, want %s", tt.interval, tt.weekStart, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func day(s string) model.Date {
+	d, err := model.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestNormalizeRecordDates(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			want := map[string]string{
+				"2024-1-5":                  "2024-01-05",
+				"2024/03/09":                "2024-03-09",
+				"2024-03-09T23:30:00+08:00": "2024-03-09",
+				"2024-01-15":                "2024-01-15",
+				"yesterday":                 "2023-06-01",
+			}
+			ids := make(map[int64]string)
+			for date := range want {
+				id, err := insert(db, `INSERT INTO records (date, content, duration, created_at) VALUES (?, 'x', 1, ?)`,
+					date, time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+				if err != nil {
+					t.Fatalf("insert error = %v", err)
+				}
+				ids[id] = date
+			}
+
+			if err := normalizeRecordDates(db); err != nil {
+				t.Fatalf("normalizeRecordDates() error = %v", err)
+			}
+			for id, date := range ids {
+				var got string
+				if err := db.QueryRow(`SELECT date FROM records WHERE id = ?`, id).Scan(&got); err != nil {
+					t.Fatalf("query error = %v", err)
+				}
+				if got != want[date] {
+					t.Errorf("date %q normalized to %q, want %q", date, got, want[date])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"habit-tracker/pkg/logger"
+)
+
+// statements holds the SQL of one migration step for each dialect.
+type statements map[string][]string
+
+type migration struct {
+	Version int
+	Name    string
+	Up      statements
+	Down    statements
+
+	// Data runs after Up's statements, for changes that need Go code.
+	Data func(q querier) error
+
+	// Probe reports whether a database created before versioned migrations
+	// already has this migration's changes. Migrations written after that
+	// have none.
+	Probe func(q querier) (bool, error)
+}
+
+// MigrationState describes one known migration and, when it has been
+// applied, when that happened.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+var ErrMigrationLocked = errors.New("another process is migrating the database")
+
+const (
+	lockWait     = time.Minute
+	lockStaleAge = 10 * time.Minute
+)
+
+// Migrate applies all pending migrations in order.
+func Migrate(db *DB) error {
+	return withMigrationLock(db, func(applied map[int]time.Time) error {
+		if latest := migrations[len(migrations)-1].Version; maxVersion(applied) > latest {
+			return fmt.Errorf("database schema version %d is newer than this build (%d)", maxVersion(applied), latest)
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := runMigration(db, m, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Rollback reverts the most recently applied migrations, at most steps of
+// them.
+func Rollback(db *DB, steps int) error {
+	return withMigrationLock(db, func(applied map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if err := runMigration(db, m, false); err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// MigrationStatus lists every known migration with the time it was applied.
+func MigrationStatus(db *DB) ([]MigrationState, error) {
+	var states []MigrationState
+	err := withMigrationLock(db, func(applied map[int]time.Time) error {
+		for _, m := range migrations {
+			state := MigrationState{Version: m.Version, Name: m.Name}
+			if at, ok := applied[m.Version]; ok {
+				state.AppliedAt = &at
+			}
+			states = append(states, state)
+		}
+		return nil
+	})
+	return states, err
+}
+
+// withMigrationLock prepares the bookkeeping tables, takes the migration lock
+// and calls fn with the applied versions.
+func withMigrationLock(db *DB, fn func(applied map[int]time.Time) error) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS schema_lock (
+			id INTEGER NOT NULL PRIMARY KEY,
+			owner VARCHAR(255) NOT NULL,
+			locked_at TIMESTAMP NOT NULL
+		)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	owner, err := acquireLock(db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := db.Exec(`DELETE FROM schema_lock WHERE id = 1 AND owner = ?`, owner); err != nil {
+			logger.Error("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		if applied, err = adoptLegacySchema(db); err != nil {
+			return err
+		}
+	}
+	return fn(applied)
+}
+
+// acquireLock takes the single row of schema_lock, waiting for another
+// holder to finish. A lock older than lockStaleAge is assumed to belong to a
+// process that died and is taken over.
+func acquireLock(db *DB) (string, error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+
+	deadline := time.Now().Add(lockWait)
+	for {
+		_, err := db.Exec(`INSERT INTO schema_lock (id, owner, locked_at) VALUES (1, ?, ?)`, owner, time.Now().UTC())
+		if err == nil {
+			return owner, nil
+		}
+
+		result, err := db.Exec(`DELETE FROM schema_lock WHERE id = 1 AND locked_at < ?`, time.Now().UTC().Add(-lockStaleAge))
+		if err != nil {
+			return "", err
+		}
+		if stale, _ := result.RowsAffected(); stale > 0 {
+			logger.Info("Took over a stale migration lock")
+			continue
+		}
+		if time.Now().After(deadline) {
+			var holder string
+			db.QueryRow(`SELECT owner FROM schema_lock WHERE id = 1`).Scan(&holder)
+			return "", fmt.Errorf("%w (held by %s)", ErrMigrationLocked, holder)
+		}
+
+		logger.Info("Waiting for migration lock...")
+		time.Sleep(time.Second)
+	}
+}
+
+func appliedMigrations(db *DB) (map[int]time.Time, error) {
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// adoptLegacySchema records the migrations already present in a database set
+// up before schema_migrations existed, so they are not applied twice.
+func adoptLegacySchema(db *DB) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+	now := time.Now().UTC()
+	for _, m := range migrations {
+		if m.Probe == nil {
+			break
+		}
+		present, err := m.Probe(db)
+		if err != nil {
+			return nil, err
+		}
+		if !present {
+			break
+		}
+		if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, now); err != nil {
+			return nil, err
+		}
+		applied[m.Version] = now
+	}
+
+	if len(applied) > 0 {
+		logger.Info("Adopted existing schema at version %d", maxVersion(applied))
+	}
+	return applied, nil
+}
+
+// runMigration applies or reverts m in a transaction. MySQL commits DDL
+// implicitly, so there a failed migration can leave partial changes behind;
+// SQLite and Postgres roll it back completely.
+func runMigration(db *DB, m migration, up bool) error {
+	steps, direction := m.Up[db.dialect.name], "up"
+	if !up {
+		steps, direction = m.Down[db.dialect.name], "down"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range steps {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migration %d_%s %s: %w", m.Version, m.Name, direction, err)
+		}
+	}
+
+	if up {
+		if m.Data != nil {
+			if err := m.Data(tx); err != nil {
+				return fmt.Errorf("migration %d_%s %s: %w", m.Version, m.Name, direction, err)
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now().UTC())
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logger.Info("Migrated %s: %d_%s", direction, m.Version, m.Name)
+	return nil
+}
+
+func maxVersion(applied map[int]time.Time) int {
+	max := 0
+	for v := range applied {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+func tableExists(q querier, table string) (bool, error) {
+	var query string
+	switch q.sqlDialect().name {
+	case mysql:
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`
+	case postgres:
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = ?`
+	default:
+		query = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	}
+
+	var count int
+	err := q.QueryRow(query, table).Scan(&count)
+	return count > 0, err
+}
+
+func columnExists(q querier, table, column string) (bool, error) {
+	var query string
+	switch q.sqlDialect().name {
+	case mysql:
+		query = `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+	case postgres:
+		query = `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?`
+	default:
+		query = `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+	}
+
+	var count int
+	err := q.QueryRow(query, table, column).Scan(&count)
+	return count > 0, err
+}
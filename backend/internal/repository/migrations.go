@@ -0,0 +1,849 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/pkg/logger"
+)
+
+// migrations is the schema history, oldest first. Never edit or renumber a
+// migration that has been released; add a new one instead.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create_records",
+		Up: statements{
+			sqlite: {`
+				CREATE TABLE records (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					date TEXT NOT NULL,
+					content TEXT NOT NULL,
+					duration INTEGER NOT NULL,
+					notes TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_date ON records(date)`,
+			},
+			mysql: {`
+				CREATE TABLE records (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					date VARCHAR(10) NOT NULL,
+					content VARCHAR(255) NOT NULL,
+					duration INT NOT NULL,
+					notes TEXT,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+					INDEX idx_date (date)
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			postgres: {`
+				CREATE TABLE records (
+					id BIGSERIAL PRIMARY KEY,
+					date VARCHAR(10) NOT NULL,
+					content VARCHAR(255) NOT NULL,
+					duration INTEGER NOT NULL,
+					notes TEXT,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_date ON records(date)`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`DROP TABLE records`},
+			mysql:    {`DROP TABLE records`},
+			postgres: {`DROP TABLE records`},
+		},
+		Probe: func(q querier) (bool, error) {
+			return tableExists(q, "records")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_habits",
+		Up: statements{
+			sqlite: {`
+				CREATE TABLE habits (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					color TEXT NOT NULL DEFAULT '',
+					icon TEXT NOT NULL DEFAULT '',
+					unit TEXT NOT NULL DEFAULT '',
+					archived INTEGER NOT NULL DEFAULT 0,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_habit_name ON habits(name)`,
+				`ALTER TABLE records ADD COLUMN habit_id INTEGER REFERENCES habits(id)`,
+				`CREATE INDEX idx_habit_id ON records(habit_id)`,
+				backfillHabitsSQL,
+				linkHabitsSQL,
+			},
+			mysql: {`
+				CREATE TABLE habits (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					name VARCHAR(100) NOT NULL,
+					color VARCHAR(20) NOT NULL DEFAULT '',
+					icon VARCHAR(50) NOT NULL DEFAULT '',
+					unit VARCHAR(20) NOT NULL DEFAULT '',
+					archived BOOLEAN NOT NULL DEFAULT FALSE,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+					INDEX idx_name (name)
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`, `
+				ALTER TABLE records ADD COLUMN habit_id BIGINT NULL,
+					ADD INDEX idx_habit_id (habit_id),
+					ADD CONSTRAINT fk_records_habit FOREIGN KEY (habit_id) REFERENCES habits(id)`,
+				backfillHabitsSQL,
+				linkHabitsSQL,
+			},
+			postgres: {`
+				CREATE TABLE habits (
+					id BIGSERIAL PRIMARY KEY,
+					name VARCHAR(100) NOT NULL,
+					color VARCHAR(20) NOT NULL DEFAULT '',
+					icon VARCHAR(50) NOT NULL DEFAULT '',
+					unit VARCHAR(20) NOT NULL DEFAULT '',
+					archived BOOLEAN NOT NULL DEFAULT FALSE,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_habit_name ON habits(name)`,
+				`ALTER TABLE records ADD COLUMN habit_id BIGINT REFERENCES habits(id)`,
+				`CREATE INDEX idx_habit_id ON records(habit_id)`,
+				backfillHabitsSQL,
+				linkHabitsSQL,
+			},
+		},
+		Down: statements{
+			sqlite: {
+				`DROP INDEX idx_habit_id`,
+				`ALTER TABLE records DROP COLUMN habit_id`,
+				`DROP TABLE habits`,
+			},
+			mysql: {
+				`ALTER TABLE records DROP FOREIGN KEY fk_records_habit`,
+				`ALTER TABLE records DROP COLUMN habit_id`,
+				`DROP TABLE habits`,
+			},
+			postgres: {
+				`ALTER TABLE records DROP COLUMN habit_id`,
+				`DROP TABLE habits`,
+			},
+		},
+		Probe: func(q querier) (bool, error) {
+			return columnExists(q, "records", "habit_id")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_users",
+		Up: statements{
+			sqlite: {`
+				CREATE TABLE users (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					username TEXT NOT NULL UNIQUE,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`ALTER TABLE records ADD COLUMN user_id INTEGER REFERENCES users(id)`,
+				`CREATE INDEX idx_user_date ON records(user_id, date)`,
+				`ALTER TABLE habits ADD COLUMN user_id INTEGER REFERENCES users(id)`,
+				`CREATE INDEX idx_habit_user ON habits(user_id)`,
+			},
+			mysql: {`
+				CREATE TABLE users (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					username VARCHAR(50) NOT NULL UNIQUE,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`, `
+				ALTER TABLE records ADD COLUMN user_id BIGINT NULL,
+					ADD INDEX idx_user_date (user_id, date),
+					ADD CONSTRAINT fk_records_user FOREIGN KEY (user_id) REFERENCES users(id)`, `
+				ALTER TABLE habits ADD COLUMN user_id BIGINT NULL,
+					ADD INDEX idx_habit_user (user_id),
+					ADD CONSTRAINT fk_habits_user FOREIGN KEY (user_id) REFERENCES users(id)`,
+			},
+			postgres: {`
+				CREATE TABLE users (
+					id BIGSERIAL PRIMARY KEY,
+					username VARCHAR(50) NOT NULL UNIQUE,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`ALTER TABLE records ADD COLUMN user_id BIGINT REFERENCES users(id)`,
+				`CREATE INDEX idx_user_date ON records(user_id, date)`,
+				`ALTER TABLE habits ADD COLUMN user_id BIGINT REFERENCES users(id)`,
+				`CREATE INDEX idx_habit_user ON habits(user_id)`,
+			},
+		},
+		Data: assignDefaultOwner,
+		Down: statements{
+			sqlite: {
+				`DROP INDEX idx_habit_user`,
+				`ALTER TABLE habits DROP COLUMN user_id`,
+				`DROP INDEX idx_user_date`,
+				`ALTER TABLE records DROP COLUMN user_id`,
+				`DROP TABLE users`,
+			},
+			mysql: {
+				`ALTER TABLE habits DROP FOREIGN KEY fk_habits_user`,
+				`ALTER TABLE habits DROP COLUMN user_id`,
+				`ALTER TABLE records DROP FOREIGN KEY fk_records_user`,
+				`ALTER TABLE records DROP COLUMN user_id`,
+				`DROP TABLE users`,
+			},
+			postgres: {
+				`ALTER TABLE habits DROP COLUMN user_id`,
+				`ALTER TABLE records DROP COLUMN user_id`,
+				`DROP TABLE users`,
+			},
+		},
+		Probe: func(q querier) (bool, error) {
+			return columnExists(q, "records", "user_id")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_sessions",
+		Up: statements{
+			sqlite: {
+				`ALTER TABLE users ADD COLUMN password_hash TEXT`, `
+				CREATE TABLE sessions (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					token_hash TEXT NOT NULL UNIQUE,
+					expires_at DATETIME NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_session_expires ON sessions(expires_at)`,
+			},
+			mysql: {
+				`ALTER TABLE users ADD COLUMN password_hash VARCHAR(100) NULL`, `
+				CREATE TABLE sessions (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					token_hash CHAR(64) NOT NULL UNIQUE,
+					expires_at DATETIME NOT NULL,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					INDEX idx_session_expires (expires_at),
+					CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			postgres: {
+				`ALTER TABLE users ADD COLUMN password_hash VARCHAR(100)`, `
+				CREATE TABLE sessions (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					token_hash CHAR(64) NOT NULL UNIQUE,
+					expires_at TIMESTAMPTZ NOT NULL,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_session_expires ON sessions(expires_at)`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`DROP TABLE sessions`, `ALTER TABLE users DROP COLUMN password_hash`},
+			mysql:    {`DROP TABLE sessions`, `ALTER TABLE users DROP COLUMN password_hash`},
+			postgres: {`DROP TABLE sessions`, `ALTER TABLE users DROP COLUMN password_hash`},
+		},
+		Probe: func(q querier) (bool, error) {
+			return tableExists(q, "sessions")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_api_keys",
+		Up: statements{
+			sqlite: {`
+				CREATE TABLE api_keys (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					name TEXT NOT NULL,
+					prefix TEXT NOT NULL,
+					key_hash TEXT NOT NULL UNIQUE,
+					scopes TEXT NOT NULL DEFAULT '',
+					last_used_at DATETIME,
+					revoked_at DATETIME,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_api_key_user ON api_keys(user_id)`,
+			},
+			mysql: {`
+				CREATE TABLE api_keys (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					name VARCHAR(100) NOT NULL,
+					prefix VARCHAR(20) NOT NULL,
+					key_hash CHAR(64) NOT NULL UNIQUE,
+					scopes VARCHAR(255) NOT NULL DEFAULT '',
+					last_used_at DATETIME NULL,
+					revoked_at DATETIME NULL,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					INDEX idx_api_key_user (user_id),
+					CONSTRAINT fk_api_keys_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			postgres: {`
+				CREATE TABLE api_keys (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					name VARCHAR(100) NOT NULL,
+					prefix VARCHAR(20) NOT NULL,
+					key_hash CHAR(64) NOT NULL UNIQUE,
+					scopes VARCHAR(255) NOT NULL DEFAULT '',
+					last_used_at TIMESTAMPTZ,
+					revoked_at TIMESTAMPTZ,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_api_key_user ON api_keys(user_id)`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`DROP TABLE api_keys`},
+			mysql:    {`DROP TABLE api_keys`},
+			postgres: {`DROP TABLE api_keys`},
+		},
+		Probe: func(q querier) (bool, error) {
+			return tableExists(q, "api_keys")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_user_settings",
+		Up: statements{
+			sqlite: {
+				`ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE users ADD COLUMN week_start TEXT NOT NULL DEFAULT ''`,
+			},
+			mysql: {
+				`ALTER TABLE users ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT '', ADD COLUMN week_start VARCHAR(10) NOT NULL DEFAULT ''`,
+			},
+			postgres: {
+				`ALTER TABLE users ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT '', ADD COLUMN week_start VARCHAR(10) NOT NULL DEFAULT ''`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`ALTER TABLE users DROP COLUMN timezone`, `ALTER TABLE users DROP COLUMN week_start`},
+			mysql:    {`ALTER TABLE users DROP COLUMN timezone, DROP COLUMN week_start`},
+			postgres: {`ALTER TABLE users DROP COLUMN timezone, DROP COLUMN week_start`},
+		},
+	},
+	{
+		Version: 7,
+		Name:    "normalize_record_dates",
+		Data:    normalizeRecordDates,
+	},
+	{
+		Version: 8,
+		Name:    "add_record_versions",
+		Up: statements{
+			sqlite:   {`ALTER TABLE records ADD COLUMN version INTEGER NOT NULL DEFAULT 1`},
+			mysql:    {`ALTER TABLE records ADD COLUMN version BIGINT NOT NULL DEFAULT 1`},
+			postgres: {`ALTER TABLE records ADD COLUMN version BIGINT NOT NULL DEFAULT 1`},
+		},
+		Down: statements{
+			sqlite:   {`ALTER TABLE records DROP COLUMN version`},
+			mysql:    {`ALTER TABLE records DROP COLUMN version`},
+			postgres: {`ALTER TABLE records DROP COLUMN version`},
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_record_deleted_at",
+		Up: statements{
+			sqlite: {
+				`ALTER TABLE records ADD COLUMN deleted_at DATETIME`,
+				`CREATE INDEX idx_records_deleted_at ON records(deleted_at)`,
+			},
+			mysql: {
+				`ALTER TABLE records ADD COLUMN deleted_at TIMESTAMP NULL, ADD INDEX idx_records_deleted_at (deleted_at)`,
+			},
+			postgres: {
+				`ALTER TABLE records ADD COLUMN deleted_at TIMESTAMPTZ`,
+				`CREATE INDEX idx_records_deleted_at ON records(deleted_at)`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`DROP INDEX idx_records_deleted_at`, `ALTER TABLE records DROP COLUMN deleted_at`},
+			mysql:    {`ALTER TABLE records DROP INDEX idx_records_deleted_at, DROP COLUMN deleted_at`},
+			postgres: {`DROP INDEX idx_records_deleted_at`, `ALTER TABLE records DROP COLUMN deleted_at`},
+		},
+	},
+	{
+		// Revisions have no foreign key to records: the history of a record
+		// outlives it when it is purged or replaced by a backup.
+		Version: 10,
+		Name:    "add_record_revisions",
+		Up: statements{
+			sqlite: {`
+				CREATE TABLE record_revisions (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					record_id INTEGER NOT NULL,
+					user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					api_key_id INTEGER,
+					request_id TEXT NOT NULL DEFAULT '',
+					action TEXT NOT NULL,
+					version INTEGER NOT NULL,
+					before_state TEXT,
+					after_state TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_record_revisions_record ON record_revisions(record_id, id)`,
+			},
+			mysql: {`
+				CREATE TABLE record_revisions (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					record_id BIGINT NOT NULL,
+					user_id BIGINT NOT NULL,
+					api_key_id BIGINT NULL,
+					request_id VARCHAR(64) NOT NULL DEFAULT '',
+					action VARCHAR(10) NOT NULL,
+					version BIGINT NOT NULL,
+					before_state TEXT,
+					after_state TEXT,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					INDEX idx_record_revisions_record (record_id, id),
+					CONSTRAINT fk_record_revisions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			postgres: {`
+				CREATE TABLE record_revisions (
+					id BIGSERIAL PRIMARY KEY,
+					record_id BIGINT NOT NULL,
+					user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					api_key_id BIGINT,
+					request_id VARCHAR(64) NOT NULL DEFAULT '',
+					action VARCHAR(10) NOT NULL,
+					version BIGINT NOT NULL,
+					before_state TEXT,
+					after_state TEXT,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_record_revisions_record ON record_revisions(record_id, id)`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`DROP TABLE record_revisions`},
+			mysql:    {`DROP TABLE record_revisions`},
+			postgres: {`DROP TABLE record_revisions`},
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_goals",
+		Up: statements{
+			sqlite: {`
+				CREATE TABLE goals (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					habit_id INTEGER NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+					metric TEXT NOT NULL,
+					period TEXT NOT NULL,
+					target INTEGER NOT NULL,
+					start_date TEXT NOT NULL,
+					end_date TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_goals_user ON goals(user_id, habit_id)`,
+			},
+			mysql: {`
+				CREATE TABLE goals (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					habit_id BIGINT NOT NULL,
+					metric VARCHAR(10) NOT NULL,
+					period VARCHAR(10) NOT NULL,
+					target INT NOT NULL,
+					start_date VARCHAR(10) NOT NULL,
+					end_date VARCHAR(10) NULL,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+					INDEX idx_goals_user (user_id, habit_id),
+					CONSTRAINT fk_goals_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+					CONSTRAINT fk_goals_habit FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			postgres: {`
+				CREATE TABLE goals (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					habit_id BIGINT NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+					metric VARCHAR(10) NOT NULL,
+					period VARCHAR(10) NOT NULL,
+					target INT NOT NULL,
+					start_date VARCHAR(10) NOT NULL,
+					end_date VARCHAR(10),
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_goals_user ON goals(user_id, habit_id)`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`DROP TABLE goals`},
+			mysql:    {`DROP TABLE goals`},
+			postgres: {`DROP TABLE goals`},
+		},
+	},
+	{
+		// Schedules are stored as JSON; NULL means every day.
+		Version: 12,
+		Name:    "add_habit_schedules",
+		Up: statements{
+			sqlite:   {`ALTER TABLE habits ADD COLUMN schedule TEXT`},
+			mysql:    {`ALTER TABLE habits ADD COLUMN schedule TEXT NULL`},
+			postgres: {`ALTER TABLE habits ADD COLUMN schedule TEXT`},
+		},
+		Down: statements{
+			sqlite:   {`ALTER TABLE habits DROP COLUMN schedule`},
+			mysql:    {`ALTER TABLE habits DROP COLUMN schedule`},
+			postgres: {`ALTER TABLE habits DROP COLUMN schedule`},
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_reminders",
+		Up: statements{
+			sqlite: {`
+				CREATE TABLE reminders (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					habit_id INTEGER NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+					remind_at TEXT NOT NULL,
+					weekdays TEXT NOT NULL DEFAULT '',
+					timezone TEXT NOT NULL DEFAULT '',
+					channel TEXT NOT NULL,
+					enabled INTEGER NOT NULL DEFAULT 1,
+					last_fired_on TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_reminders_user ON reminders(user_id, habit_id)`,
+			},
+			mysql: {`
+				CREATE TABLE reminders (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					habit_id BIGINT NOT NULL,
+					remind_at VARCHAR(5) NOT NULL,
+					weekdays VARCHAR(100) NOT NULL DEFAULT '',
+					timezone VARCHAR(64) NOT NULL DEFAULT '',
+					channel VARCHAR(20) NOT NULL,
+					enabled BOOLEAN NOT NULL DEFAULT TRUE,
+					last_fired_on VARCHAR(10) NULL,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+					INDEX idx_reminders_user (user_id, habit_id),
+					CONSTRAINT fk_reminders_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+					CONSTRAINT fk_reminders_habit FOREIGN KEY (habit_id) REFERENCES habits(id) ON DELETE CASCADE
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			postgres: {`
+				CREATE TABLE reminders (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					habit_id BIGINT NOT NULL REFERENCES habits(id) ON DELETE CASCADE,
+					remind_at VARCHAR(5) NOT NULL,
+					weekdays VARCHAR(100) NOT NULL DEFAULT '',
+					timezone VARCHAR(64) NOT NULL DEFAULT '',
+					channel VARCHAR(20) NOT NULL,
+					enabled BOOLEAN NOT NULL DEFAULT TRUE,
+					last_fired_on VARCHAR(10),
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_reminders_user ON reminders(user_id, habit_id)`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`DROP TABLE reminders`},
+			mysql:    {`DROP TABLE reminders`},
+			postgres: {`DROP TABLE reminders`},
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add_webhooks",
+		Up: statements{
+			sqlite: {`
+				CREATE TABLE webhooks (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					url TEXT NOT NULL,
+					secret TEXT NOT NULL,
+					events TEXT NOT NULL,
+					enabled INTEGER NOT NULL DEFAULT 1,
+					failures INTEGER NOT NULL DEFAULT 0,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_webhooks_user ON webhooks(user_id)`,
+				`
+				CREATE TABLE webhook_deliveries (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+					event_id TEXT NOT NULL,
+					event TEXT NOT NULL,
+					payload TEXT NOT NULL,
+					status TEXT NOT NULL,
+					attempts INTEGER NOT NULL DEFAULT 0,
+					next_attempt_at DATETIME,
+					response_status INTEGER NOT NULL DEFAULT 0,
+					error TEXT NOT NULL DEFAULT '',
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					delivered_at DATETIME,
+					UNIQUE (webhook_id, event_id)
+				)`,
+				`CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)`,
+			},
+			mysql: {`
+				CREATE TABLE webhooks (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					user_id BIGINT NOT NULL,
+					url VARCHAR(2048) NOT NULL,
+					secret VARCHAR(255) NOT NULL,
+					events VARCHAR(255) NOT NULL,
+					enabled BOOLEAN NOT NULL DEFAULT TRUE,
+					failures INT NOT NULL DEFAULT 0,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+					INDEX idx_webhooks_user (user_id),
+					CONSTRAINT fk_webhooks_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`, `
+				CREATE TABLE webhook_deliveries (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					webhook_id BIGINT NOT NULL,
+					event_id VARCHAR(100) NOT NULL,
+					event VARCHAR(50) NOT NULL,
+					payload MEDIUMTEXT NOT NULL,
+					status VARCHAR(20) NOT NULL,
+					attempts INT NOT NULL DEFAULT 0,
+					next_attempt_at DATETIME NULL,
+					response_status INT NOT NULL DEFAULT 0,
+					error VARCHAR(500) NOT NULL DEFAULT '',
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					delivered_at DATETIME NULL,
+					UNIQUE KEY uq_webhook_deliveries_event (webhook_id, event_id),
+					INDEX idx_webhook_deliveries_due (status, next_attempt_at),
+					CONSTRAINT fk_webhook_deliveries_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			postgres: {`
+				CREATE TABLE webhooks (
+					id BIGSERIAL PRIMARY KEY,
+					user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					url VARCHAR(2048) NOT NULL,
+					secret VARCHAR(255) NOT NULL,
+					events VARCHAR(255) NOT NULL,
+					enabled BOOLEAN NOT NULL DEFAULT TRUE,
+					failures INTEGER NOT NULL DEFAULT 0,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_webhooks_user ON webhooks(user_id)`,
+				`
+				CREATE TABLE webhook_deliveries (
+					id BIGSERIAL PRIMARY KEY,
+					webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+					event_id VARCHAR(100) NOT NULL,
+					event VARCHAR(50) NOT NULL,
+					payload TEXT NOT NULL,
+					status VARCHAR(20) NOT NULL,
+					attempts INTEGER NOT NULL DEFAULT 0,
+					next_attempt_at TIMESTAMPTZ,
+					response_status INTEGER NOT NULL DEFAULT 0,
+					error VARCHAR(500) NOT NULL DEFAULT '',
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+					delivered_at TIMESTAMPTZ,
+					UNIQUE (webhook_id, event_id)
+				)`,
+				`CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at)`,
+			},
+		},
+		Down: statements{
+			sqlite:   {`DROP TABLE webhook_deliveries`, `DROP TABLE webhooks`},
+			mysql:    {`DROP TABLE webhook_deliveries`, `DROP TABLE webhooks`},
+			postgres: {`DROP TABLE webhook_deliveries`, `DROP TABLE webhooks`},
+		},
+	},
+	{
+		Version: 15,
+		Name:    "add_email_notifications",
+		Up: statements{
+			sqlite: {
+				`ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT ''`,
+				`ALTER TABLE users ADD COLUMN weekly_summary INTEGER NOT NULL DEFAULT 0`,
+				`ALTER TABLE users ADD COLUMN summary_sent_on TEXT`,
+				`
+				CREATE TABLE email_queue (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					recipient TEXT NOT NULL,
+					message TEXT NOT NULL,
+					attempts INTEGER NOT NULL DEFAULT 0,
+					next_attempt_at DATETIME NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_email_queue_due ON email_queue(next_attempt_at)`,
+			},
+			mysql: {
+				`ALTER TABLE users ADD COLUMN email VARCHAR(254) NOT NULL DEFAULT ''`,
+				`ALTER TABLE users ADD COLUMN weekly_summary BOOLEAN NOT NULL DEFAULT FALSE`,
+				`ALTER TABLE users ADD COLUMN summary_sent_on VARCHAR(10) NULL`,
+				`
+				CREATE TABLE email_queue (
+					id BIGINT AUTO_INCREMENT PRIMARY KEY,
+					recipient VARCHAR(254) NOT NULL,
+					message MEDIUMTEXT NOT NULL,
+					attempts INT NOT NULL DEFAULT 0,
+					next_attempt_at DATETIME NOT NULL,
+					created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+					INDEX idx_email_queue_due (next_attempt_at)
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			postgres: {
+				`ALTER TABLE users ADD COLUMN email VARCHAR(254) NOT NULL DEFAULT ''`,
+				`ALTER TABLE users ADD COLUMN weekly_summary BOOLEAN NOT NULL DEFAULT FALSE`,
+				`ALTER TABLE users ADD COLUMN summary_sent_on VARCHAR(10)`,
+				`
+				CREATE TABLE email_queue (
+					id BIGSERIAL PRIMARY KEY,
+					recipient VARCHAR(254) NOT NULL,
+					message TEXT NOT NULL,
+					attempts INTEGER NOT NULL DEFAULT 0,
+					next_attempt_at TIMESTAMPTZ NOT NULL,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE INDEX idx_email_queue_due ON email_queue(next_attempt_at)`,
+			},
+		},
+		Down: statements{
+			sqlite: {
+				`DROP TABLE email_queue`,
+				`ALTER TABLE users DROP COLUMN summary_sent_on`,
+				`ALTER TABLE users DROP COLUMN weekly_summary`,
+				`ALTER TABLE users DROP COLUMN email`,
+			},
+			mysql: {
+				`DROP TABLE email_queue`,
+				`ALTER TABLE users DROP COLUMN summary_sent_on`,
+				`ALTER TABLE users DROP COLUMN weekly_summary`,
+				`ALTER TABLE users DROP COLUMN email`,
+			},
+			postgres: {
+				`DROP TABLE email_queue`,
+				`ALTER TABLE users DROP COLUMN summary_sent_on`,
+				`ALTER TABLE users DROP COLUMN weekly_summary`,
+				`ALTER TABLE users DROP COLUMN email`,
+			},
+		},
+	},
+}
+
+// backfillHabitsSQL creates one habit per distinct record content, ignoring
+// case and surrounding whitespace, for records written before habits existed.
+const backfillHabitsSQL = `
+	INSERT INTO habits (name, created_at, updated_at)
+	SELECT MIN(TRIM(content)), MIN(created_at), MIN(created_at) FROM records
+	WHERE habit_id IS NULL AND TRIM(content) <> ''
+	GROUP BY LOWER(TRIM(content))`
+
+const linkHabitsSQL = `
+	UPDATE records SET habit_id = (
+		SELECT MIN(h.id) FROM habits h WHERE LOWER(h.name) = LOWER(TRIM(records.content))
+	)
+	WHERE habit_id IS NULL AND TRIM(content) <> ''`
+
+// DefaultUsername owns the data written before records had owners.
+const DefaultUsername = "default"
+
+// assignDefaultOwner hands records and habits without an owner to the
+// default user, creating that user when needed.
+func assignDefaultOwner(q querier) error {
+	var unowned int
+	err := q.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM records WHERE user_id IS NULL) +
+			(SELECT COUNT(*) FROM habits WHERE user_id IS NULL)`).Scan(&unowned)
+	if err != nil {
+		return err
+	}
+	if unowned == 0 {
+		return nil
+	}
+
+	ownerID, err := insert(q, `INSERT INTO users (username) VALUES (?)`, DefaultUsername)
+	if err != nil {
+		return fmt.Errorf("failed to create default user: %w", err)
+	}
+
+	for _, table := range []string{"records", "habits"} {
+		if _, err := q.Exec(`UPDATE `+table+` SET user_id = ? WHERE user_id IS NULL`, ownerID); err != nil {
+			return fmt.Errorf("failed to assign %s to default user: %w", table, err)
+		}
+	}
+
+	logger.Info("Assigned %d unowned rows to user %q", unowned, DefaultUsername)
+	return nil
+}
+
+// lenientDateLayouts are the forms older clients wrote dates in before they
+// were validated.
+var lenientDateLayouts = []string{"2006-1-2", "2006/1/2", "2006.1.2", time.RFC3339, "2006-01-02 15:04:05"}
+
+// normalizeRecordDates rewrites record dates that are not YYYY-MM-DD, which
+// older versions accepted without checking. A date that cannot be read in
+// any known form is replaced by the day the record was created.
+func normalizeRecordDates(q querier) error {
+	rows, err := q.Query(`SELECT id, date, created_at FROM records`)
+	if err != nil {
+		return err
+	}
+	fixed := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var date string
+		var createdAt sql.NullString
+		if err := rows.Scan(&id, &date, &createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, err := model.ParseDate(date); err == nil {
+			continue
+		}
+		fixed[id] = repairDate(date, createdAt.String)
+		logger.Info("Record %d: rewrote date %q as %s", id, date, fixed[id])
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, date := range fixed {
+		if _, err := q.Exec(`UPDATE records SET date = ? WHERE id = ?`, date, id); err != nil {
+			return fmt.Errorf("failed to fix date of record %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func repairDate(date, createdAt string) string {
+	date = strings.TrimSpace(date)
+	for _, layout := range lenientDateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return model.DateOf(t).String()
+		}
+	}
+	if len(createdAt) >= len(model.DateLayout) {
+		if d, err := model.ParseDate(createdAt[:len(model.DateLayout)]); err == nil {
+			return d.String()
+		}
+	}
+	return model.DateOf(time.Now()).String()
+}
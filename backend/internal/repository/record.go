@@ -2,121 +2,352 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	"habit-tracker/internal/config"
 	"habit-tracker/internal/model"
-	"habit-tracker/pkg/logger"
-
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// ErrStaleVersion means a record was changed since the version a write was
+// based on.
+var ErrStaleVersion = errors.New("record version is stale")
+
+// RecordWriter is the part of RecordRepository that single-record writes
+// need, which a RecordTx provides as well.
+type RecordWriter interface {
+	Create(actor *model.Actor, record *model.Record) error
+	GetByID(userID, id int64) (*model.Record, error)
+	Update(actor *model.Actor, record *model.Record) error
+	Delete(actor *model.Actor, id, version int64) error
+}
+
+// RecordTx writes records inside a transaction begun by
+// RecordRepository.InTx. Its writes keep the record history like those of
+// the repository.
+type RecordTx interface {
+	RecordWriter
+	// Habits returns the habits as seen by the transaction, so that habits
+	// created along the way are rolled back with it.
+	Habits() HabitRepository
+	// Savepoint runs fn so that, when fn fails, only the writes fn made are
+	// undone and the transaction can go on.
+	Savepoint(fn func() error) error
+}
+
 type RecordRepository interface {
-	Create(record *model.Record) error
-	GetByID(id int64) (*model.Record, error)
-	GetAll() ([]model.Record, error)
-	Update(record *model.Record) error
-	Delete(id int64) error
-	GetStats() (*model.Stats, error)
+	// Create, Import, Update, Delete and Restore append a revision to the
+	// history of each record they write, made by actor, in the same
+	// transaction as the write.
+	Create(actor *model.Actor, record *model.Record) error
+	GetByID(userID, id int64) (*model.Record, error)
+	List(userID int64, filter *model.RecordFilter) ([]model.Record, error)
+	Stream(userID int64, filter *model.RecordFilter, fn func(*model.Record) error) error
+	Import(actor *model.Actor, rows []model.ImportedRecord) error
+	Count(userID int64, filter *model.RecordFilter) (int, error)
+	Update(actor *model.Actor, record *model.Record) error
+	// Delete moves a record to the trash, where ListTrash finds it until
+	// Restore takes it back out or PurgeDeleted removes it for good. Every
+	// other method ignores records in the trash.
+	Delete(actor *model.Actor, id, version int64) error
+	ListTrash(userID int64) ([]model.Record, error)
+	Restore(actor *model.Actor, id int64) error
+	// PurgeDeleted leaves no revision behind: the history of a purged record
+	// ends with its deletion.
+	PurgeDeleted(before time.Time) (int64, error)
+	ListRevisions(userID, recordID int64) ([]model.RecordRevision, error)
+	// InTx runs fn in a transaction, which is committed when fn returns nil
+	// and rolled back otherwise.
+	InTx(fn func(tx RecordTx) error) error
+	GetStats(userID int64, weekStart, monthStart string) (*model.Stats, error)
+	GetActivityDates(userID int64) ([]model.ActivityDate, error)
+	GetDailyTotals(userID int64, filter *model.RecordFilter) ([]model.DayTotal, error)
+	GetSeries(userID int64, filter *model.RecordFilter, interval string, weekStart time.Weekday, groupByContent bool) ([]model.SeriesTotal, error)
 }
 
 type recordRepository struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewRecordRepository(cfg *config.DatabaseConfig) (RecordRepository, error) {
-	db, err := sql.Open(cfg.Driver, cfg.DSN)
+func NewRecordRepository(db *DB) RecordRepository {
+	return &recordRepository{db: db}
+}
+
+func (r *recordRepository) Create(actor *model.Actor, record *model.Record) error {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return err
 	}
+	defer tx.Rollback()
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	if err := insertRecord(tx, actor, record); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
-	repo := &recordRepository{db: db}
-	if err := repo.migrate(cfg.Driver); err != nil {
-		return nil, fmt.Errorf("failed to migrate: %w", err)
+// insertRecord writes a new record and the revision that creates it. q
+// should be a transaction.
+func insertRecord(q querier, actor *model.Actor, record *model.Record) error {
+	stamp(&record.CreatedAt, &record.UpdatedAt)
+	record.Version = 1
+	id, err := insert(q,
+		`INSERT INTO records (user_id, habit_id, date, content, duration, notes, version, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.UserID, nullableID(record.HabitID), record.Date, record.Content, record.Duration, record.Notes, record.Version, record.CreatedAt, record.UpdatedAt,
+	)
+	if err != nil {
+		return err
 	}
 
-	logger.Info("Database connected: %s", cfg.Driver)
-	return repo, nil
+	record.ID = id
+	return insertRevision(q, actor, model.RevisionCreate, record.ID, record.Version, nil, model.SnapshotOf(record))
+}
+
+func (r *recordRepository) GetByID(userID, id int64) (*model.Record, error) {
+	return selectRecord(r.db, userID, id, false)
 }
 
-func (r *recordRepository) migrate(driver string) error {
-	var schema string
-	if driver == "mysql" {
-		schema = `
-		CREATE TABLE IF NOT EXISTS records (
-			id BIGINT AUTO_INCREMENT PRIMARY KEY,
-			date VARCHAR(10) NOT NULL,
-			content VARCHAR(255) NOT NULL,
-			duration INT NOT NULL,
-			notes TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-			INDEX idx_date (date)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
-	} else {
-		schema = `
-		CREATE TABLE IF NOT EXISTS records (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			date TEXT NOT NULL,
-			content TEXT NOT NULL,
-			duration INTEGER NOT NULL,
-			notes TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE INDEX IF NOT EXISTS idx_date ON records(date);`
+// selectRecord returns one of the user's records, either a live one or, when
+// trashed is set, one in the trash. It returns nil when there is none.
+func selectRecord(q querier, userID, id int64, trashed bool) (*model.Record, error) {
+	deleted := "deleted_at IS NULL"
+	if trashed {
+		deleted = "deleted_at IS NOT NULL"
 	}
 
-	_, err := r.db.Exec(schema)
-	return err
+	record := &model.Record{}
+	var deletedAt sql.NullTime
+	err := q.QueryRow(
+		`SELECT id, user_id, COALESCE(habit_id, 0), date, content, duration, notes, version, created_at, updated_at, deleted_at FROM records WHERE id = ? AND user_id = ? AND `+deleted,
+		id, userID,
+	).Scan(&record.ID, &record.UserID, &record.HabitID, &record.Date, &record.Content, &record.Duration, &record.Notes, &record.Version, &record.CreatedAt, &record.UpdatedAt, &deletedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		record.DeletedAt = &deletedAt.Time
+	}
+	return record, nil
 }
 
-func (r *recordRepository) Create(record *model.Record) error {
-	now := time.Now()
-	result, err := r.db.Exec(
-		`INSERT INTO records (date, content, duration, notes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		record.Date, record.Content, record.Duration, record.Notes, now, now,
-	)
+// recordSortColumns maps the sort keys accepted in a RecordFilter to columns.
+var recordSortColumns = map[string]string{
+	"date":     "date",
+	"duration": "duration",
+	"content":  "content",
+}
+
+func (r *recordRepository) List(userID int64, filter *model.RecordFilter) ([]model.Record, error) {
+	var records []model.Record
+	err := r.Stream(userID, filter, func(record *model.Record) error {
+		records = append(records, *record)
+		return nil
+	})
+	return records, err
+}
+
+// Stream calls fn for each record matching filter, in filter order, without
+// holding the whole result in memory. An error from fn stops the iteration
+// and is returned.
+func (r *recordRepository) Stream(userID int64, filter *model.RecordFilter, fn func(*model.Record) error) error {
+	where, args := recordWhere(userID, filter, true)
+
+	column := recordSortColumns[filter.Sort]
+	if column == "" {
+		column = "date"
+	}
+	direction := "DESC"
+	if filter.Order == "asc" {
+		direction = "ASC"
+	}
+
+	query := `SELECT id, user_id, COALESCE(habit_id, 0), date, content, duration, notes, version, created_at, updated_at FROM records` +
+		where + fmt.Sprintf(` ORDER BY %s %s, id %s`, column, direction, direction)
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record model.Record
+		if err := rows.Scan(&record.ID, &record.UserID, &record.HabitID, &record.Date, &record.Content, &record.Duration, &record.Notes, &record.Version, &record.CreatedAt, &record.UpdatedAt); err != nil {
+			return err
+		}
+		if err := fn(&record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
 
-	id, err := result.LastInsertId()
+// Import writes rows in a single transaction, looking up or creating the
+// habit of each row by name. Nothing is written if any row fails.
+func (r *recordRepository) Import(actor *model.Actor, rows []model.ImportedRecord) error {
+	userID := actor.UserID
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	record.ID = id
-	record.CreatedAt = now
-	record.UpdatedAt = now
-	return nil
+	habits := newHabitResolver(tx, userID)
+	for i := range rows {
+		record := &rows[i].Record
+		record.UserID = userID
+
+		id, err := habits.resolve(&model.Habit{Name: rows[i].HabitName})
+		if err != nil {
+			return err
+		}
+		record.HabitID = id
+
+		if err := insertRecord(tx, actor, record); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (r *recordRepository) GetByID(id int64) (*model.Record, error) {
-	record := &model.Record{}
-	err := r.db.QueryRow(
-		`SELECT id, date, content, duration, notes, created_at, updated_at FROM records WHERE id = ?`,
-		id,
-	).Scan(&record.ID, &record.Date, &record.Content, &record.Duration, &record.Notes, &record.CreatedAt, &record.UpdatedAt)
+// Count returns how many records match filter, ignoring its cursor and limit.
+func (r *recordRepository) Count(userID int64, filter *model.RecordFilter) (int, error) {
+	where, args := recordWhere(userID, filter, false)
 
-	if err == sql.ErrNoRows {
-		return nil, nil
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM records`+where, args...).Scan(&count)
+	return count, err
+}
+
+func recordWhere(userID int64, filter *model.RecordFilter, withCursor bool) (string, []interface{}) {
+	conds := []string{"user_id = ?", "deleted_at IS NULL"}
+	args := []interface{}{userID}
+
+	if filter.From != "" {
+		conds = append(conds, "date >= ?")
+		args = append(args, filter.From)
 	}
+	if filter.To != "" {
+		conds = append(conds, "date <= ?")
+		args = append(args, filter.To)
+	}
+	if filter.HabitID != 0 {
+		conds = append(conds, "habit_id = ?")
+		args = append(args, filter.HabitID)
+	}
+	if filter.Content != "" {
+		conds = append(conds, "LOWER(content) LIKE ? ESCAPE '!'")
+		args = append(args, "%"+likeEscaper.Replace(strings.ToLower(filter.Content))+"%")
+	}
+	if filter.MinDuration > 0 {
+		conds = append(conds, "duration >= ?")
+		args = append(args, filter.MinDuration)
+	}
+	if filter.MaxDuration > 0 {
+		conds = append(conds, "duration <= ?")
+		args = append(args, filter.MaxDuration)
+	}
+
+	if withCursor && filter.Cursor != nil {
+		column := recordSortColumns[filter.Cursor.Sort]
+		op := "<"
+		if filter.Order == "asc" {
+			op = ">"
+		}
+		conds = append(conds, fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, op, column, op))
+		args = append(args, filter.Cursor.Value, filter.Cursor.Value, filter.Cursor.ID)
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Update writes record if it is still at record.Version, and moves it to the
+// next version.
+func (r *recordRepository) Update(actor *model.Actor, record *model.Record) error {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return record, nil
+	defer tx.Rollback()
+
+	if err := updateRecord(tx, actor, record); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func updateRecord(q querier, actor *model.Actor, record *model.Record) error {
+	before, err := baseRecord(q, record.UserID, record.ID, record.Version)
+	if err != nil {
+		return err
+	}
+
+	updatedAt := time.Now()
+	result, err := q.Exec(
+		`UPDATE records SET habit_id = ?, date = ?, content = ?, duration = ?, notes = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND user_id = ? AND version = ? AND deleted_at IS NULL`,
+		nullableID(record.HabitID), record.Date, record.Content, record.Duration, record.Notes, updatedAt, record.ID, record.UserID, before.Version,
+	)
+	if err := checkWritten(result, err); err != nil {
+		return err
+	}
+
+	record.Version = before.Version + 1
+	record.UpdatedAt = updatedAt
+	return insertRevision(q, actor, model.RevisionUpdate, record.ID, record.Version, model.SnapshotOf(before), model.SnapshotOf(record))
+}
+
+// Delete moves a record to the trash. A version other than 0 must match the
+// stored one.
+func (r *recordRepository) Delete(actor *model.Actor, id, version int64) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteRecord(tx, actor, id, version); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *recordRepository) GetAll() ([]model.Record, error) {
+func deleteRecord(q querier, actor *model.Actor, id, version int64) error {
+	before, err := baseRecord(q, actor.UserID, id, version)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result, err := q.Exec(
+		`UPDATE records SET deleted_at = ?, updated_at = ?, version = version + 1 WHERE id = ? AND user_id = ? AND version = ? AND deleted_at IS NULL`,
+		now.UTC(), now, id, actor.UserID, before.Version,
+	)
+	if err := checkWritten(result, err); err != nil {
+		return err
+	}
+
+	return insertRevision(q, actor, model.RevisionDelete, id, before.Version+1, model.SnapshotOf(before), nil)
+}
+
+// ListTrash returns the user's deleted records, most recently deleted first.
+func (r *recordRepository) ListTrash(userID int64) ([]model.Record, error) {
 	rows, err := r.db.Query(
-		`SELECT id, date, content, duration, notes, created_at, updated_at FROM records ORDER BY date DESC, id DESC`,
+		`SELECT id, user_id, COALESCE(habit_id, 0), date, content, duration, notes, version, created_at, updated_at, deleted_at FROM records
+		WHERE user_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC`,
+		userID,
 	)
 	if err != nil {
 		return nil, err
@@ -126,73 +357,158 @@ func (r *recordRepository) GetAll() ([]model.Record, error) {
 	var records []model.Record
 	for rows.Next() {
 		var record model.Record
-		if err := rows.Scan(&record.ID, &record.Date, &record.Content, &record.Duration, &record.Notes, &record.CreatedAt, &record.UpdatedAt); err != nil {
+		var deletedAt sql.NullTime
+		if err := rows.Scan(&record.ID, &record.UserID, &record.HabitID, &record.Date, &record.Content, &record.Duration, &record.Notes, &record.Version, &record.CreatedAt, &record.UpdatedAt, &deletedAt); err != nil {
 			return nil, err
 		}
+		record.DeletedAt = &deletedAt.Time
 		records = append(records, record)
 	}
 	return records, rows.Err()
 }
 
-func (r *recordRepository) Update(record *model.Record) error {
-	record.UpdatedAt = time.Now()
-	result, err := r.db.Exec(
-		`UPDATE records SET date = ?, content = ?, duration = ?, notes = ?, updated_at = ? WHERE id = ?`,
-		record.Date, record.Content, record.Duration, record.Notes, record.UpdatedAt, record.ID,
-	)
+// Restore takes a record back out of the trash. It returns sql.ErrNoRows
+// when the record is not in the trash.
+func (r *recordRepository) Restore(actor *model.Actor, id int64) error {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	affected, err := result.RowsAffected()
+	record, err := selectRecord(tx, actor.UserID, id, true)
 	if err != nil {
 		return err
 	}
-	if affected == 0 {
+	if record == nil {
 		return sql.ErrNoRows
 	}
-	return nil
+
+	result, err := tx.Exec(
+		`UPDATE records SET deleted_at = NULL, updated_at = ?, version = version + 1 WHERE id = ? AND user_id = ? AND version = ? AND deleted_at IS NOT NULL`,
+		time.Now(), id, actor.UserID, record.Version,
+	)
+	if err := checkWritten(result, err); err != nil {
+		return err
+	}
+
+	// The revision goes from the record as it was in the trash to the record
+	// back out of it.
+	restored := *record
+	restored.DeletedAt = nil
+	if err := insertRevision(tx, actor, model.RevisionRestore, id, record.Version+1, model.SnapshotOf(record), model.SnapshotOf(&restored)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *recordRepository) Delete(id int64) error {
-	result, err := r.db.Exec(`DELETE FROM records WHERE id = ?`, id)
+// PurgeDeleted permanently removes every user's records that were moved to
+// the trash before the given time, returning how many were removed.
+func (r *recordRepository) PurgeDeleted(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM records WHERE deleted_at IS NOT NULL AND deleted_at < ?`, before.UTC())
 	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *recordRepository) InTx(fn func(tx RecordTx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&recordTx{tx: tx}); err != nil {
 		return err
 	}
+	return tx.Commit()
+}
+
+type recordTx struct {
+	tx         *Tx
+	savepoints int
+}
+
+func (t *recordTx) Create(actor *model.Actor, record *model.Record) error {
+	return insertRecord(t.tx, actor, record)
+}
+
+func (t *recordTx) GetByID(userID, id int64) (*model.Record, error) {
+	return selectRecord(t.tx, userID, id, false)
+}
+
+func (t *recordTx) Update(actor *model.Actor, record *model.Record) error {
+	return updateRecord(t.tx, actor, record)
+}
+
+func (t *recordTx) Delete(actor *model.Actor, id, version int64) error {
+	return deleteRecord(t.tx, actor, id, version)
+}
+
+func (t *recordTx) Habits() HabitRepository {
+	return &habitRepository{db: t.tx}
+}
+
+func (t *recordTx) Savepoint(fn func() error) error {
+	t.savepoints++
+	return t.tx.savepoint(fmt.Sprintf("sp_%d", t.savepoints), fn)
+}
+
+// baseRecord reads the live record a write inside tx is based on. It
+// returns sql.ErrNoRows when there is none, and ErrStaleVersion when version
+// is not 0 and the record has moved past it.
+func baseRecord(q querier, userID, id, version int64) (*model.Record, error) {
+	record, err := selectRecord(q, userID, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, sql.ErrNoRows
+	}
+	if version != 0 && record.Version != version {
+		return nil, ErrStaleVersion
+	}
+	return record, nil
+}
 
+// checkWritten reports a guarded write that matched no row because another
+// write changed the record after it was read.
+func checkWritten(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
 	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 	if affected == 0 {
-		return sql.ErrNoRows
+		return ErrStaleVersion
 	}
 	return nil
 }
 
-func (r *recordRepository) GetStats() (*model.Stats, error) {
+// GetStats totals all of the user's records, and counts those dated on or
+// after weekStart and monthStart.
+func (r *recordRepository) GetStats(userID int64, weekStart, monthStart string) (*model.Stats, error) {
 	stats := &model.Stats{}
 
 	// Total records and duration
-	err := r.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(duration), 0) FROM records`).
+	err := r.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(duration), 0) FROM records WHERE user_id = ? AND deleted_at IS NULL`, userID).
 		Scan(&stats.TotalRecords, &stats.TotalDuration)
 	if err != nil {
 		return nil, err
 	}
 
 	// This week
-	now := time.Now()
-	weekStart := now.AddDate(0, 0, -int(now.Weekday()))
-	weekStartStr := weekStart.Format("2006-01-02")
-	err = r.db.QueryRow(`SELECT COUNT(*) FROM records WHERE date >= ?`, weekStartStr).
+	err = r.db.QueryRow(`SELECT COUNT(*) FROM records WHERE user_id = ? AND deleted_at IS NULL AND date >= ?`, userID, weekStart).
 		Scan(&stats.ThisWeek)
 	if err != nil {
 		return nil, err
 	}
 
 	// This month
-	monthStartStr := now.Format("2006-01") + "-01"
-	err = r.db.QueryRow(`SELECT COUNT(*) FROM records WHERE date >= ?`, monthStartStr).
+	err = r.db.QueryRow(`SELECT COUNT(*) FROM records WHERE user_id = ? AND deleted_at IS NULL AND date >= ?`, userID, monthStart).
 		Scan(&stats.ThisMonth)
 	if err != nil {
 		return nil, err
@@ -200,3 +516,81 @@ func (r *recordRepository) GetStats() (*model.Stats, error) {
 
 	return stats, nil
 }
+
+// GetActivityDates returns each distinct (habit, date) pair that has records
+// for the user, oldest first.
+func (r *recordRepository) GetActivityDates(userID int64) ([]model.ActivityDate, error) {
+	rows, err := r.db.Query(
+		`SELECT DISTINCT COALESCE(habit_id, 0), date FROM records WHERE user_id = ? AND deleted_at IS NULL ORDER BY date`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dates []model.ActivityDate
+	for rows.Next() {
+		var d model.ActivityDate
+		if err := rows.Scan(&d.HabitID, &d.Date); err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+	}
+	return dates, rows.Err()
+}
+
+// GetDailyTotals sums the records matching filter per day, oldest first. Only
+// the filter's date range, habit, content and duration bounds apply.
+func (r *recordRepository) GetDailyTotals(userID int64, filter *model.RecordFilter) ([]model.DayTotal, error) {
+	where, args := recordWhere(userID, filter, false)
+	rows, err := r.db.Query(
+		`SELECT date, COUNT(*), COALESCE(SUM(duration), 0) FROM records`+where+` GROUP BY date ORDER BY date`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []model.DayTotal
+	for rows.Next() {
+		var t model.DayTotal
+		if err := rows.Scan(&t.Date, &t.Count, &t.Duration); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// GetSeries totals the user's records per day, week, month or year, and per
+// content when groupByContent is set, ordered by bucket.
+func (r *recordRepository) GetSeries(userID int64, filter *model.RecordFilter, interval string, weekStart time.Weekday, groupByContent bool) ([]model.SeriesTotal, error) {
+	bucket := r.db.dialect.dateBucket(interval, "date", weekStart)
+	key, groupBy := "''", bucket
+	if groupByContent {
+		key, groupBy = "content", bucket+", content"
+	}
+
+	where, args := recordWhere(userID, filter, false)
+	rows, err := r.db.Query(
+		`SELECT `+bucket+`, `+key+`, COUNT(*), COALESCE(SUM(duration), 0) FROM records`+where+
+			` GROUP BY `+groupBy+` ORDER BY `+bucket,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []model.SeriesTotal
+	for rows.Next() {
+		var t model.SeriesTotal
+		if err := rows.Scan(&t.Bucket, &t.Key, &t.Count, &t.Duration); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type ReminderRepository interface {
+	Create(reminder *model.Reminder) error
+	GetByID(userID, id int64) (*model.Reminder, error)
+	GetAll(userID int64) ([]model.Reminder, error)
+	Update(reminder *model.Reminder) error
+	Delete(userID, id int64) error
+	// ListEnabled returns the enabled reminders of every user.
+	ListEnabled() ([]model.Reminder, error)
+	// SetLastFired moves the day a reminder last fired from from to to,
+	// unless another run has moved it first, and reports whether it did.
+	// Whoever moves it owns sending the reminder for that day.
+	SetLastFired(id int64, from, to *model.Date) (bool, error)
+}
+
+type reminderRepository struct {
+	db *DB
+}
+
+func NewReminderRepository(db *DB) ReminderRepository {
+	return &reminderRepository{db: db}
+}
+
+const reminderColumns = `id, user_id, habit_id, remind_at, weekdays, timezone, channel, enabled, last_fired_on, created_at, updated_at`
+
+func (r *reminderRepository) Create(reminder *model.Reminder) error {
+	return insertReminder(r.db, reminder)
+}
+
+// insertReminder writes reminder, keeping the day it last fired so that a
+// restored reminder does not fire twice that day.
+func insertReminder(q querier, reminder *model.Reminder) error {
+	stamp(&reminder.CreatedAt, &reminder.UpdatedAt)
+	id, err := insert(q,
+		`INSERT INTO reminders (user_id, habit_id, remind_at, weekdays, timezone, channel, enabled, last_fired_on, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		reminder.UserID, reminder.HabitID, reminder.Time, strings.Join(reminder.Weekdays, ","), reminder.Timezone, reminder.Channel, reminder.Enabled,
+		nullableDate(reminder.LastFiredOn), reminder.CreatedAt, reminder.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	reminder.ID = id
+	return nil
+}
+
+func (r *reminderRepository) GetByID(userID, id int64) (*model.Reminder, error) {
+	reminder, err := scanReminder(r.db.QueryRow(`SELECT `+reminderColumns+` FROM reminders WHERE id = ? AND user_id = ?`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reminder, nil
+}
+
+func (r *reminderRepository) GetAll(userID int64) ([]model.Reminder, error) {
+	return r.list(`SELECT `+reminderColumns+` FROM reminders WHERE user_id = ? ORDER BY habit_id, remind_at, id`, userID)
+}
+
+func (r *reminderRepository) ListEnabled() ([]model.Reminder, error) {
+	return r.list(`SELECT `+reminderColumns+` FROM reminders WHERE enabled = ? ORDER BY id`, true)
+}
+
+func (r *reminderRepository) list(query string, args ...interface{}) ([]model.Reminder, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []model.Reminder
+	for rows.Next() {
+		reminder, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, *reminder)
+	}
+	return reminders, rows.Err()
+}
+
+func (r *reminderRepository) Update(reminder *model.Reminder) error {
+	reminder.UpdatedAt = time.Now()
+	result, err := r.db.Exec(
+		`UPDATE reminders SET habit_id = ?, remind_at = ?, weekdays = ?, timezone = ?, channel = ?, enabled = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+		reminder.HabitID, reminder.Time, strings.Join(reminder.Weekdays, ","), reminder.Timezone, reminder.Channel, reminder.Enabled, reminder.UpdatedAt, reminder.ID, reminder.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *reminderRepository) Delete(userID, id int64) error {
+	result, err := r.db.Exec(`DELETE FROM reminders WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *reminderRepository) SetLastFired(id int64, from, to *model.Date) (bool, error) {
+	query := `UPDATE reminders SET last_fired_on = ? WHERE id = ? AND last_fired_on IS NULL`
+	args := []interface{}{nullableDate(to), id}
+	if from != nil {
+		query = `UPDATE reminders SET last_fired_on = ? WHERE id = ? AND last_fired_on = ?`
+		args = append(args, *from)
+	}
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func scanReminder(row rowScanner) (*model.Reminder, error) {
+	reminder := &model.Reminder{}
+	var weekdays string
+	var lastFired model.Date
+	err := row.Scan(&reminder.ID, &reminder.UserID, &reminder.HabitID, &reminder.Time, &weekdays, &reminder.Timezone,
+		&reminder.Channel, &reminder.Enabled, &lastFired, &reminder.CreatedAt, &reminder.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if weekdays != "" {
+		reminder.Weekdays = strings.Split(weekdays, ",")
+	}
+	if !lastFired.IsZero() {
+		reminder.LastFiredOn = &lastFired
+	}
+	return reminder, nil
+}
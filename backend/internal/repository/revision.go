@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+// insertRevision appends an entry to the history of a record. It is called in
+// the transaction of the write it describes, so the two are stored together
+// or not at all.
+func insertRevision(q querier, actor *model.Actor, action string, recordID, version int64, before, after *model.RecordSnapshot) error {
+	beforeState, err := snapshotState(before)
+	if err != nil {
+		return err
+	}
+	afterState, err := snapshotState(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = insert(q,
+		`INSERT INTO record_revisions (record_id, user_id, api_key_id, request_id, action, version, before_state, after_state, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		recordID, actor.UserID, nullableID(actor.APIKeyID), actor.RequestID, action, version, beforeState, afterState, time.Now(),
+	)
+	return err
+}
+
+func snapshotState(snapshot *model.RecordSnapshot) (interface{}, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// ListRevisions returns the history of one of the user's records, oldest
+// first. Records in the trash and records removed for good keep theirs.
+func (r *recordRepository) ListRevisions(userID, recordID int64) ([]model.RecordRevision, error) {
+	rows, err := r.db.Query(
+		`SELECT id, record_id, user_id, COALESCE(api_key_id, 0), request_id, action, version, before_state, after_state, created_at
+		FROM record_revisions WHERE record_id = ? AND user_id = ? ORDER BY id`,
+		recordID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []model.RecordRevision
+	for rows.Next() {
+		var rev model.RecordRevision
+		var before, after sql.NullString
+		if err := rows.Scan(&rev.ID, &rev.RecordID, &rev.UserID, &rev.APIKeyID, &rev.RequestID, &rev.Action, &rev.Version, &before, &after, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if rev.Before, err = parseSnapshot(before); err != nil {
+			return nil, err
+		}
+		if rev.After, err = parseSnapshot(after); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func parseSnapshot(state sql.NullString) (*model.RecordSnapshot, error) {
+	if !state.Valid {
+		return nil, nil
+	}
+	var snapshot model.RecordSnapshot
+	if err := json.Unmarshal([]byte(state.String), &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type SessionRepository interface {
+	Create(session *model.Session) error
+	GetByTokenHash(tokenHash string) (*model.Session, error)
+	Delete(tokenHash string) error
+	DeleteExpired(now time.Time) error
+}
+
+type sessionRepository struct {
+	db *DB
+}
+
+func NewSessionRepository(db *DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(session *model.Session) error {
+	now := time.Now()
+	id, err := insert(r.db,
+		`INSERT INTO sessions (user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		session.UserID, session.TokenHash, session.ExpiresAt.UTC(), now,
+	)
+	if err != nil {
+		return err
+	}
+
+	session.ID = id
+	session.CreatedAt = now
+	return nil
+}
+
+func (r *sessionRepository) GetByTokenHash(tokenHash string) (*model.Session, error) {
+	session := &model.Session{}
+	err := r.db.QueryRow(
+		`SELECT id, user_id, token_hash, expires_at, created_at FROM sessions WHERE token_hash = ?`,
+		tokenHash,
+	).Scan(&session.ID, &session.UserID, &session.TokenHash, &session.ExpiresAt, &session.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *sessionRepository) Delete(tokenHash string) error {
+	_, err := r.db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+	return err
+}
+
+// DeleteExpired removes sessions that expired before now. Expiry times are
+// stored in UTC so that the comparison also holds for sqlite's text dates.
+func (r *sessionRepository) DeleteExpired(now time.Time) error {
+	_, err := r.db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, now.UTC())
+	return err
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+// ErrUsernameExists is returned by Create when another user has the name.
+var ErrUsernameExists = errors.New("username already exists")
+
+type UserRepository interface {
+	Create(user *model.User) error
+	GetByID(id int64) (*model.User, error)
+	GetByUsername(username string) (*model.User, error)
+	UpdatePassword(id int64, passwordHash string) error
+	UpdateSettings(user *model.User) error
+	// ListSummaryRecipients returns the users who asked for weekly
+	// summaries and have an address to send them to.
+	ListSummaryRecipients() ([]model.User, error)
+	// SetSummarySent moves the week a user's summary was last sent in from
+	// from to to, unless another run has moved it first, and reports whether
+	// it did. Whoever moves it owns sending that week's summary.
+	SetSummarySent(id int64, from, to *model.Date) (bool, error)
+}
+
+type userRepository struct {
+	db *DB
+}
+
+func NewUserRepository(db *DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+func (r *userRepository) Create(user *model.User) error {
+	now := time.Now()
+	id, err := insert(r.db,
+		`INSERT INTO users (username, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		user.Username, user.PasswordHash, now, now,
+	)
+	if isUniqueViolation(err) {
+		return ErrUsernameExists
+	}
+	if err != nil {
+		return err
+	}
+
+	user.ID = id
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	return nil
+}
+
+func (r *userRepository) GetByID(id int64) (*model.User, error) {
+	return r.getOne(`SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+func (r *userRepository) GetByUsername(username string) (*model.User, error) {
+	return r.getOne(`SELECT `+userColumns+` FROM users WHERE username = ?`, username)
+}
+
+const userColumns = `id, username, COALESCE(password_hash, ''), timezone, week_start, email, weekly_summary, summary_sent_on, created_at, updated_at`
+
+func (r *userRepository) getOne(query string, args ...interface{}) (*model.User, error) {
+	user, err := scanUser(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) ListSummaryRecipients() ([]model.User, error) {
+	rows, err := r.db.Query(`SELECT `+userColumns+` FROM users WHERE weekly_summary = ? AND email <> '' ORDER BY id`, true)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (r *userRepository) SetSummarySent(id int64, from, to *model.Date) (bool, error) {
+	query := `UPDATE users SET summary_sent_on = ? WHERE id = ? AND summary_sent_on IS NULL`
+	args := []interface{}{nullableDate(to), id}
+	if from != nil {
+		query = `UPDATE users SET summary_sent_on = ? WHERE id = ? AND summary_sent_on = ?`
+		args = append(args, *from)
+	}
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func scanUser(row rowScanner) (*model.User, error) {
+	user := &model.User{}
+	var sentOn model.Date
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Timezone, &user.WeekStart, &user.Email,
+		&user.WeeklySummary, &sentOn, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if !sentOn.IsZero() {
+		user.SummarySentOn = &sentOn
+	}
+	return user, nil
+}
+
+func (r *userRepository) UpdatePassword(id int64, passwordHash string) error {
+	result, err := r.db.Exec(
+		`UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`,
+		passwordHash, time.Now(), id,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *userRepository) UpdateSettings(user *model.User) error {
+	user.UpdatedAt = time.Now()
+	result, err := r.db.Exec(
+		`UPDATE users SET timezone = ?, week_start = ?, email = ?, weekly_summary = ?, updated_at = ? WHERE id = ?`,
+		user.Timezone, user.WeekStart, user.Email, user.WeeklySummary, user.UpdatedAt, user.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
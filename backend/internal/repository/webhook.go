@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type WebhookRepository interface {
+	Create(webhook *model.Webhook) error
+	GetByID(userID, id int64) (*model.Webhook, error)
+	GetAll(userID int64) ([]model.Webhook, error)
+	// ListEnabled returns the enabled webhooks of every user.
+	ListEnabled() ([]model.Webhook, error)
+	Update(webhook *model.Webhook) error
+	Delete(userID, id int64) error
+	// AddFailure counts a failed delivery attempt, disabling the webhook
+	// when it reaches limit failures in a row, and reports whether it did.
+	AddFailure(id int64, limit int) (bool, error)
+	ResetFailures(id int64) error
+
+	// Enqueue adds a pending delivery unless the webhook already has one
+	// for the same event, and reports whether it did.
+	Enqueue(delivery *model.WebhookDelivery) (bool, error)
+	// ListDue returns up to limit pending deliveries to enabled webhooks
+	// whose next attempt is due at now, oldest first.
+	ListDue(now time.Time, limit int) ([]model.WebhookDelivery, error)
+	// Claim counts an attempt at a delivery that has had attempts so far
+	// and holds it until until, unless another run has claimed it first,
+	// and reports whether it did. Whoever claims it owns the attempt.
+	Claim(id int64, attempts int, until time.Time) (bool, error)
+	// Finish stores the outcome of the last attempt at a delivery.
+	Finish(delivery *model.WebhookDelivery) error
+	// ListDeliveries returns the latest deliveries to a webhook, newest
+	// first.
+	ListDeliveries(webhookID int64, limit int) ([]model.WebhookDelivery, error)
+	// PurgeDeliveries removes finished deliveries created before before.
+	PurgeDeliveries(before time.Time) (int64, error)
+}
+
+type webhookRepository struct {
+	db *DB
+}
+
+func NewWebhookRepository(db *DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+const webhookColumns = `id, user_id, url, secret, events, enabled, failures, created_at, updated_at`
+
+func (r *webhookRepository) Create(webhook *model.Webhook) error {
+	stamp(&webhook.CreatedAt, &webhook.UpdatedAt)
+	id, err := insert(r.db,
+		`INSERT INTO webhooks (user_id, url, secret, events, enabled, failures, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		webhook.UserID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Enabled, webhook.Failures, webhook.CreatedAt, webhook.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	webhook.ID = id
+	return nil
+}
+
+func (r *webhookRepository) GetByID(userID, id int64) (*model.Webhook, error) {
+	webhook, err := scanWebhook(r.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ? AND user_id = ?`, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (r *webhookRepository) GetAll(userID int64) ([]model.Webhook, error) {
+	return r.list(`SELECT `+webhookColumns+` FROM webhooks WHERE user_id = ? ORDER BY id`, userID)
+}
+
+func (r *webhookRepository) ListEnabled() ([]model.Webhook, error) {
+	return r.list(`SELECT `+webhookColumns+` FROM webhooks WHERE enabled = ? ORDER BY id`, true)
+}
+
+func (r *webhookRepository) list(query string, args ...interface{}) ([]model.Webhook, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *webhookRepository) Update(webhook *model.Webhook) error {
+	webhook.UpdatedAt = time.Now()
+	result, err := r.db.Exec(
+		`UPDATE webhooks SET url = ?, secret = ?, events = ?, enabled = ?, failures = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+		webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Enabled, webhook.Failures, webhook.UpdatedAt, webhook.ID, webhook.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete removes a webhook together with its delivery log, which SQLite does
+// not cascade to without foreign key enforcement.
+func (r *webhookRepository) Delete(userID, id int64) error {
+	_, err := r.db.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE id = ? AND user_id = ?)`, id, userID)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.Exec(`DELETE FROM webhooks WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *webhookRepository) AddFailure(id int64, limit int) (bool, error) {
+	if _, err := r.db.Exec(`UPDATE webhooks SET failures = failures + 1 WHERE id = ?`, id); err != nil {
+		return false, err
+	}
+	result, err := r.db.Exec(
+		`UPDATE webhooks SET enabled = ?, updated_at = ? WHERE id = ? AND enabled = ? AND failures >= ?`,
+		false, time.Now(), id, true, limit,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *webhookRepository) ResetFailures(id int64) error {
+	_, err := r.db.Exec(`UPDATE webhooks SET failures = 0 WHERE id = ? AND failures <> 0`, id)
+	return err
+}
+
+const deliveryColumns = `id, webhook_id, event_id, event, payload, status, attempts, next_attempt_at, response_status, error, created_at, delivered_at`
+
+func (r *webhookRepository) Enqueue(delivery *model.WebhookDelivery) (bool, error) {
+	var n int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = ? AND event_id = ?`, delivery.WebhookID, delivery.EventID).Scan(&n)
+	if err != nil || n > 0 {
+		return false, err
+	}
+
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now()
+	}
+	id, err := insert(r.db,
+		`INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, attempts, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.WebhookID, delivery.EventID, delivery.Event, string(delivery.Payload), delivery.Status, delivery.Attempts, nullableTime(delivery.NextAttemptAt), delivery.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	delivery.ID = id
+	return true, nil
+}
+
+func (r *webhookRepository) ListDue(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	return r.listDeliveries(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ? AND webhook_id IN (SELECT id FROM webhooks WHERE enabled = ?)
+		ORDER BY next_attempt_at, id LIMIT ?`,
+		model.DeliveryPending, now.UTC(), true, limit,
+	)
+}
+
+func (r *webhookRepository) Claim(id int64, attempts int, until time.Time) (bool, error) {
+	result, err := r.db.Exec(
+		`UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ? WHERE id = ? AND status = ? AND attempts = ?`,
+		until.UTC(), id, model.DeliveryPending, attempts,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *webhookRepository) Finish(delivery *model.WebhookDelivery) error {
+	_, err := r.db.Exec(
+		`UPDATE webhook_deliveries SET status = ?, next_attempt_at = ?, response_status = ?, error = ?, delivered_at = ? WHERE id = ?`,
+		delivery.Status, nullableTime(delivery.NextAttemptAt), delivery.ResponseStatus, delivery.Error, nullableTime(delivery.DeliveredAt), delivery.ID,
+	)
+	return err
+}
+
+func (r *webhookRepository) ListDeliveries(webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	return r.listDeliveries(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`, webhookID, limit)
+}
+
+func (r *webhookRepository) listDeliveries(query string, args ...interface{}) ([]model.WebhookDelivery, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var d model.WebhookDelivery
+		var payload string
+		var next, delivered sql.NullTime
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts, &next,
+			&d.ResponseStatus, &d.Error, &d.CreatedAt, &delivered)
+		if err != nil {
+			return nil, err
+		}
+		d.Payload = []byte(payload)
+		if next.Valid {
+			d.NextAttemptAt = &next.Time
+		}
+		if delivered.Valid {
+			d.DeliveredAt = &delivered.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *webhookRepository) PurgeDeliveries(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM webhook_deliveries WHERE status <> ? AND created_at < ?`, model.DeliveryPending, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanWebhook(row rowScanner) (*model.Webhook, error) {
+	webhook := &model.Webhook{}
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &events, &webhook.Enabled,
+		&webhook.Failures, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	return webhook, nil
+}
+
+// nullableTime stores t in UTC, so that times compare as text in SQLite.
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// apiKeyPrefix marks a bearer token as an API key rather than a session
+// token, so the two can be told apart without a database lookup.
+const apiKeyPrefix = "ht_"
+
+var validScopes = map[string]bool{
+	model.ScopeRecordsRead:  true,
+	model.ScopeRecordsWrite: true,
+	model.ScopeHabitsRead:   true,
+	model.ScopeHabitsWrite:  true,
+	model.ScopeStatsRead:    true,
+}
+
+type APIKeyService interface {
+	Create(userID int64, req *model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error)
+	GetAll(userID int64) ([]model.APIKey, error)
+	Revoke(userID, id int64) error
+}
+
+type apiKeyService struct {
+	repo repository.APIKeyRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{repo: repo}
+}
+
+func (s *apiKeyService) Create(userID int64, req *model.CreateAPIKeyRequest) (*model.CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, ErrInvalidInput
+	}
+
+	scopes := []string{}
+	seen := make(map[string]bool)
+	for _, scope := range req.Scopes {
+		if !validScopes[scope] {
+			return nil, ErrInvalidInput
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	plain := apiKeyPrefix + token
+
+	key := &model.APIKey{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  plain[:len(apiKeyPrefix)+6],
+		KeyHash: hashToken(plain),
+		Scopes:  scopes,
+	}
+	if err := s.repo.Create(key); err != nil {
+		return nil, err
+	}
+
+	return &model.CreatedAPIKey{APIKey: *key, Key: plain}, nil
+}
+
+func (s *apiKeyService) GetAll(userID int64) ([]model.APIKey, error) {
+	keys, err := s.repo.GetAll(userID)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return []model.APIKey{}, nil
+	}
+	return keys, nil
+}
+
+func (s *apiKeyService) Revoke(userID, id int64) error {
+	if err := s.repo.Revoke(userID, id); err != nil {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type mockAPIKeyRepository struct {
+	keys   []model.APIKey
+	nextID int64
+}
+
+func newMockAPIKeyRepository() *mockAPIKeyRepository {
+	return &mockAPIKeyRepository{keys: []model.APIKey{}, nextID: 1}
+}
+
+func (m *mockAPIKeyRepository) Create(key *model.APIKey) error {
+	key.ID = m.nextID
+	m.nextID++
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+func (m *mockAPIKeyRepository) GetByHash(keyHash string) (*model.APIKey, error) {
+	for _, k := range m.keys {
+		if k.KeyHash == keyHash {
+			return &k, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepository) GetAll(userID int64) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	for _, k := range m.keys {
+		if k.UserID == userID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockAPIKeyRepository) Revoke(userID, id int64) error {
+	for i, k := range m.keys {
+		if k.ID == id && k.UserID == userID && k.RevokedAt == nil {
+			now := time.Now()
+			m.keys[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockAPIKeyRepository) TouchLastUsed(id int64, at time.Time) error {
+	for i, k := range m.keys {
+		if k.ID == id {
+			m.keys[i].LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+func TestAPIKeyService_Create(t *testing.T) {
+	repo := newMockAPIKeyRepository()
+	svc := NewAPIKeyService(repo)
+
+	tests := []struct {
+		name    string
+		req     *model.CreateAPIKeyRequest
+		wantErr error
+	}{
+		{name: "unscoped key", req: &model.CreateAPIKeyRequest{Name: "cron"}},
+		{name: "scoped key", req: &model.CreateAPIKeyRequest{Name: "logger", Scopes: []string{"records:write", "records:write"}}},
+		{name: "blank name", req: &model.CreateAPIKeyRequest{Name: " "}, wantErr: ErrInvalidInput},
+		{name: "unknown scope", req: &model.CreateAPIKeyRequest{Name: "admin", Scopes: []string{"users:write"}}, wantErr: ErrInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := svc.Create(testUserID, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(key.Key, apiKeyPrefix) || !strings.HasPrefix(key.Key, key.Prefix) {
+				t.Errorf("Create() key = %q with prefix %q", key.Key, key.Prefix)
+			}
+			if key.KeyHash == key.Key {
+				t.Error("Create() stored the raw key")
+			}
+		})
+	}
+
+	if len(repo.keys[1].Scopes) != 1 {
+		t.Errorf("Create() scopes = %v, want duplicates removed", repo.keys[1].Scopes)
+	}
+}
+
+func TestAuthService_AuthenticateAPIKey(t *testing.T) {
+	users := newMockUserRepository()
+	users.Create(&model.User{Username: "alice"})
+	keys := newMockAPIKeyRepository()
+	auth := NewAuthService(users, newMockSessionRepository(), keys, time.Hour)
+	svc := NewAPIKeyService(keys)
+
+	created, err := svc.Create(1, &model.CreateAPIKeyRequest{Name: "cron", Scopes: []string{model.ScopeRecordsRead}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	principal, err := auth.Authenticate(created.Key)
+	if err != nil || principal == nil {
+		t.Fatalf("Authenticate() = %v, %v; want a principal", principal, err)
+	}
+	if principal.User.Username != "alice" || principal.APIKeyID != created.ID {
+		t.Errorf("Authenticate() = %+v, want alice via key %d", principal, created.ID)
+	}
+	if len(principal.Scopes) != 1 || principal.Scopes[0] != model.ScopeRecordsRead {
+		t.Errorf("Authenticate() scopes = %v, want [%s]", principal.Scopes, model.ScopeRecordsRead)
+	}
+	if keys.keys[0].LastUsedAt == nil {
+		t.Error("Authenticate() did not record when the key was used")
+	}
+
+	if err := svc.Revoke(2, created.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Revoke() by another user error = %v, want %v", err, ErrAPIKeyNotFound)
+	}
+	if err := svc.Revoke(1, created.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if principal, _ := auth.Authenticate(created.Key); principal != nil {
+		t.Error("Authenticate() accepted a revoked key")
+	}
+}
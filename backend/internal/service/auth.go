@@ -0,0 +1,228 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+	"habit-tracker/pkg/logger"
+)
+
+var (
+	ErrUsernameTaken      = errors.New("username already taken")
+	ErrInvalidCredentials = errors.New("invalid username or password")
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything past the first 72 bytes.
+	maxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,50}$`)
+
+type AuthService interface {
+	Register(req *model.RegisterRequest) (*model.AuthResponse, error)
+	Login(req *model.LoginRequest) (*model.AuthResponse, error)
+	Logout(token string) error
+	Authenticate(token string) (*model.Principal, error)
+	// SetInitialPassword gives an account without a password, such as the
+	// default user that owns data written before accounts existed, its
+	// first password. Accounts that already have one are left alone.
+	SetInitialPassword(username, password string) error
+}
+
+// apiKeyTouchInterval limits how often a key's last-used time is written.
+const apiKeyTouchInterval = time.Minute
+
+type authService struct {
+	users      repository.UserRepository
+	sessions   repository.SessionRepository
+	apiKeys    repository.APIKeyRepository
+	sessionTTL time.Duration
+	now        func() time.Time
+}
+
+func NewAuthService(users repository.UserRepository, sessions repository.SessionRepository, apiKeys repository.APIKeyRepository, sessionTTL time.Duration) AuthService {
+	return &authService{users: users, sessions: sessions, apiKeys: apiKeys, sessionTTL: sessionTTL, now: time.Now}
+}
+
+// Register creates an account and signs it in. Accounts without a password
+// cannot be claimed by registering under their name; see SetInitialPassword.
+func (s *authService) Register(req *model.RegisterRequest) (*model.AuthResponse, error) {
+	if !usernamePattern.MatchString(req.Username) {
+		return nil, ErrInvalidInput
+	}
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByUsername(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return nil, ErrUsernameTaken
+	}
+
+	// A registration racing this one may take the name after the check
+	// above, which the database then refuses.
+	user = &model.User{Username: req.Username, PasswordHash: hash}
+	err = s.users.Create(user)
+	if errors.Is(err, repository.ErrUsernameExists) {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(user)
+}
+
+func (s *authService) SetInitialPassword(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	user, err := s.users.GetByUsername(username)
+	if err != nil || user == nil || user.PasswordHash != "" {
+		return err
+	}
+	if err := s.users.UpdatePassword(user.ID, hash); err != nil {
+		return err
+	}
+	logger.Info("Initial password set for user %q", user.Username)
+	return nil
+}
+
+// hashPassword checks the length of password and hashes it.
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", ErrInvalidInput
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (s *authService) Login(req *model.LoginRequest) (*model.AuthResponse, error) {
+	user, err := s.users.GetByUsername(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.PasswordHash == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := s.sessions.DeleteExpired(s.now()); err != nil {
+		logger.Error("Failed to delete expired sessions: %v", err)
+	}
+
+	return s.startSession(user)
+}
+
+func (s *authService) Logout(token string) error {
+	return s.sessions.Delete(hashToken(token))
+}
+
+// Authenticate resolves a session token or API key to its owner. It returns
+// nil when the token is unknown, its session has expired or its key has been
+// revoked.
+func (s *authService) Authenticate(token string) (*model.Principal, error) {
+	if token == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return s.authenticateAPIKey(token)
+	}
+
+	session, err := s.sessions.GetByTokenHash(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || !s.now().Before(session.ExpiresAt) {
+		return nil, nil
+	}
+
+	return s.principal(session.UserID, nil)
+}
+
+func (s *authService) authenticateAPIKey(token string) (*model.Principal, error) {
+	key, err := s.apiKeys.GetByHash(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.RevokedAt != nil {
+		return nil, nil
+	}
+
+	now := s.now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.apiKeys.TouchLastUsed(key.ID, now); err != nil {
+			logger.Error("Failed to record api key use: %v", err)
+		}
+	}
+
+	principal, err := s.principal(key.UserID, key.Scopes)
+	if principal != nil {
+		principal.APIKeyID = key.ID
+	}
+	return principal, err
+}
+
+func (s *authService) principal(userID int64, scopes []string) (*model.Principal, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return &model.Principal{User: user, Scopes: scopes}, nil
+}
+
+func (s *authService) startSession(user *model.User) (*model.AuthResponse, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &model.Session{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: s.now().Add(s.sessionTTL),
+	}
+	if err := s.sessions.Create(session); err != nil {
+		return nil, err
+	}
+
+	return &model.AuthResponse{Token: token, ExpiresAt: session.ExpiresAt, User: user}, nil
+}
+
+// newToken returns 32 random bytes encoded for use in an Authorization header.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is what gets stored in place of a token, so that a leaked
+// database does not hand out working credentials.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+)
+
+type mockUserRepository struct {
+	users  []model.User
+	nextID int64
+}
+
+func newMockUserRepository() *mockUserRepository {
+	return &mockUserRepository{users: []model.User{}, nextID: 1}
+}
+
+func (m *mockUserRepository) Create(user *model.User) error {
+	for _, u := range m.users {
+		if u.Username == user.Username {
+			return repository.ErrUsernameExists
+		}
+	}
+	user.ID = m.nextID
+	m.nextID++
+	m.users = append(m.users, *user)
+	return nil
+}
+
+func (m *mockUserRepository) GetByID(id int64) (*model.User, error) {
+	for _, u := range m.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockUserRepository) GetByUsername(username string) (*model.User, error) {
+	for _, u := range m.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockUserRepository) UpdatePassword(id int64, passwordHash string) error {
+	for i, u := range m.users {
+		if u.ID == id {
+			m.users[i].PasswordHash = passwordHash
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepository) UpdateSettings(user *model.User) error {
+	for i, u := range m.users {
+		if u.ID == user.ID {
+			m.users[i].Timezone = user.Timezone
+			m.users[i].WeekStart = user.WeekStart
+			m.users[i].Email = user.Email
+			m.users[i].WeeklySummary = user.WeeklySummary
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepository) ListSummaryRecipients() ([]model.User, error) {
+	var users []model.User
+	for _, u := range m.users {
+		if u.WeeklySummary && u.Email != "" {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (m *mockUserRepository) SetSummarySent(id int64, from, to *model.Date) (bool, error) {
+	for i, u := range m.users {
+		if u.ID != id {
+			continue
+		}
+		if (u.SummarySentOn == nil) != (from == nil) || (from != nil && *u.SummarySentOn != *from) {
+			return false, nil
+		}
+		m.users[i].SummarySentOn = to
+		return true, nil
+	}
+	return false, nil
+}
+
+type mockSessionRepository struct {
+	sessions map[string]model.Session
+}
+
+func newMockSessionRepository() *mockSessionRepository {
+	return &mockSessionRepository{sessions: map[string]model.Session{}}
+}
+
+func (m *mockSessionRepository) Create(session *model.Session) error {
+	m.sessions[session.TokenHash] = *session
+	return nil
+}
+
+func (m *mockSessionRepository) GetByTokenHash(tokenHash string) (*model.Session, error) {
+	if s, ok := m.sessions[tokenHash]; ok {
+		return &s, nil
+	}
+	return nil, nil
+}
+
+func (m *mockSessionRepository) Delete(tokenHash string) error {
+	delete(m.sessions, tokenHash)
+	return nil
+}
+
+func (m *mockSessionRepository) DeleteExpired(now time.Time) error {
+	for k, s := range m.sessions {
+		if s.ExpiresAt.Before(now) {
+			delete(m.sessions, k)
+		}
+	}
+	return nil
+}
+
+func TestAuthService_Register(t *testing.T) {
+	users := newMockUserRepository()
+	users.Create(&model.User{Username: "default"})
+	svc := NewAuthService(users, newMockSessionRepository(), newMockAPIKeyRepository(), time.Hour)
+
+	tests := []struct {
+		name    string
+		req     *model.RegisterRequest
+		wantErr error
+	}{
+		{name: "new user", req: &model.RegisterRequest{Username: "alice", Password: "correct horse"}},
+		{name: "taken username", req: &model.RegisterRequest{Username: "alice", Password: "another pass"}, wantErr: ErrUsernameTaken},
+		{name: "passwordless user", req: &model.RegisterRequest{Username: "default", Password: "correct horse"}, wantErr: ErrUsernameTaken},
+		{name: "short password", req: &model.RegisterRequest{Username: "bob", Password: "short"}, wantErr: ErrInvalidInput},
+		{name: "bad username", req: &model.RegisterRequest{Username: "a b", Password: "correct horse"}, wantErr: ErrInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.Register(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Register() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && resp.Token == "" {
+				t.Error("Register() returned an empty token")
+			}
+		})
+	}
+
+	if len(users.users) != 2 {
+		t.Errorf("Register() left %d users, want 2", len(users.users))
+	}
+}
+
+// racingUserRepository looks users up before another registration under
+// the same name has committed.
+type racingUserRepository struct {
+	*mockUserRepository
+}
+
+func (m racingUserRepository) GetByUsername(username string) (*model.User, error) {
+	return nil, nil
+}
+
+func TestAuthService_RegisterRacingForAName(t *testing.T) {
+	users := newMockUserRepository()
+	users.Create(&model.User{Username: "alice", PasswordHash: "x"})
+	svc := NewAuthService(racingUserRepository{users}, newMockSessionRepository(), newMockAPIKeyRepository(), time.Hour)
+
+	if _, err := svc.Register(&model.RegisterRequest{Username: "alice", Password: "correct horse"}); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("Register() error = %v, want %v", err, ErrUsernameTaken)
+	}
+}
+
+func TestAuthService_SetInitialPassword(t *testing.T) {
+	users := newMockUserRepository()
+	users.Create(&model.User{Username: "default"})
+	svc := NewAuthService(users, newMockSessionRepository(), newMockAPIKeyRepository(), time.Hour)
+
+	if err := svc.SetInitialPassword("default", "short"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("SetInitialPassword() with a short password error = %v, want %v", err, ErrInvalidInput)
+	}
+	if err := svc.SetInitialPassword("default", "correct horse"); err != nil {
+		t.Fatalf("SetInitialPassword() error = %v", err)
+	}
+	if err := svc.SetInitialPassword("default", "another pass"); err != nil {
+		t.Fatalf("SetInitialPassword() again error = %v", err)
+	}
+	if err := svc.SetInitialPassword("nobody", "correct horse"); err != nil {
+		t.Errorf("SetInitialPassword() for an unknown user error = %v", err)
+	}
+
+	if _, err := svc.Login(&model.LoginRequest{Username: "default", Password: "correct horse"}); err != nil {
+		t.Errorf("Login() with the initial password error = %v", err)
+	}
+	if _, err := svc.Login(&model.LoginRequest{Username: "default", Password: "another pass"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with the second password error = %v, want the first one kept", err)
+	}
+}
+
+func TestAuthService_LoginAndAuthenticate(t *testing.T) {
+	sessions := newMockSessionRepository()
+	svc := NewAuthService(newMockUserRepository(), sessions, newMockAPIKeyRepository(), time.Hour).(*authService)
+
+	if _, err := svc.Register(&model.RegisterRequest{Username: "alice", Password: "correct horse"}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	if _, err := svc.Login(&model.LoginRequest{Username: "alice", Password: "wrong horse"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with wrong password error = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := svc.Login(&model.LoginRequest{Username: "nobody", Password: "correct horse"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with unknown user error = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	resp, err := svc.Login(&model.LoginRequest{Username: "alice", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	for hash := range sessions.sessions {
+		if hash == resp.Token {
+			t.Error("Login() stored the raw token")
+		}
+	}
+
+	principal, err := svc.Authenticate(resp.Token)
+	if err != nil || principal == nil || principal.User.Username != "alice" {
+		t.Fatalf("Authenticate() = %v, %v; want alice", principal, err)
+	}
+	if len(principal.Scopes) != 0 {
+		t.Errorf("Authenticate() session scopes = %v, want none", principal.Scopes)
+	}
+
+	if principal, _ := svc.Authenticate("bogus"); principal != nil {
+		t.Error("Authenticate() accepted an unknown token")
+	}
+
+	svc.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if principal, _ := svc.Authenticate(resp.Token); principal != nil {
+		t.Error("Authenticate() accepted an expired token")
+	}
+	svc.now = time.Now
+
+	if err := svc.Logout(resp.Token); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if principal, _ := svc.Authenticate(resp.Token); principal != nil {
+		t.Error("Authenticate() accepted a token after logout")
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"habit-tracker/pkg/logger"
+)
+
+// Every runs job right away and then once per interval until ctx is done.
+// A failing run is logged under name and retried at the next interval.
+func Every(ctx context.Context, interval time.Duration, name string, job func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(); err != nil {
+			logger.Error("Failed to %s: %v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/notify"
+	"habit-tracker/internal/repository"
+)
+
+// BackupVersion is the version of the backup document written by Backup.
+// Bump it whenever the document changes shape, and teach Restore to read the
+// older versions. Version 2 added goals and version 3 reminders.
+const BackupVersion = 3
+
+var ErrUnsupportedBackup = errors.New("unsupported backup version")
+
+type BackupService interface {
+	Backup(userID int64) (*model.Backup, error)
+	Restore(actor *model.Actor, backup *model.Backup, mode string) (*model.RestoreResult, error)
+}
+
+type backupService struct {
+	records   repository.RecordRepository
+	habits    repository.HabitRepository
+	goals     repository.GoalRepository
+	reminders repository.ReminderRepository
+	backups   repository.BackupRepository
+	events    EventPublisher
+	now       func() time.Time
+}
+
+// NewBackupService returns a service that publishes the records a restore
+// deletes and writes to events, which may be nil.
+func NewBackupService(records repository.RecordRepository, habits repository.HabitRepository, goals repository.GoalRepository,
+	reminders repository.ReminderRepository, backups repository.BackupRepository, events EventPublisher) BackupService {
+	return &backupService{records: records, habits: habits, goals: goals, reminders: reminders, backups: backups, events: events, now: time.Now}
+}
+
+func (s *backupService) Backup(userID int64) (*model.Backup, error) {
+	habits, err := s.habits.GetAll(userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &model.Backup{
+		Version:    BackupVersion,
+		ExportedAt: s.now().UTC(),
+		Habits:     habits,
+		Records:    []model.Record{},
+	}
+	if backup.Habits == nil {
+		backup.Habits = []model.Habit{}
+	}
+	if backup.Goals, err = s.goals.GetAll(userID, 0); err != nil {
+		return nil, err
+	}
+	if backup.Goals == nil {
+		backup.Goals = []model.Goal{}
+	}
+	if backup.Reminders, err = s.reminders.GetAll(userID); err != nil {
+		return nil, err
+	}
+	if backup.Reminders == nil {
+		backup.Reminders = []model.Reminder{}
+	}
+
+	err = s.records.Stream(userID, &model.RecordFilter{Sort: "date", Order: "asc"}, func(record *model.Record) error {
+		backup.Records = append(backup.Records, *record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// Restore loads a backup into the user's account. mode is "merge", the
+// default, or "replace". The whole document is validated before anything is
+// written. Documents before version 3 lack goals or reminders; replacing from
+// one removes those along with the habits they belong to. Once committed, the
+// live records replaced are published as deleted and the records written as
+// created.
+func (s *backupService) Restore(actor *model.Actor, backup *model.Backup, mode string) (*model.RestoreResult, error) {
+	if mode == "" {
+		mode = "merge"
+	}
+	if mode != "merge" && mode != "replace" {
+		return nil, fieldError("mode", "invalid", "must be merge or replace")
+	}
+	if backup.Version < 1 || backup.Version > BackupVersion {
+		return nil, ErrUnsupportedBackup
+	}
+
+	names := make(map[int64]string, len(backup.Habits))
+	habits := make([]model.Habit, 0, len(backup.Habits))
+	for i, h := range backup.Habits {
+		h.Name = strings.TrimSpace(h.Name)
+		if h.Name == "" {
+			return nil, fieldError(fmt.Sprintf("habits[%d].name", i), "required", "is required")
+		}
+		if utf8.RuneCountInString(h.Name) > maxHabitName {
+			return nil, fieldError(fmt.Sprintf("habits[%d].name", i), "too_long", "must be at most %d characters", maxHabitName)
+		}
+		if _, ok := names[h.ID]; ok {
+			return nil, fieldError(fmt.Sprintf("habits[%d].id", i), "duplicate", "%d is used by another habit", h.ID)
+		}
+		req := &model.CreateHabitRequest{Name: h.Name, Color: h.Color, Icon: h.Icon, Unit: h.Unit}
+		if err := validateHabit(validateStruct(req), h.Schedule); err != nil {
+			return nil, within(fmt.Sprintf("habits[%d]", i), err)
+		}
+		names[h.ID] = h.Name
+		h.ID, h.UserID = 0, 0
+		habits = append(habits, h)
+	}
+
+	records := make([]model.ImportedRecord, 0, len(backup.Records))
+	for i, r := range backup.Records {
+		if err := validateRecord(&r); err != nil {
+			return nil, within(fmt.Sprintf("records[%d]", i), err)
+		}
+
+		name := strings.TrimSpace(r.Content)
+		if r.HabitID != 0 {
+			var ok bool
+			if name, ok = names[r.HabitID]; !ok {
+				return nil, fieldError(fmt.Sprintf("records[%d].habitId", i), "not_found", "%d is not the id of a habit in the backup", r.HabitID)
+			}
+		}
+		if name == "" {
+			return nil, within(fmt.Sprintf("records[%d]", i), errMissingHabit)
+		}
+		if utf8.RuneCountInString(name) > maxHabitName {
+			return nil, fieldError(fmt.Sprintf("records[%d].content", i), "too_long", "must be at most %d characters to name a new habit", maxHabitName)
+		}
+
+		r.Content = recordContent(r.Content, &model.Habit{Name: name})
+		r.ID, r.UserID, r.HabitID = 0, 0, 0
+		records = append(records, model.ImportedRecord{Record: r, HabitName: name})
+	}
+
+	day := model.DateOf(s.now())
+	goals := make([]model.ImportedGoal, 0, len(backup.Goals))
+	for i, g := range backup.Goals {
+		if err := validateBackupGoal(&g, day); err != nil {
+			return nil, within(fmt.Sprintf("goals[%d]", i), err)
+		}
+		name, ok := names[g.HabitID]
+		if !ok {
+			return nil, fieldError(fmt.Sprintf("goals[%d].habitId", i), "not_found", "%d is not the id of a habit in the backup", g.HabitID)
+		}
+		g.ID, g.UserID, g.HabitID = 0, 0, 0
+		goals = append(goals, model.ImportedGoal{Goal: g, HabitName: name})
+	}
+
+	reminders := make([]model.ImportedReminder, 0, len(backup.Reminders))
+	for i, r := range backup.Reminders {
+		if err := validateBackupReminder(&r); err != nil {
+			return nil, within(fmt.Sprintf("reminders[%d]", i), err)
+		}
+		name, ok := names[r.HabitID]
+		if !ok {
+			return nil, fieldError(fmt.Sprintf("reminders[%d].habitId", i), "not_found", "%d is not the id of a habit in the backup", r.HabitID)
+		}
+		r.ID, r.UserID, r.HabitID = 0, 0, 0
+		reminders = append(reminders, model.ImportedReminder{Reminder: r, HabitName: name})
+	}
+
+	result, err := s.backups.Restore(actor, habits, records, goals, reminders, mode == "replace")
+	if err != nil {
+		return nil, err
+	}
+	for i := range result.Replaced {
+		publishRecords(s.events, model.EventRecordDeleted, &result.Replaced[i])
+	}
+	for i := range records {
+		if records[i].Record.ID != 0 {
+			publishRecords(s.events, model.EventRecordCreated, &records[i].Record)
+		}
+	}
+	return result, nil
+}
+
+// validateBackupGoal holds a goal from a backup to the rules of the goals
+// endpoints as of today.
+func validateBackupGoal(goal *model.Goal, today model.Date) error {
+	req := &model.GoalRequest{HabitID: goal.HabitID, Metric: goal.Metric, Period: goal.Period, Target: goal.Target}
+	errs := validateStruct(req)
+	checkGoalTarget(errs, req)
+	switch {
+	case goal.StartDate.IsZero():
+		errs.add(fieldError("startDate", "required", "is required"))
+	case tooEarlyGoalStart(goal.StartDate, today):
+		errs.add(fieldError("startDate", "out_of_range", "must be at most %d days before today", maxGoalStartDays))
+	case goal.EndDate != nil && goal.EndDate.Before(goal.StartDate):
+		errs.add(fieldError("endDate", "out_of_range", "must not be before startDate"))
+	}
+	return errs.err()
+}
+
+// validateBackupReminder holds a reminder from a backup to the rules of the
+// reminders endpoints and normalizes it. The channel only has to be one this
+// server knows: email is accepted without SMTP settings or an address, which
+// the dispatcher reports when the reminder fires.
+func validateBackupReminder(reminder *model.Reminder) error {
+	req := &model.ReminderRequest{HabitID: reminder.HabitID, Time: reminder.Time, Weekdays: reminder.Weekdays, Timezone: reminder.Timezone}
+	errs := validateStruct(req)
+	reminder.Weekdays, reminder.Timezone = checkReminderTime(errs, req)
+	switch reminder.Channel {
+	case "":
+		reminder.Channel = notify.Log
+	case notify.Log, notify.Email:
+	default:
+		errs.add(fieldError("channel", "invalid", "must be %s or %s", notify.Log, notify.Email))
+	}
+	return errs.err()
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"habit-tracker/internal/model"
+)
+
+type mockBackupRepository struct {
+	habits    []model.Habit
+	records   []model.ImportedRecord
+	goals     []model.ImportedGoal
+	reminders []model.ImportedReminder
+	replace   bool
+}
+
+func (m *mockBackupRepository) Restore(actor *model.Actor, habits []model.Habit, records []model.ImportedRecord, goals []model.ImportedGoal,
+	reminders []model.ImportedReminder, replace bool) (*model.RestoreResult, error) {
+	m.habits, m.goals, m.reminders, m.replace = habits, goals, reminders, replace
+	m.records = append([]model.ImportedRecord(nil), records...) // as passed, before ids are assigned
+	result := &model.RestoreResult{Habits: len(habits), Records: len(records), Goals: len(goals), Reminders: len(reminders)}
+	if replace {
+		result.Replaced = []model.Record{{ID: 90, UserID: actor.UserID}}
+	}
+	for i := 1; i < len(records); i++ { // the first is skipped
+		records[i].Record.ID = int64(100 + i)
+		records[i].Record.UserID = actor.UserID
+	}
+	return result, nil
+}
+
+func TestBackupService_Backup(t *testing.T) {
+	records := newMockRepository()
+	habits := newMockHabitRepository()
+	recordSvc := NewRecordService(records, habits, nil, 1)
+	for _, req := range []model.CreateRecordRequest{
+		{Date: "2024-01-15", Content: "Running", Duration: 30},
+		{Date: "2024-01-16", Content: "Reading", Duration: 20},
+	} {
+		if _, err := recordSvc.Create(testActor, testCalendar, &req); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	goals := newMockGoalRepository()
+	goals.Create(&model.Goal{UserID: testUserID, HabitID: 1, Metric: model.GoalCount, Period: model.GoalWeekly, Target: 3, StartDate: mustDate("2024-01-01")})
+
+	reminders := newMockReminderRepository()
+	reminders.Create(&model.Reminder{UserID: testUserID, HabitID: 1, Time: "20:00", Channel: "log", Enabled: true})
+
+	backup, err := NewBackupService(records, habits, goals, reminders, &mockBackupRepository{}, nil).Backup(testUserID)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if backup.Version != BackupVersion {
+		t.Errorf("Backup() version = %d, want %d", backup.Version, BackupVersion)
+	}
+	if len(backup.Habits) != 2 || len(backup.Records) != 2 || len(backup.Goals) != 1 || len(backup.Reminders) != 1 {
+		t.Errorf("Backup() has %d habits, %d records, %d goals and %d reminders, want 2, 2, 1 and 1",
+			len(backup.Habits), len(backup.Records), len(backup.Goals), len(backup.Reminders))
+	}
+}
+
+func TestBackupService_Restore(t *testing.T) {
+	backup := &model.Backup{
+		Version: BackupVersion,
+		Habits:  []model.Habit{{ID: 7, Name: "Running", Color: "#f00"}},
+		Records: []model.Record{
+			{ID: 1, HabitID: 7, Date: mustDate("2024-01-15"), Content: "5k", Duration: 30},
+			{ID: 2, HabitID: 7, Date: mustDate("2024-01-16"), Duration: 20},
+			{ID: 3, Date: mustDate("2024-01-16"), Content: "Reading", Duration: 15},
+		},
+		Goals:     []model.Goal{{ID: 4, HabitID: 7, Metric: model.GoalDuration, Period: model.GoalWeekly, Target: 90, StartDate: mustDate("2024-01-01")}},
+		Reminders: []model.Reminder{{ID: 5, HabitID: 7, Time: "07:30", Weekdays: []string{"Thursday", "monday"}, Enabled: true}},
+	}
+
+	repo := &mockBackupRepository{}
+	events := &recordingPublisher{}
+	svc := NewBackupService(newMockRepository(), newMockHabitRepository(), newMockGoalRepository(), newMockReminderRepository(), repo, events)
+
+	if _, err := svc.Restore(testActor, backup, "replace"); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if want := []string{"record.deleted 90", "record.created 101", "record.created 102"}; !reflect.DeepEqual(events.events, want) {
+		t.Errorf("Restore() published %q, want %q", events.events, want)
+	}
+	if !repo.replace {
+		t.Error("Restore() replace = false, want true")
+	}
+	if repo.habits[0].ID != 0 || repo.habits[0].Color != "#f00" {
+		t.Errorf("Restore() habit = %+v, want id cleared and color kept", repo.habits[0])
+	}
+
+	want := []struct{ habit, content string }{{"Running", "5k"}, {"Running", "Running"}, {"Reading", "Reading"}}
+	for i, w := range want {
+		got := repo.records[i]
+		if got.HabitName != w.habit || got.Record.Content != w.content || got.Record.ID != 0 {
+			t.Errorf("records[%d] = %+v, want habit %q content %q and no id", i, got, w.habit, w.content)
+		}
+	}
+	if got := repo.goals[0]; got.HabitName != "Running" || got.Goal.ID != 0 || got.Goal.HabitID != 0 || got.Goal.Target != 90 {
+		t.Errorf("goals[0] = %+v, want habit \"Running\", target kept and no ids", got)
+	}
+	got := repo.reminders[0]
+	if got.HabitName != "Running" || got.Reminder.ID != 0 || got.Reminder.HabitID != 0 || got.Reminder.Channel != "log" ||
+		!reflect.DeepEqual(got.Reminder.Weekdays, []string{"monday", "thursday"}) {
+		t.Errorf("reminders[0] = %+v, want habit \"Running\", the log channel, normalized weekdays and no ids", got)
+	}
+}
+
+func TestBackupService_RestoreVersion1(t *testing.T) {
+	repo := &mockBackupRepository{}
+	svc := NewBackupService(newMockRepository(), newMockHabitRepository(), newMockGoalRepository(), newMockReminderRepository(), repo, nil)
+
+	backup := &model.Backup{Version: 1, Habits: []model.Habit{{ID: 1, Name: "Running"}}}
+	if _, err := svc.Restore(testActor, backup, ""); err != nil {
+		t.Fatalf("Restore() of a version 1 backup error = %v", err)
+	}
+	if len(repo.habits) != 1 || len(repo.goals) != 0 || len(repo.reminders) != 0 {
+		t.Errorf("Restore() wrote %d habits, %d goals and %d reminders, want 1, 0 and 0", len(repo.habits), len(repo.goals), len(repo.reminders))
+	}
+}
+
+func TestBackupService_RestoreRejectsBadDocuments(t *testing.T) {
+	tests := []struct {
+		name    string
+		backup  model.Backup
+		mode    string
+		wantErr error
+	}{
+		{"unknown version", model.Backup{Version: BackupVersion + 1}, "", ErrUnsupportedBackup},
+		{"missing version", model.Backup{}, "", ErrUnsupportedBackup},
+		{"unknown mode", model.Backup{Version: BackupVersion}, "append", ErrInvalidInput},
+		{"unnamed habit", model.Backup{Version: BackupVersion, Habits: []model.Habit{{ID: 1}}}, "", ErrInvalidInput},
+		{"over-long habit unit", model.Backup{Version: BackupVersion, Habits: []model.Habit{{ID: 1, Name: "Running", Unit: strings.Repeat("k", 21)}}}, "", ErrInvalidInput},
+		{
+			"dangling habit id",
+			model.Backup{Version: BackupVersion, Records: []model.Record{{HabitID: 3, Date: mustDate("2024-01-15"), Duration: 10}}},
+			"", ErrInvalidInput,
+		},
+		{
+			"invalid record",
+			model.Backup{Version: BackupVersion, Records: []model.Record{{Date: mustDate("2024-01-15"), Content: "Running"}}},
+			"", ErrInvalidInput,
+		},
+		{
+			"goal of a dangling habit id",
+			model.Backup{Version: BackupVersion, Goals: []model.Goal{{HabitID: 3, Metric: model.GoalCount, Period: model.GoalDaily, Target: 1, StartDate: mustDate("2024-01-01")}}},
+			"", ErrInvalidInput,
+		},
+		{
+			"invalid goal",
+			model.Backup{
+				Version: BackupVersion,
+				Habits:  []model.Habit{{ID: 1, Name: "Running"}},
+				Goals:   []model.Goal{{HabitID: 1, Metric: model.GoalCount, Period: "yearly", Target: 1, StartDate: mustDate("2024-01-01")}},
+			},
+			"", ErrInvalidInput,
+		},
+		{
+			"goal started too long ago",
+			model.Backup{
+				Version: BackupVersion,
+				Habits:  []model.Habit{{ID: 1, Name: "Running"}},
+				Goals:   []model.Goal{{HabitID: 1, Metric: model.GoalCount, Period: model.GoalDaily, Target: 1, StartDate: mustDate("0001-01-01")}},
+			},
+			"", ErrInvalidInput,
+		},
+		{
+			"reminder of a dangling habit id",
+			model.Backup{Version: BackupVersion, Reminders: []model.Reminder{{HabitID: 3, Time: "07:30"}}},
+			"", ErrInvalidInput,
+		},
+		{
+			"invalid reminder",
+			model.Backup{
+				Version:   BackupVersion,
+				Habits:    []model.Habit{{ID: 1, Name: "Running"}},
+				Reminders: []model.Reminder{{HabitID: 1, Time: "7:30", Channel: "sms"}},
+			},
+			"", ErrInvalidInput,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockBackupRepository{}
+			svc := NewBackupService(newMockRepository(), newMockHabitRepository(), newMockGoalRepository(), newMockReminderRepository(), repo, nil)
+
+			_, err := svc.Restore(testActor, &tt.backup, tt.mode)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Restore() error = %v, want %v", err, tt.wantErr)
+			}
+			if repo.records != nil {
+				t.Error("Restore() wrote to the repository")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+)
+
+// ErrBatchAborted is the outcome of an operation of an atomic batch that
+// succeeded but was rolled back because another operation failed.
+var ErrBatchAborted = errors.New("not applied because another operation of the batch failed")
+
+// errRollback makes InTx roll back an atomic batch with failed operations.
+var errRollback = errors.New("batch rolled back")
+
+// maxBatchOperations bounds the size of a batch, which holds a transaction
+// open while it runs.
+const maxBatchOperations = 100
+
+// BatchOutcome is the result of one operation of a batch: the record it
+// wrote, nil for a delete, or the error it failed with.
+type BatchOutcome struct {
+	Record *model.Record
+	Err    error
+}
+
+// Batch runs every operation, each in its own savepoint, so that all of them
+// are tried and reported even in an atomic batch that ends up rolled back.
+// Operations see the writes of the operations before them. Events are
+// published for the operations that were applied once the batch commits.
+func (s *recordService) Batch(actor *model.Actor, cal *model.Calendar, req *model.BatchRequest) ([]BatchOutcome, error) {
+	if req.Mode == "" {
+		req.Mode = model.BatchAtomic
+	}
+	errs := &ValidationError{}
+	if req.Mode != model.BatchAtomic && req.Mode != model.BatchBestEffort {
+		errs.add(fieldError("mode", "invalid", "must be %s or %s", model.BatchAtomic, model.BatchBestEffort))
+	}
+	switch {
+	case len(req.Operations) == 0:
+		errs.add(fieldError("operations", "required", "is required"))
+	case len(req.Operations) > maxBatchOperations:
+		errs.add(fieldError("operations", "too_long", "must have at most %d operations", maxBatchOperations))
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]BatchOutcome, len(req.Operations))
+	written := make([]*model.Record, len(req.Operations))
+	err := s.repo.InTx(func(tx repository.RecordTx) error {
+		failed := false
+		for i := range req.Operations {
+			err := tx.Savepoint(func() error {
+				record, err := s.applyOperation(tx, actor, cal, &req.Operations[i])
+				written[i] = record
+				return err
+			})
+			if err != nil {
+				outcomes[i] = BatchOutcome{Err: err}
+				written[i] = nil
+				failed = true
+			} else if req.Operations[i].Op != "delete" {
+				outcomes[i].Record = written[i]
+			}
+		}
+		if failed && req.Mode == model.BatchAtomic {
+			return errRollback
+		}
+		return nil
+	})
+	if errors.Is(err, errRollback) {
+		for i := range outcomes {
+			if outcomes[i].Err == nil {
+				outcomes[i] = BatchOutcome{Err: ErrBatchAborted}
+			}
+		}
+		return outcomes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	events := map[string]string{"create": model.EventRecordCreated, "update": model.EventRecordUpdated, "delete": model.EventRecordDeleted}
+	for i, record := range written {
+		if record != nil {
+			s.publish(events[req.Operations[i].Op], record)
+		}
+	}
+	return outcomes, nil
+}
+
+// applyOperation returns the record written, or for a delete the record as it
+// was.
+func (s *recordService) applyOperation(tx repository.RecordTx, actor *model.Actor, cal *model.Calendar, op *model.BatchOperation) (*model.Record, error) {
+	if op.Op != "create" && op.Op != "update" && op.Op != "delete" {
+		return nil, fieldError("op", "invalid", "must be create, update or delete")
+	}
+	if op.Op != "create" && op.ID == 0 {
+		return nil, fieldError("id", "required", "is required")
+	}
+	if op.Op != "delete" && op.Record == nil {
+		return nil, fieldError("record", "required", "is required")
+	}
+
+	var record *model.Record
+	var err error
+	switch op.Op {
+	case "create":
+		req := model.CreateRecordRequest(*op.Record)
+		record, err = s.create(tx, tx.Habits(), actor, cal, &req)
+	case "update":
+		record, err = s.update(tx, tx.Habits(), actor, op.ID, op.Version, cal, op.Record)
+	case "delete":
+		existing, err := current(tx, actor.UserID, op.ID, op.Version)
+		if err != nil {
+			return nil, err
+		}
+		return existing, recordWriteError(tx.Delete(actor, op.ID, existing.Version))
+	}
+	if errors.Is(err, ErrInvalidInput) {
+		return nil, within("record", err)
+	}
+	return record, err
+}
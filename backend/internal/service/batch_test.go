@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+func TestRecordService_Batch(t *testing.T) {
+	repo := newMockRepository()
+	svc := &recordService{repo: repo, habits: newMockHabitRepository(), maxFutureDays: 1, now: time.Now}
+	existing, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	ops := []model.BatchOperation{
+		{Op: "create", Record: &model.UpdateRecordRequest{Date: "2024-01-16", Content: "Reading", Duration: 20}},
+		{Op: "update", ID: existing.ID, Version: existing.Version, Record: &model.UpdateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 35}},
+		{Op: "delete", ID: 99},
+		{Op: "create", Record: &model.UpdateRecordRequest{Date: "2024-01-16", Content: "Reading"}},
+	}
+
+	t.Run("atomic", func(t *testing.T) {
+		outcomes, err := svc.Batch(testActor, testCalendar, &model.BatchRequest{Operations: ops})
+		if err != nil {
+			t.Fatalf("Batch() error = %v", err)
+		}
+		for i, want := range []error{ErrBatchAborted, ErrBatchAborted, ErrRecordNotFound, ErrInvalidInput} {
+			if !errors.Is(outcomes[i].Err, want) {
+				t.Errorf("Batch() operation %d error = %v, want %v", i, outcomes[i].Err, want)
+			}
+		}
+		var errs *ValidationError
+		if !errors.As(outcomes[3].Err, &errs) || !errs.has("record.duration") {
+			t.Errorf("Batch() invalid operation error = %v, want record.duration reported", outcomes[3].Err)
+		}
+		if len(repo.records) != 1 || repo.records[0].Duration != 30 {
+			t.Errorf("Batch() left records = %+v, want them untouched", repo.records)
+		}
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		outcomes, err := svc.Batch(testActor, testCalendar, &model.BatchRequest{Mode: model.BatchBestEffort, Operations: ops})
+		if err != nil {
+			t.Fatalf("Batch() error = %v", err)
+		}
+		if outcomes[0].Err != nil || outcomes[0].Record == nil || outcomes[1].Err != nil || outcomes[1].Record.Duration != 35 {
+			t.Errorf("Batch() successful operations = %+v, %+v", outcomes[0], outcomes[1])
+		}
+		if outcomes[2].Err == nil || outcomes[3].Err == nil {
+			t.Errorf("Batch() failing operations = %+v, %+v, want errors", outcomes[2], outcomes[3])
+		}
+		if len(repo.records) != 2 {
+			t.Errorf("Batch() records = %d, want the created one added", len(repo.records))
+		}
+	})
+
+	t.Run("operations see earlier ones", func(t *testing.T) {
+		record, _ := svc.GetByID(testUserID, existing.ID)
+		outcomes, err := svc.Batch(testActor, testCalendar, &model.BatchRequest{Operations: []model.BatchOperation{
+			{Op: "delete", ID: record.ID, Version: record.Version},
+			{Op: "delete", ID: record.ID},
+		}})
+		if err != nil {
+			t.Fatalf("Batch() error = %v", err)
+		}
+		if !errors.Is(outcomes[1].Err, ErrRecordNotFound) {
+			t.Errorf("Batch() second delete error = %v, want %v", outcomes[1].Err, ErrRecordNotFound)
+		}
+	})
+}
+
+func TestRecordService_BatchRejectsBadRequests(t *testing.T) {
+	svc := NewRecordService(newMockRepository(), newMockHabitRepository(), nil, 1)
+	tests := []struct {
+		name  string
+		req   model.BatchRequest
+		field string
+	}{
+		{"no operations", model.BatchRequest{}, "operations"},
+		{"unknown mode", model.BatchRequest{Mode: "some", Operations: []model.BatchOperation{{Op: "delete", ID: 1}}}, "mode"},
+		{"too many", model.BatchRequest{Operations: make([]model.BatchOperation, maxBatchOperations+1)}, "operations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Batch(testActor, testCalendar, &tt.req)
+			var errs *ValidationError
+			if !errors.As(err, &errs) || !errs.has(tt.field) {
+				t.Errorf("Batch() error = %v, want %s reported", err, tt.field)
+			}
+		})
+	}
+
+	outcomes, err := svc.Batch(testActor, testCalendar, &model.BatchRequest{Mode: model.BatchBestEffort, Operations: []model.BatchOperation{
+		{Op: "move", ID: 1},
+		{Op: "update", Record: &model.UpdateRecordRequest{}},
+		{Op: "create"},
+	}})
+	if err != nil {
+		t.Fatalf("Batch() error = %v", err)
+	}
+	for i, field := range []string{"op", "id", "record"} {
+		var fe *FieldError
+		if !errors.As(outcomes[i].Err, &fe) || fe.Field != field {
+			t.Errorf("Batch() operation %d error = %v, want %s reported", i, outcomes[i].Err, field)
+		}
+	}
+}
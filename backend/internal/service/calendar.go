@@ -0,0 +1,155 @@
+package service
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	// Embedded so that users' zones resolve in containers without tzdata.
+	_ "time/tzdata"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+	"habit-tracker/pkg/logger"
+)
+
+// CalendarService keeps users' time zone and week start settings and decides
+// which calendar each request is reckoned in.
+type CalendarService interface {
+	// Calendar returns the calendar for user's requests. A non-empty
+	// timezone overrides the user's own zone.
+	Calendar(user *model.User, timezone string) (*model.Calendar, error)
+	UpdateSettings(user *model.User, req *model.UpdateSettingsRequest) (*model.User, error)
+}
+
+type calendarService struct {
+	users     repository.UserRepository
+	defaults  model.Calendar
+	summaries bool
+}
+
+// NewCalendarService returns a service that falls back to defaults for users
+// who have not chosen their own settings. summaries tells whether the server
+// sends email, without which weekly summaries cannot be turned on.
+func NewCalendarService(users repository.UserRepository, defaults *model.Calendar, summaries bool) CalendarService {
+	return &calendarService{users: users, defaults: *defaults, summaries: summaries}
+}
+
+// maxEmailLength is the longest address SMTP can carry.
+const maxEmailLength = 254
+
+// ParseCalendar builds a calendar from an IANA zone name, or "Local" for the
+// server's zone, and a weekday name.
+func ParseCalendar(timezone, weekStart string) (*model.Calendar, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	day, ok := parseWeekday(weekStart)
+	if !ok {
+		return nil, fmt.Errorf("unknown weekday %q", weekStart)
+	}
+	return &model.Calendar{Location: loc, WeekStart: day}, nil
+}
+
+func (s *calendarService) Calendar(user *model.User, timezone string) (*model.Calendar, error) {
+	cal := s.defaults
+
+	if timezone != "" {
+		loc, err := userLocation(timezone)
+		if err != nil {
+			return nil, err
+		}
+		cal.Location = loc
+	} else if user != nil && user.Timezone != "" {
+		// Settings are validated when saved, so this only fails when the
+		// zone has since disappeared from the time zone database.
+		if loc, err := userLocation(user.Timezone); err == nil {
+			cal.Location = loc
+		} else {
+			logger.Error("Failed to load timezone of user %d: %v", user.ID, err)
+		}
+	}
+
+	if user != nil && user.WeekStart != "" {
+		if day, ok := parseWeekday(user.WeekStart); ok {
+			cal.WeekStart = day
+		}
+	}
+	return &cal, nil
+}
+
+func (s *calendarService) UpdateSettings(user *model.User, req *model.UpdateSettingsRequest) (*model.User, error) {
+	updated := *user
+	if req.Timezone != nil {
+		updated.Timezone = strings.TrimSpace(*req.Timezone)
+		if updated.Timezone != "" {
+			if _, err := userLocation(updated.Timezone); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if req.WeekStart != nil {
+		updated.WeekStart = strings.ToLower(strings.TrimSpace(*req.WeekStart))
+		if updated.WeekStart != "" {
+			if _, ok := parseWeekday(updated.WeekStart); !ok {
+				return nil, fieldError("weekStart", "invalid", "must be a day of the week, such as monday")
+			}
+		}
+	}
+	if req.Email != nil {
+		updated.Email = strings.TrimSpace(*req.Email)
+		if updated.Email != "" {
+			addr, err := mail.ParseAddress(updated.Email)
+			if err != nil || addr.Address != updated.Email || len(updated.Email) > maxEmailLength {
+				return nil, fieldError("email", "invalid", "must be an email address such as bob@example.com")
+			}
+		}
+	}
+	if req.WeeklySummary != nil {
+		updated.WeeklySummary = *req.WeeklySummary
+		if updated.WeeklySummary && !s.summaries {
+			return nil, fieldError("weeklySummary", "invalid", "cannot be turned on: this server does not send email")
+		}
+		if updated.WeeklySummary && updated.Email == "" {
+			return nil, fieldError("weeklySummary", "no_email", "needs an email address")
+		}
+	}
+
+	if err := s.users.UpdateSettings(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// userLocation loads an IANA zone named by a user. "Local", which would mean
+// whatever zone the server runs in, is refused.
+func userLocation(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, fieldError("timezone", "invalid", "%q is not a known time zone", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fieldError("timezone", "invalid", "%q is not a known time zone", name)
+	}
+	return loc, nil
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// today returns the date it is at now in cal.
+func today(cal *model.Calendar, now time.Time) model.Date {
+	return model.DateOf(now.In(cal.Location))
+}
+
+// startOfWeek returns the first day of the week that day falls in.
+func startOfWeek(day model.Date, weekStart time.Weekday) model.Date {
+	return day.AddDays(-((int(day.Weekday()) - int(weekStart) + 7) % 7))
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+func TestCalendarService_Calendar(t *testing.T) {
+	defaults, err := ParseCalendar("UTC", "sunday")
+	if err != nil {
+		t.Fatalf("ParseCalendar() error = %v", err)
+	}
+	svc := NewCalendarService(newMockUserRepository(), defaults, false)
+
+	tests := []struct {
+		name      string
+		user      *model.User
+		header    string
+		zone      string
+		weekStart time.Weekday
+	}{
+		{"defaults", &model.User{}, "", "UTC", time.Sunday},
+		{"user settings", &model.User{Timezone: "Asia/Shanghai", WeekStart: "monday"}, "", "Asia/Shanghai", time.Monday},
+		{"header overrides zone", &model.User{Timezone: "Asia/Shanghai", WeekStart: "monday"}, "America/New_York", "America/New_York", time.Monday},
+		{"vanished user zone", &model.User{Timezone: "Mars/Olympus_Mons"}, "", "UTC", time.Sunday},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cal, err := svc.Calendar(tt.user, tt.header)
+			if err != nil {
+				t.Fatalf("Calendar() error = %v", err)
+			}
+			if cal.Location.String() != tt.zone || cal.WeekStart != tt.weekStart {
+				t.Errorf("Calendar() = %s from %s, want %s from %s", cal.Location, cal.WeekStart, tt.zone, tt.weekStart)
+			}
+		})
+	}
+
+	for _, header := range []string{"Local", "Mars/Olympus_Mons"} {
+		if _, err := svc.Calendar(&model.User{}, header); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Calendar(%q) error = %v, want ErrInvalidInput", header, err)
+		}
+	}
+}
+
+func TestCalendarService_UpdateSettings(t *testing.T) {
+	users := newMockUserRepository()
+	user := &model.User{Username: "alice"}
+	users.Create(user)
+	svc := NewCalendarService(users, &model.Calendar{Location: time.UTC}, true)
+
+	zone, weekStart := "Europe/Berlin", " Monday "
+	updated, err := svc.UpdateSettings(user, &model.UpdateSettingsRequest{Timezone: &zone, WeekStart: &weekStart})
+	if err != nil {
+		t.Fatalf("UpdateSettings() error = %v", err)
+	}
+	if updated.Timezone != "Europe/Berlin" || updated.WeekStart != "monday" {
+		t.Errorf("UpdateSettings() = %+v, want Europe/Berlin from monday", updated)
+	}
+
+	reset := ""
+	updated, err = svc.UpdateSettings(updated, &model.UpdateSettingsRequest{Timezone: &reset})
+	if err != nil || updated.Timezone != "" || updated.WeekStart != "monday" {
+		t.Errorf("UpdateSettings() = %+v, %v, want the zone reset and the week start kept", updated, err)
+	}
+
+	email := " alice@example.com "
+	updated, err = svc.UpdateSettings(updated, &model.UpdateSettingsRequest{Email: &email})
+	if err != nil || updated.Email != "alice@example.com" || updated.WeekStart != "monday" {
+		t.Errorf("UpdateSettings() = %+v, %v, want the address set and the week start kept", updated, err)
+	}
+	on := true
+	updated, err = svc.UpdateSettings(updated, &model.UpdateSettingsRequest{WeeklySummary: &on})
+	if err != nil || !updated.WeeklySummary {
+		t.Errorf("UpdateSettings() = %+v, %v, want weekly summaries on", updated, err)
+	}
+	if _, err := svc.UpdateSettings(user, &model.UpdateSettingsRequest{WeeklySummary: &on}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("UpdateSettings(weeklySummary=true) without an address error = %v, want ErrInvalidInput", err)
+	}
+	withoutEmail := NewCalendarService(users, &model.Calendar{Location: time.UTC}, false)
+	if _, err := withoutEmail.UpdateSettings(updated, &model.UpdateSettingsRequest{WeeklySummary: &on}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("UpdateSettings(weeklySummary=true) on a server without email error = %v, want ErrInvalidInput", err)
+	}
+	for _, bad := range []string{"alice", "Alice <alice@example.com>", "alice@example.com, bob@example.com"} {
+		if _, err := svc.UpdateSettings(user, &model.UpdateSettingsRequest{Email: &bad}); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("UpdateSettings(email=%s) error = %v, want ErrInvalidInput", bad, err)
+		}
+	}
+
+	bad := "someday"
+	if _, err := svc.UpdateSettings(user, &model.UpdateSettingsRequest{WeekStart: &bad}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("UpdateSettings(weekStart=someday) error = %v, want ErrInvalidInput", err)
+	}
+	bad = "Nowhere/City"
+	if _, err := svc.UpdateSettings(user, &model.UpdateSettingsRequest{Timezone: &bad}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("UpdateSettings(timezone=Nowhere/City) error = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestStartOfWeek(t *testing.T) {
+	wednesday := model.NewDate(2024, 3, 13)
+	for weekStart, want := range map[time.Weekday]string{
+		time.Sunday:    "2024-03-10",
+		time.Monday:    "2024-03-11",
+		time.Wednesday: "2024-03-13",
+		time.Saturday:  "2024-03-09",
+	} {
+		if got := startOfWeek(wednesday, weekStart).String(); got != want {
+			t.Errorf("startOfWeek(%s) = %s, want %s", weekStart, got, want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+)
+
+var ErrGoalNotFound = errors.New("goal not found")
+
+// goalPeriodDays is the most days each goal period spans, which bounds the
+// minutes a duration goal can ask for.
+var goalPeriodDays = map[string]int{
+	model.GoalDaily:   1,
+	model.GoalWeekly:  7,
+	model.GoalMonthly: 31,
+}
+
+// maxGoalStartDays is how many days before today a goal may start, which
+// bounds the periods its progress is measured over.
+const maxGoalStartDays = 10 * 366
+
+type GoalService interface {
+	Create(userID int64, cal *model.Calendar, req *model.GoalRequest) (*model.Goal, error)
+	GetByID(userID, id int64) (*model.Goal, error)
+	GetAll(userID, habitID int64) ([]model.Goal, error)
+	Update(userID, id int64, cal *model.Calendar, req *model.GoalRequest) (*model.Goal, error)
+	Delete(userID, id int64) error
+	// Progress evaluates a goal from its start until today in cal.
+	Progress(userID, id int64, cal *model.Calendar) (*model.GoalProgress, error)
+}
+
+type goalService struct {
+	goals   repository.GoalRepository
+	habits  repository.HabitRepository
+	records repository.RecordRepository
+	now     func() time.Time
+}
+
+func NewGoalService(goals repository.GoalRepository, habits repository.HabitRepository, records repository.RecordRepository) GoalService {
+	return &goalService{goals: goals, habits: habits, records: records, now: time.Now}
+}
+
+func (s *goalService) Create(userID int64, cal *model.Calendar, req *model.GoalRequest) (*model.Goal, error) {
+	goal := &model.Goal{UserID: userID}
+	if err := s.apply(goal, cal, req); err != nil {
+		return nil, err
+	}
+	if err := s.goals.Create(goal); err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (s *goalService) GetByID(userID, id int64) (*model.Goal, error) {
+	goal, err := s.goals.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if goal == nil {
+		return nil, ErrGoalNotFound
+	}
+	return goal, nil
+}
+
+func (s *goalService) GetAll(userID, habitID int64) ([]model.Goal, error) {
+	goals, err := s.goals.GetAll(userID, habitID)
+	if err != nil {
+		return nil, err
+	}
+	if goals == nil {
+		return []model.Goal{}, nil
+	}
+	return goals, nil
+}
+
+func (s *goalService) Update(userID, id int64, cal *model.Calendar, req *model.GoalRequest) (*model.Goal, error) {
+	goal, err := s.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(goal, cal, req); err != nil {
+		return nil, err
+	}
+	if err := s.goals.Update(goal); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrGoalNotFound
+		}
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (s *goalService) Delete(userID, id int64) error {
+	if err := s.goals.Delete(userID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrGoalNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *goalService) Progress(userID, id int64, cal *model.Calendar) (*model.GoalProgress, error) {
+	goal, err := s.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	day := today(cal, s.now())
+	filter := &model.RecordFilter{HabitID: goal.HabitID, From: goal.StartDate.String(), To: day.String()}
+	if goal.EndDate != nil && goal.EndDate.Before(day) {
+		filter.To = goal.EndDate.String()
+	}
+	totals, err := s.records.GetDailyTotals(userID, filter)
+	if err != nil {
+		return nil, err
+	}
+	return EvaluateGoal(goal, totals, day, cal.WeekStart), nil
+}
+
+// checkGoalTarget adds what is wrong with the metric, period and target of req
+// to errs.
+func checkGoalTarget(errs *ValidationError, req *model.GoalRequest) {
+	if req.Metric != "" && req.Metric != model.GoalCount && req.Metric != model.GoalDuration {
+		errs.add(fieldError("metric", "invalid", "must be %s or %s", model.GoalCount, model.GoalDuration))
+	}
+	days, ok := goalPeriodDays[req.Period]
+	if req.Period != "" && !ok {
+		errs.add(fieldError("period", "invalid", "must be %s, %s or %s", model.GoalDaily, model.GoalWeekly, model.GoalMonthly))
+	}
+	if req.Metric == model.GoalDuration && ok && req.Target > days*24*60 && !errs.has("target") {
+		errs.add(fieldError("target", "too_large", "must be at most %d minutes for a %s goal", days*24*60, req.Period))
+	}
+}
+
+// apply validates req, reporting every invalid field at once, and copies it
+// into goal.
+func (s *goalService) apply(goal *model.Goal, cal *model.Calendar, req *model.GoalRequest) error {
+	errs := validateStruct(req)
+	checkGoalTarget(errs, req)
+
+	// A new goal starts today; a replaced one keeps its start unless given,
+	// and may keep it however long ago that has become.
+	day := today(cal, s.now())
+	start := goal.StartDate
+	if start.IsZero() {
+		start = day
+	}
+	if req.StartDate != "" {
+		date, err := model.ParseDate(req.StartDate)
+		switch {
+		case err != nil:
+			errs.add(fieldError("startDate", "invalid_date", "must be a calendar date written as YYYY-MM-DD"))
+		case (goal.StartDate.IsZero() || date != goal.StartDate) && tooEarlyGoalStart(date, day):
+			errs.add(fieldError("startDate", "out_of_range", "must be at most %d days before today", maxGoalStartDays))
+		default:
+			start = date
+		}
+	}
+	var end *model.Date
+	if req.EndDate != "" {
+		date, err := model.ParseDate(req.EndDate)
+		switch {
+		case err != nil:
+			errs.add(fieldError("endDate", "invalid_date", "must be a calendar date written as YYYY-MM-DD"))
+		case !errs.has("startDate") && date.Before(start):
+			errs.add(fieldError("endDate", "out_of_range", "must not be before startDate"))
+		default:
+			end = &date
+		}
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	habit, err := s.habits.GetByID(goal.UserID, req.HabitID)
+	if err != nil {
+		return err
+	}
+	if habit == nil {
+		return ErrHabitNotFound
+	}
+
+	goal.HabitID = habit.ID
+	goal.Metric = req.Metric
+	goal.Period = req.Period
+	goal.Target = req.Target
+	goal.StartDate = start
+	goal.EndDate = end
+	return nil
+}
+
+// tooEarlyGoalStart reports whether start is further back than a goal may
+// start as of today.
+func tooEarlyGoalStart(start, today model.Date) bool {
+	return start.Before(today.AddDays(-maxGoalStartDays))
+}
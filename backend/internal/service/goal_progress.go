@@ -0,0 +1,79 @@
+package service
+
+import (
+	"math"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+// EvaluateGoal measures goal against the daily totals of its habit as of
+// today. It is a pure function: totals may cover any dates, those outside
+// the goal are ignored, and weeks start on weekStart.
+func EvaluateGoal(goal *model.Goal, totals []model.DayTotal, today model.Date, weekStart time.Weekday) *model.GoalProgress {
+	progress := &model.GoalProgress{Goal: goal, Periods: []model.GoalPeriod{}}
+
+	last := today
+	if goal.EndDate != nil && goal.EndDate.Before(last) {
+		last = *goal.EndDate
+	}
+	if goal.StartDate.After(last) {
+		return progress
+	}
+
+	values := make(map[model.Date]int, len(totals))
+	for _, t := range totals {
+		if goal.Metric == model.GoalDuration {
+			values[t.Date] += t.Duration
+		} else {
+			values[t.Date] += t.Count
+		}
+	}
+
+	for start := goal.StartDate; !start.After(last); {
+		next := nextPeriod(goal.Period, start, weekStart)
+		end := next.AddDays(-1)
+		if goal.EndDate != nil && goal.EndDate.Before(end) {
+			end = *goal.EndDate
+		}
+
+		period := model.GoalPeriod{Start: start, End: end, Target: goal.Target, Finished: end.Before(today)}
+		for day := start; !day.After(end) && !day.After(today); day = day.AddDays(1) {
+			period.Value += values[day]
+		}
+		period.Met = period.Value >= goal.Target
+		period.Percent = math.Min(100, percent(period.Value, goal.Target))
+		progress.Periods = append(progress.Periods, period)
+
+		if period.Finished {
+			progress.Finished++
+			if period.Met {
+				progress.Met++
+			}
+		}
+		start = next
+	}
+
+	if progress.Finished > 0 {
+		progress.HitRate = percent(progress.Met, progress.Finished)
+	}
+	return progress
+}
+
+// nextPeriod returns the first day of the period after the one day is in.
+func nextPeriod(period string, day model.Date, weekStart time.Weekday) model.Date {
+	switch period {
+	case model.GoalWeekly:
+		return day.AddDays(7 - (int(day.Weekday())-int(weekStart)+7)%7)
+	case model.GoalMonthly:
+		t := day.Time()
+		return model.NewDate(t.Year(), t.Month()+1, 1)
+	default:
+		return day.AddDays(1)
+	}
+}
+
+// percent returns part as a percentage of whole, to one decimal place.
+func percent(part, whole int) float64 {
+	return math.Round(float64(part)*1000/float64(whole)) / 10
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+func dateRef(s string) *model.Date {
+	d := mustDate(s)
+	return &d
+}
+
+// periodValues summarizes periods as start, value and whether they are met
+// and finished, for compact expectations.
+type periodValue struct {
+	start    string
+	end      string
+	value    int
+	met      bool
+	finished bool
+}
+
+func periodValues(periods []model.GoalPeriod) []periodValue {
+	values := make([]periodValue, len(periods))
+	for i, p := range periods {
+		values[i] = periodValue{p.Start.String(), p.End.String(), p.Value, p.Met, p.Finished}
+	}
+	return values
+}
+
+func TestEvaluateGoal(t *testing.T) {
+	totals := []model.DayTotal{
+		{Date: mustDate("2024-01-28"), Count: 5, Duration: 300}, // before every goal
+		{Date: mustDate("2024-01-29"), Count: 1, Duration: 30},  // Monday
+		{Date: mustDate("2024-01-30"), Count: 2, Duration: 20},
+		{Date: mustDate("2024-02-01"), Count: 1, Duration: 45},
+		{Date: mustDate("2024-02-05"), Count: 1, Duration: 30}, // Monday
+		{Date: mustDate("2024-02-06"), Count: 1, Duration: 10},
+		{Date: mustDate("2024-02-08"), Count: 3, Duration: 90},
+	}
+
+	tests := []struct {
+		name      string
+		goal      model.Goal
+		today     string
+		weekStart time.Weekday
+		want      []periodValue
+		wantMet   int
+		wantRate  float64
+	}{
+		{
+			name:  "daily count",
+			goal:  model.Goal{Metric: model.GoalCount, Period: model.GoalDaily, Target: 1, StartDate: mustDate("2024-01-29")},
+			today: "2024-02-01",
+			want: []periodValue{
+				{"2024-01-29", "2024-01-29", 1, true, true},
+				{"2024-01-30", "2024-01-30", 2, true, true},
+				{"2024-01-31", "2024-01-31", 0, false, true},
+				{"2024-02-01", "2024-02-01", 1, true, false},
+			},
+			wantMet:  2,
+			wantRate: 66.7,
+		},
+		{
+			name:      "weekly duration from Monday",
+			goal:      model.Goal{Metric: model.GoalDuration, Period: model.GoalWeekly, Target: 90, StartDate: mustDate("2024-01-29")},
+			today:     "2024-02-08",
+			weekStart: time.Monday,
+			want: []periodValue{
+				{"2024-01-29", "2024-02-04", 95, true, true},
+				{"2024-02-05", "2024-02-11", 130, true, false},
+			},
+			wantMet:  1,
+			wantRate: 100,
+		},
+		{
+			name:      "weekly from Sunday starting mid-week",
+			goal:      model.Goal{Metric: model.GoalCount, Period: model.GoalWeekly, Target: 3, StartDate: mustDate("2024-01-30")},
+			today:     "2024-02-11",
+			weekStart: time.Sunday,
+			want: []periodValue{
+				{"2024-01-30", "2024-02-03", 3, true, true},
+				{"2024-02-04", "2024-02-10", 5, true, true},
+				{"2024-02-11", "2024-02-17", 0, false, false},
+			},
+			wantMet:  2,
+			wantRate: 100,
+		},
+		{
+			name:  "monthly across a year end",
+			goal:  model.Goal{Metric: model.GoalCount, Period: model.GoalMonthly, Target: 8, StartDate: mustDate("2023-12-15")},
+			today: "2024-03-01",
+			want: []periodValue{
+				{"2023-12-15", "2023-12-31", 0, false, true},
+				{"2024-01-01", "2024-01-31", 8, true, true},
+				{"2024-02-01", "2024-02-29", 6, false, true},
+				{"2024-03-01", "2024-03-31", 0, false, false},
+			},
+			wantMet:  1,
+			wantRate: 33.3,
+		},
+		{
+			name:  "end date cuts the last period",
+			goal:  model.Goal{Metric: model.GoalDuration, Period: model.GoalWeekly, Target: 60, StartDate: mustDate("2024-01-29"), EndDate: dateRef("2024-02-06")},
+			today: "2024-03-01",
+			want: []periodValue{
+				{"2024-01-29", "2024-02-03", 95, true, true},
+				{"2024-02-04", "2024-02-06", 40, false, true},
+			},
+			wantMet:  1,
+			wantRate: 50,
+		},
+		{
+			name:  "days after today are not counted",
+			goal:  model.Goal{Metric: model.GoalCount, Period: model.GoalMonthly, Target: 2, StartDate: mustDate("2024-02-01")},
+			today: "2024-02-05",
+			want: []periodValue{
+				{"2024-02-01", "2024-02-29", 2, true, false},
+			},
+		},
+		{
+			name:  "not started yet",
+			goal:  model.Goal{Metric: model.GoalCount, Period: model.GoalDaily, Target: 1, StartDate: mustDate("2024-03-01")},
+			today: "2024-02-08",
+			want:  []periodValue{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := EvaluateGoal(&tt.goal, totals, mustDate(tt.today), tt.weekStart)
+			if got := periodValues(progress.Periods); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateGoal() periods = %+v, want %+v", got, tt.want)
+			}
+			if progress.Met != tt.wantMet || progress.HitRate != tt.wantRate {
+				t.Errorf("EvaluateGoal() met = %d, hit rate = %v, want %d, %v", progress.Met, progress.HitRate, tt.wantMet, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestEvaluateGoal_Percent(t *testing.T) {
+	goal := &model.Goal{Metric: model.GoalDuration, Period: model.GoalDaily, Target: 30, StartDate: mustDate("2024-01-01")}
+	totals := []model.DayTotal{{Date: mustDate("2024-01-01"), Duration: 10}, {Date: mustDate("2024-01-02"), Duration: 45}}
+
+	progress := EvaluateGoal(goal, totals, mustDate("2024-01-03"), time.Sunday)
+	var got []float64
+	for _, p := range progress.Periods {
+		got = append(got, p.Percent)
+	}
+	if want := []float64{33.3, 100, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EvaluateGoal() percents = %v, want %v", got, want)
+	}
+	if progress.Finished != 2 || progress.HitRate != 50 {
+		t.Errorf("EvaluateGoal() finished = %d, hit rate = %v, want 2, 50", progress.Finished, progress.HitRate)
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type mockGoalRepository struct {
+	goals  []model.Goal
+	nextID int64
+}
+
+func newMockGoalRepository() *mockGoalRepository {
+	return &mockGoalRepository{nextID: 1}
+}
+
+func (m *mockGoalRepository) Create(goal *model.Goal) error {
+	goal.ID = m.nextID
+	m.nextID++
+	m.goals = append(m.goals, *goal)
+	return nil
+}
+
+func (m *mockGoalRepository) GetByID(userID, id int64) (*model.Goal, error) {
+	for _, g := range m.goals {
+		if g.ID == id && g.UserID == userID {
+			return &g, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockGoalRepository) GetAll(userID, habitID int64) ([]model.Goal, error) {
+	var goals []model.Goal
+	for _, g := range m.goals {
+		if g.UserID == userID && (habitID == 0 || g.HabitID == habitID) {
+			goals = append(goals, g)
+		}
+	}
+	return goals, nil
+}
+
+func (m *mockGoalRepository) Update(goal *model.Goal) error {
+	for i, g := range m.goals {
+		if g.ID == goal.ID && g.UserID == goal.UserID {
+			m.goals[i] = *goal
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockGoalRepository) Delete(userID, id int64) error {
+	for i, g := range m.goals {
+		if g.ID == id && g.UserID == userID {
+			m.goals = append(m.goals[:i], m.goals[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func newTestGoalService(now string) (*goalService, *mockRepository, int64) {
+	habits := newMockHabitRepository()
+	habits.Create(&model.Habit{UserID: testUserID, Name: "Running"})
+	records := newMockRepository()
+	svc := &goalService{goals: newMockGoalRepository(), habits: habits, records: records, now: func() time.Time {
+		return mustDate(now).Time().Add(12 * time.Hour)
+	}}
+	return svc, records, 1
+}
+
+func TestGoalService_CreateValidates(t *testing.T) {
+	svc, _, habitID := newTestGoalService("2024-02-10")
+
+	tests := []struct {
+		name string
+		req  model.GoalRequest
+		want map[string]string
+	}{
+		{
+			name: "missing fields",
+			req:  model.GoalRequest{},
+			want: map[string]string{"habitId": "required", "metric": "required", "period": "required", "target": "required"},
+		},
+		{
+			name: "unknown metric and period",
+			req:  model.GoalRequest{HabitID: habitID, Metric: "pages", Period: "yearly", Target: 1},
+			want: map[string]string{"metric": "invalid", "period": "invalid"},
+		},
+		{
+			name: "duration beyond the period",
+			req:  model.GoalRequest{HabitID: habitID, Metric: model.GoalDuration, Period: model.GoalWeekly, Target: 7*24*60 + 1},
+			want: map[string]string{"target": "too_large"},
+		},
+		{
+			name: "bad dates",
+			req:  model.GoalRequest{HabitID: habitID, Metric: model.GoalCount, Period: model.GoalDaily, Target: 1, StartDate: "2024-2-1", EndDate: "soon"},
+			want: map[string]string{"startDate": "invalid_date", "endDate": "invalid_date"},
+		},
+		{
+			name: "start too long ago",
+			req:  model.GoalRequest{HabitID: habitID, Metric: model.GoalCount, Period: model.GoalDaily, Target: 1, StartDate: "0001-01-01"},
+			want: map[string]string{"startDate": "out_of_range"},
+		},
+		{
+			name: "end before start",
+			req:  model.GoalRequest{HabitID: habitID, Metric: model.GoalCount, Period: model.GoalDaily, Target: 1, StartDate: "2024-02-01", EndDate: "2024-01-31"},
+			want: map[string]string{"endDate": "out_of_range"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Create(testUserID, testCalendar, &tt.req)
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Create() error = %v, want a ValidationError", err)
+			}
+			got := make(map[string]string)
+			for _, f := range verr.Fields {
+				got[f.Field] = f.Code
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Create() field errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	req := &model.GoalRequest{HabitID: habitID + 1, Metric: model.GoalCount, Period: model.GoalDaily, Target: 1}
+	if _, err := svc.Create(testUserID, testCalendar, req); !errors.Is(err, ErrHabitNotFound) {
+		t.Errorf("Create() for a missing habit error = %v, want %v", err, ErrHabitNotFound)
+	}
+	req.HabitID = habitID
+	if _, err := svc.Create(testUserID+1, testCalendar, req); !errors.Is(err, ErrHabitNotFound) {
+		t.Errorf("Create() for another user's habit error = %v, want %v", err, ErrHabitNotFound)
+	}
+}
+
+func TestGoalService_CRUD(t *testing.T) {
+	svc, _, habitID := newTestGoalService("2024-02-10")
+
+	goal, err := svc.Create(testUserID, testCalendar, &model.GoalRequest{HabitID: habitID, Metric: model.GoalCount, Period: model.GoalWeekly, Target: 3})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if goal.StartDate != mustDate("2024-02-10") || goal.EndDate != nil {
+		t.Errorf("Create() dates = %v, %v, want to start today with no end", goal.StartDate, goal.EndDate)
+	}
+
+	updated, err := svc.Update(testUserID, goal.ID, testCalendar, &model.GoalRequest{HabitID: habitID, Metric: model.GoalDuration, Period: model.GoalWeekly, Target: 120, EndDate: "2024-03-31"})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated.StartDate != goal.StartDate || updated.EndDate == nil || *updated.EndDate != mustDate("2024-03-31") || updated.Target != 120 {
+		t.Errorf("Update() = %+v, want the start kept and the end and target replaced", updated)
+	}
+
+	if goals, _ := svc.GetAll(testUserID, habitID+1); len(goals) != 0 {
+		t.Errorf("GetAll() of another habit = %+v, want none", goals)
+	}
+	if _, err := svc.GetByID(testUserID+1, goal.ID); !errors.Is(err, ErrGoalNotFound) {
+		t.Errorf("GetByID() by another user error = %v, want %v", err, ErrGoalNotFound)
+	}
+	if err := svc.Delete(testUserID, goal.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := svc.Delete(testUserID, goal.ID); !errors.Is(err, ErrGoalNotFound) {
+		t.Errorf("Delete() twice error = %v, want %v", err, ErrGoalNotFound)
+	}
+}
+
+func TestGoalService_Progress(t *testing.T) {
+	svc, records, habitID := newTestGoalService("2024-02-07")
+	for _, r := range []model.Record{
+		{UserID: testUserID, HabitID: habitID, Date: mustDate("2024-01-31"), Duration: 60}, // before the goal
+		{UserID: testUserID, HabitID: habitID, Date: mustDate("2024-02-01"), Duration: 40},
+		{UserID: testUserID, HabitID: habitID, Date: mustDate("2024-02-03"), Duration: 30},
+		{UserID: testUserID, HabitID: habitID + 1, Date: mustDate("2024-02-03"), Duration: 90}, // another habit
+		{UserID: testUserID, HabitID: habitID, Date: mustDate("2024-02-05"), Duration: 20},
+	} {
+		records.records = append(records.records, r)
+	}
+
+	goal, err := svc.Create(testUserID, testCalendar, &model.GoalRequest{HabitID: habitID, Metric: model.GoalDuration, Period: model.GoalWeekly, Target: 60, StartDate: "2024-02-01"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	progress, err := svc.Progress(testUserID, goal.ID, testCalendar)
+	if err != nil {
+		t.Fatalf("Progress() error = %v", err)
+	}
+	want := []periodValue{
+		{"2024-02-01", "2024-02-03", 70, true, true},
+		{"2024-02-04", "2024-02-10", 20, false, false},
+	}
+	if got := periodValues(progress.Periods); !reflect.DeepEqual(got, want) {
+		t.Errorf("Progress() periods = %+v, want %+v", got, want)
+	}
+	if progress.HitRate != 100 {
+		t.Errorf("Progress() hit rate = %v, want 100", progress.HitRate)
+	}
+
+	if _, err := svc.Progress(testUserID+1, goal.ID, testCalendar); !errors.Is(err, ErrGoalNotFound) {
+		t.Errorf("Progress() by another user error = %v, want %v", err, ErrGoalNotFound)
+	}
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+)
+
+var (
+	ErrHabitNotFound = errors.New("habit not found")
+	ErrHabitExists   = errors.New("habit already exists")
+	ErrHabitInUse    = errors.New("habit has records")
+
+	errMissingHabit = fieldError("content", "required", "is required when no habit is given")
+)
+
+// maxHabitName is the longest habit name the schema stores, in characters.
+const maxHabitName = 100
+
+type HabitService interface {
+	Create(userID int64, req *model.CreateHabitRequest) (*model.Habit, error)
+	GetByID(userID, id int64) (*model.Habit, error)
+	GetAll(userID int64, includeArchived bool) ([]model.Habit, error)
+	Update(userID, id int64, req *model.UpdateHabitRequest) (*model.Habit, error)
+	Delete(userID, id int64) error
+}
+
+type habitService struct {
+	repo repository.HabitRepository
+}
+
+func NewHabitService(repo repository.HabitRepository) HabitService {
+	return &habitService{repo: repo}
+}
+
+func (s *habitService) Create(userID int64, req *model.CreateHabitRequest) (*model.Habit, error) {
+	if err := validateHabit(validateStruct(req), req.Schedule); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fieldError("name", "required", "is required")
+	}
+
+	existing, err := s.repo.GetByName(userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrHabitExists
+	}
+
+	habit := &model.Habit{
+		UserID:   userID,
+		Name:     name,
+		Color:    req.Color,
+		Icon:     req.Icon,
+		Unit:     req.Unit,
+		Schedule: req.Schedule,
+	}
+
+	if err := s.repo.Create(habit); err != nil {
+		return nil, err
+	}
+
+	return habit, nil
+}
+
+func (s *habitService) GetByID(userID, id int64) (*model.Habit, error) {
+	habit, err := s.repo.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if habit == nil {
+		return nil, ErrHabitNotFound
+	}
+	return habit, nil
+}
+
+func (s *habitService) GetAll(userID int64, includeArchived bool) ([]model.Habit, error) {
+	habits, err := s.repo.GetAll(userID, includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	if habits == nil {
+		return []model.Habit{}, nil
+	}
+	return habits, nil
+}
+
+func (s *habitService) Update(userID, id int64, req *model.UpdateHabitRequest) (*model.Habit, error) {
+	if err := validateHabit(validateStruct(req), req.Schedule); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fieldError("name", "required", "is required")
+	}
+
+	existing, err := s.repo.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return nil, ErrHabitNotFound
+	}
+
+	clash, err := s.repo.GetByName(userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if clash != nil && clash.ID != id {
+		return nil, ErrHabitExists
+	}
+
+	existing.Name = name
+	existing.Color = req.Color
+	existing.Icon = req.Icon
+	existing.Unit = req.Unit
+	existing.Archived = req.Archived
+	existing.Schedule = req.Schedule
+
+	if err := s.repo.Update(existing); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// Delete removes a habit that has no records. Habits with history should be
+// archived instead so their records keep a valid reference.
+func (s *habitService) Delete(userID, id int64) error {
+	count, err := s.repo.CountRecords(userID, id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrHabitInUse
+	}
+
+	if err := s.repo.Delete(userID, id); err != nil {
+		return ErrHabitNotFound
+	}
+	return nil
+}
+
+// validateHabit adds the errors in a habit's schedule, if it has one, to
+// those already found in the request.
+func validateHabit(errs *ValidationError, schedule *model.Schedule) error {
+	if schedule != nil {
+		if err := normalizeSchedule(schedule); err != nil {
+			errs.add(within("schedule", err))
+		}
+	}
+	return errs.err()
+}
+
+// resolveHabit returns the habit a record belongs to: the one referenced by
+// habitID, or otherwise the habit named after content, created on first use.
+func resolveHabit(repo repository.HabitRepository, userID, habitID int64, content string) (*model.Habit, error) {
+	if habitID != 0 {
+		habit, err := repo.GetByID(userID, habitID)
+		if err != nil {
+			return nil, err
+		}
+		if habit == nil {
+			return nil, ErrHabitNotFound
+		}
+		return habit, nil
+	}
+
+	name := strings.TrimSpace(content)
+	if name == "" {
+		return nil, errMissingHabit
+	}
+	if utf8.RuneCountInString(name) > maxHabitName {
+		return nil, fieldError("content", "too_long", "must be at most %d characters to name a new habit", maxHabitName)
+	}
+
+	habit, err := repo.GetByName(userID, name)
+	if err != nil {
+		return nil, err
+	}
+	if habit != nil {
+		return habit, nil
+	}
+
+	habit = &model.Habit{UserID: userID, Name: name}
+	if err := repo.Create(habit); err != nil {
+		return nil, err
+	}
+	return habit, nil
+}
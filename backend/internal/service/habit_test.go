@@ -0,0 +1,190 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"habit-tracker/internal/model"
+)
+
+type mockHabitRepository struct {
+	habits       []model.Habit
+	recordCounts map[int64]int
+	nextID       int64
+}
+
+func newMockHabitRepository() *mockHabitRepository {
+	return &mockHabitRepository{
+		habits:       []model.Habit{},
+		recordCounts: map[int64]int{},
+		nextID:       1,
+	}
+}
+
+func (m *mockHabitRepository) Create(habit *model.Habit) error {
+	habit.ID = m.nextID
+	m.nextID++
+	m.habits = append(m.habits, *habit)
+	return nil
+}
+
+func (m *mockHabitRepository) GetByID(userID, id int64) (*model.Habit, error) {
+	for _, h := range m.habits {
+		if h.ID == id && h.UserID == userID {
+			return &h, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockHabitRepository) GetByName(userID int64, name string) (*model.Habit, error) {
+	for _, h := range m.habits {
+		if h.UserID == userID && strings.EqualFold(h.Name, strings.TrimSpace(name)) {
+			return &h, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockHabitRepository) GetAll(userID int64, includeArchived bool) ([]model.Habit, error) {
+	var habits []model.Habit
+	for _, h := range m.habits {
+		if h.UserID == userID && (includeArchived || !h.Archived) {
+			habits = append(habits, h)
+		}
+	}
+	return habits, nil
+}
+
+func (m *mockHabitRepository) Update(habit *model.Habit) error {
+	for i, h := range m.habits {
+		if h.ID == habit.ID && h.UserID == habit.UserID {
+			m.habits[i] = *habit
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *mockHabitRepository) Delete(userID, id int64) error {
+	for i, h := range m.habits {
+		if h.ID == id && h.UserID == userID {
+			m.habits = append(m.habits[:i], m.habits[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("not found")
+}
+
+func (m *mockHabitRepository) CountRecords(userID, id int64) (int, error) {
+	return m.recordCounts[id], nil
+}
+
+func TestHabitService_Create(t *testing.T) {
+	svc := NewHabitService(newMockHabitRepository())
+
+	if _, err := svc.Create(testUserID, &model.CreateHabitRequest{Name: "Reading", Unit: "pages"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		req     *model.CreateHabitRequest
+		wantErr error
+	}{
+		{name: "blank name", req: &model.CreateHabitRequest{Name: "  "}, wantErr: ErrInvalidInput},
+		{name: "duplicate name", req: &model.CreateHabitRequest{Name: "reading "}, wantErr: ErrHabitExists},
+		{name: "new habit", req: &model.CreateHabitRequest{Name: "Running"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Create(testUserID, tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHabitService_Schedule(t *testing.T) {
+	svc := NewHabitService(newMockHabitRepository())
+
+	_, err := svc.Create(testUserID, &model.CreateHabitRequest{Name: "", Schedule: &model.Schedule{Frequency: "weekly", Weekdays: []string{"someday"}}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 2 || verr.Fields[0].Field != "name" || verr.Fields[1].Field != "schedule.weekdays[0]" {
+		t.Fatalf("Create() error = %v, want errors in name and schedule.weekdays[0]", err)
+	}
+
+	habit, err := svc.Create(testUserID, &model.CreateHabitRequest{Name: "Gym", Schedule: &model.Schedule{Frequency: "weekly", Weekdays: []string{"Friday", "Monday"}}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if want := []string{"monday", "friday"}; !reflect.DeepEqual(habit.Schedule.Weekdays, want) || habit.Schedule.Interval != 1 {
+		t.Errorf("Create() schedule = %+v, want weekdays %v every week", habit.Schedule, want)
+	}
+
+	updated, err := svc.Update(testUserID, habit.ID, &model.UpdateHabitRequest{Name: "Gym"})
+	if err != nil || updated.Schedule != nil {
+		t.Errorf("Update() without a schedule = %+v, %v, want the schedule cleared", updated, err)
+	}
+}
+
+func TestHabitService_FieldLengths(t *testing.T) {
+	svc := NewHabitService(newMockHabitRepository())
+
+	habit, err := svc.Create(testUserID, &model.CreateHabitRequest{Name: "Reading", Color: "#aabbcc", Icon: strings.Repeat("📖", 50), Unit: strings.Repeat("页", 20)})
+	if err != nil {
+		t.Fatalf("Create() at the length limits error = %v", err)
+	}
+
+	_, err = svc.Update(testUserID, habit.ID, &model.UpdateHabitRequest{
+		Name: "Reading", Color: strings.Repeat("a", 21), Icon: strings.Repeat("b", 51), Unit: strings.Repeat("c", 21),
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 3 {
+		t.Fatalf("Update() error = %v, want errors in color, icon and unit", err)
+	}
+	for i, field := range []string{"color", "icon", "unit"} {
+		if verr.Fields[i].Field != field || verr.Fields[i].Code != "too_long" {
+			t.Errorf("Update() error %d = %+v, want %s too_long", i, verr.Fields[i], field)
+		}
+	}
+}
+
+func TestHabitService_Delete(t *testing.T) {
+	repo := newMockHabitRepository()
+	svc := NewHabitService(repo)
+
+	used, _ := svc.Create(testUserID, &model.CreateHabitRequest{Name: "Running"})
+	unused, _ := svc.Create(testUserID, &model.CreateHabitRequest{Name: "Yoga"})
+	repo.recordCounts[used.ID] = 3
+
+	if err := svc.Delete(testUserID, used.ID); !errors.Is(err, ErrHabitInUse) {
+		t.Errorf("Delete() used habit error = %v, want %v", err, ErrHabitInUse)
+	}
+	if err := svc.Delete(testUserID, unused.ID); err != nil {
+		t.Errorf("Delete() unused habit error = %v", err)
+	}
+	if err := svc.Delete(testUserID, unused.ID); !errors.Is(err, ErrHabitNotFound) {
+		t.Errorf("Delete() missing habit error = %v, want %v", err, ErrHabitNotFound)
+	}
+}
+
+func TestHabitService_NamesArePerUser(t *testing.T) {
+	svc := NewHabitService(newMockHabitRepository())
+
+	if _, err := svc.Create(testUserID, &model.CreateHabitRequest{Name: "Reading"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := svc.Create(testUserID+1, &model.CreateHabitRequest{Name: "Reading"}); err != nil {
+		t.Errorf("Create() same name for another user error = %v", err)
+	}
+
+	habits, _ := svc.GetAll(testUserID+1, false)
+	if len(habits) != 1 {
+		t.Errorf("GetAll() returned %d habits, want 1", len(habits))
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import "habit-tracker/internal/model"
+
+// History returns the revisions of one of the user's records, oldest first,
+// each with the fields it changed.
+func (s *recordService) History(userID, id int64) ([]model.RecordRevision, error) {
+	revisions, err := s.repo.ListRevisions(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		// Records last written before revisions were kept have none yet.
+		if _, err := s.GetByID(userID, id); err != nil {
+			return nil, err
+		}
+		return []model.RecordRevision{}, nil
+	}
+
+	for i := range revisions {
+		revisions[i].Changes = diffSnapshots(revisions[i].Before, revisions[i].After)
+	}
+	return revisions, nil
+}
+
+var snapshotFields = []string{"habitId", "date", "content", "duration", "notes", "deletedAt"}
+
+// diffSnapshots lists the fields that differ between two states of a
+// record. A missing state, before a create or after a delete, has no values,
+// so every field that is set differs from it.
+func diffSnapshots(before, after *model.RecordSnapshot) []model.FieldChange {
+	b, a := snapshotValues(before), snapshotValues(after)
+	changes := []model.FieldChange{}
+	for i, field := range snapshotFields {
+		if b[i] != a[i] {
+			changes = append(changes, model.FieldChange{Field: field, Before: b[i], After: a[i]})
+		}
+	}
+	return changes
+}
+
+func snapshotValues(s *model.RecordSnapshot) []interface{} {
+	if s == nil {
+		return make([]interface{}, len(snapshotFields))
+	}
+	var deletedAt interface{}
+	if s.DeletedAt != nil {
+		deletedAt = s.DeletedAt.UTC()
+	}
+	return []interface{}{s.HabitID, s.Date.String(), s.Content, s.Duration, s.Notes, deletedAt}
+}
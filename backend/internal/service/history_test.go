@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+func TestRecordService_History(t *testing.T) {
+	svc := &recordService{repo: newMockRepository(), habits: newMockHabitRepository(), maxFutureDays: 1, now: time.Now}
+	record, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	keyActor := &model.Actor{UserID: testUserID, APIKeyID: 7, RequestID: "patch-request"}
+	if _, err := svc.Patch(keyActor, record.ID, 0, testCalendar, []byte(`{"duration":45,"notes":"hard"}`)); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if err := svc.Delete(testActor, record.ID, 0); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := svc.Restore(testActor, record.ID); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	history, err := svc.History(testUserID, record.ID)
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	var actions []string
+	for _, rev := range history {
+		actions = append(actions, rev.Action)
+	}
+	if want := []string{"create", "update", "delete", "restore"}; !reflect.DeepEqual(actions, want) {
+		t.Fatalf("History() actions = %v, want %v", actions, want)
+	}
+
+	update := history[1]
+	if update.APIKeyID != 7 || update.RequestID != "patch-request" || update.Version != 2 {
+		t.Errorf("History() update actor = key %d, request %q, version %d, want key 7, patch-request, version 2", update.APIKeyID, update.RequestID, update.Version)
+	}
+	wantChanges := []model.FieldChange{
+		{Field: "duration", Before: 30, After: 45},
+		{Field: "notes", Before: "", After: "hard"},
+	}
+	if !reflect.DeepEqual(update.Changes, wantChanges) {
+		t.Errorf("History() update changes = %+v, want %+v", update.Changes, wantChanges)
+	}
+	if len(history[0].Changes) != len(snapshotFields)-1 || history[0].Changes[2].Before != nil {
+		t.Errorf("History() create changes = %+v, want every field but deletedAt set from nothing", history[0].Changes)
+	}
+	if history[2].After != nil || history[2].Before.Duration != 45 {
+		t.Errorf("History() delete = %+v, want the final state before and nothing after", history[2])
+	}
+	restore := history[3]
+	if restore.Before == nil || restore.Before.DeletedAt == nil || len(restore.Changes) != 1 || restore.Changes[0].Field != "deletedAt" || restore.Changes[0].After != nil {
+		t.Errorf("History() restore = %+v, want the trashed state before and only deletedAt cleared", restore)
+	}
+
+	if _, err := svc.History(testUserID+1, record.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("History() of another user's record error = %v, want %v", err, ErrRecordNotFound)
+	}
+}
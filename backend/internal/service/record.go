@@ -1,55 +1,136 @@
 package service
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"habit-tracker/internal/model"
 	"habit-tracker/internal/repository"
+	"habit-tracker/pkg/logger"
 )
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrInvalidInput   = errors.New("invalid input")
+	ErrRecordModified = errors.New("record has been modified")
 )
 
 type RecordService interface {
-	Create(req *model.CreateRecordRequest) (*model.Record, error)
-	GetByID(id int64) (*model.Record, error)
-	GetAll() ([]model.Record, error)
-	Update(id int64, req *model.UpdateRecordRequest) (*model.Record, error)
-	Delete(id int64) error
-	GetStats() (*model.Stats, error)
+	// Writes are made by actor, who is kept in the record's history.
+	Create(actor *model.Actor, cal *model.Calendar, req *model.CreateRecordRequest) (*model.Record, error)
+	GetByID(userID, id int64) (*model.Record, error)
+	List(userID int64, filter *model.RecordFilter) (*model.RecordPage, error)
+	// Update, Patch and Delete take the version of the record the change is
+	// based on, failing with ErrRecordModified when the record has moved on
+	// since. Version 0 accepts any version.
+	Update(actor *model.Actor, id, version int64, cal *model.Calendar, req *model.UpdateRecordRequest) (*model.Record, error)
+	Patch(actor *model.Actor, id, version int64, cal *model.Calendar, patch []byte) (*model.Record, error)
+	Delete(actor *model.Actor, id, version int64) error
+	// Deleted records go to the trash, from which Restore takes them back
+	// until PurgeTrash removes them for good. PurgeTrash publishes no
+	// events: record.deleted was published when the records were trashed.
+	ListTrash(userID int64) ([]model.Record, error)
+	Restore(actor *model.Actor, id int64) (*model.Record, error)
+	PurgeTrash(retention time.Duration) error
+	// History lists the revisions of a record, live or in the trash, oldest
+	// first.
+	History(userID, id int64) ([]model.RecordRevision, error)
+	GetStats(userID int64, cal *model.Calendar) (*model.Stats, error)
+	Export(userID int64, filter *model.RecordFilter, fn func(record *model.Record, habit string) error) error
+	Import(actor *model.Actor, cal *model.Calendar, rows []model.ImportRow) (*model.ImportResult, error)
+	// Batch applies several creates, updates and deletes in one transaction,
+	// returning the outcome of each in order.
+	Batch(actor *model.Actor, cal *model.Calendar, req *model.BatchRequest) ([]BatchOutcome, error)
+}
+
+// EventPublisher is told about writes once they have been made, to pass
+// them on to webhooks.
+type EventPublisher interface {
+	Publish(userID int64, event string, data interface{}) error
 }
 
 type recordService struct {
-	repo repository.RecordRepository
+	repo   repository.RecordRepository
+	habits repository.HabitRepository
+	events EventPublisher
+	// maxFutureDays is how far past the user's today a record may be dated.
+	maxFutureDays int
+	now           func() time.Time
+}
+
+// NewRecordService returns a service that publishes the record events to
+// events, which may be nil.
+func NewRecordService(repo repository.RecordRepository, habits repository.HabitRepository, events EventPublisher, maxFutureDays int) RecordService {
+	return &recordService{repo: repo, habits: habits, events: events, maxFutureDays: maxFutureDays, now: time.Now}
+}
+
+func (s *recordService) Create(actor *model.Actor, cal *model.Calendar, req *model.CreateRecordRequest) (*model.Record, error) {
+	record, err := s.create(s.repo, s.habits, actor, cal, req)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(model.EventRecordCreated, record)
+	return record, nil
+}
+
+// publish reports records that have been written. The write stands whether
+// or not its event can be queued, so failures are only logged.
+func (s *recordService) publish(event string, records ...*model.Record) {
+	publishRecords(s.events, event, records...)
 }
 
-func NewRecordService(repo repository.RecordRepository) RecordService {
-	return &recordService{repo: repo}
+// publishRecords is publish for any service holding an EventPublisher,
+// which may be nil.
+func publishRecords(events EventPublisher, event string, records ...*model.Record) {
+	if events == nil {
+		return
+	}
+	for _, record := range records {
+		if err := events.Publish(record.UserID, event, &model.RecordEvent{Record: record}); err != nil {
+			logger.Error("Failed to publish %s for record %d: %v", event, record.ID, err)
+		}
+	}
 }
 
-func (s *recordService) Create(req *model.CreateRecordRequest) (*model.Record, error) {
-	if req.Date == "" || req.Content == "" || req.Duration < 1 {
-		return nil, ErrInvalidInput
+// create, update, current and save write through records and habits, which
+// are either the repositories or a batch transaction.
+func (s *recordService) create(records repository.RecordWriter, habits repository.HabitRepository, actor *model.Actor, cal *model.Calendar, req *model.CreateRecordRequest) (*model.Record, error) {
+	date, err := s.checkRequest(req, req.Date, cal)
+	if err != nil {
+		return nil, err
+	}
+
+	habit, err := resolveHabit(habits, actor.UserID, req.HabitID, req.Content)
+	if err != nil {
+		return nil, err
 	}
 
 	record := &model.Record{
-		Date:     req.Date,
-		Content:  req.Content,
+		UserID:   actor.UserID,
+		HabitID:  habit.ID,
+		Date:     date,
+		Content:  recordContent(req.Content, habit),
 		Duration: req.Duration,
 		Notes:    req.Notes,
 	}
 
-	if err := s.repo.Create(record); err != nil {
+	if err := records.Create(actor, record); err != nil {
 		return nil, err
 	}
 
 	return record, nil
 }
 
-func (s *recordService) GetByID(id int64) (*model.Record, error) {
-	record, err := s.repo.GetByID(id)
+func (s *recordService) GetByID(userID, id int64) (*model.Record, error) {
+	record, err := s.repo.GetByID(userID, id)
 	if err != nil {
 		return nil, err
 	}
@@ -59,49 +140,456 @@ func (s *recordService) GetByID(id int64) (*model.Record, error) {
 	return record, nil
 }
 
-func (s *recordService) GetAll() ([]model.Record, error) {
-	records, err := s.repo.GetAll()
+const (
+	defaultRecordLimit = 50
+	maxRecordLimit     = 500
+)
+
+// List returns one page of records matching filter together with the total
+// number of matches and, when more remain, the cursor of the next page.
+func (s *recordService) List(userID int64, filter *model.RecordFilter) (*model.RecordPage, error) {
+	if err := normalizeRecordFilter(filter); err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	query := *filter
+	query.Limit = filter.Limit + 1
+	records, err := s.repo.List(userID, &query)
 	if err != nil {
 		return nil, err
 	}
-	if records == nil {
-		return []model.Record{}, nil
+
+	total, err := s.repo.Count(userID, filter)
+	if err != nil {
+		return nil, err
 	}
-	return records, nil
+
+	page := &model.RecordPage{Items: records, Total: total}
+	if len(records) > filter.Limit {
+		page.Items = records[:filter.Limit]
+		page.NextCursor = encodeRecordCursor(filter.Sort, &page.Items[filter.Limit-1])
+	}
+	if page.Items == nil {
+		page.Items = []model.Record{}
+	}
+	return page, nil
 }
 
-func (s *recordService) Update(id int64, req *model.UpdateRecordRequest) (*model.Record, error) {
-	if req.Date == "" || req.Content == "" || req.Duration < 1 {
-		return nil, ErrInvalidInput
+func normalizeRecordFilter(filter *model.RecordFilter) error {
+	if filter.Sort == "" {
+		filter.Sort = "date"
+	}
+	if filter.Order == "" {
+		filter.Order = "desc"
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultRecordLimit
 	}
 
-	existing, err := s.repo.GetByID(id)
+	switch {
+	case filter.Sort != "date" && filter.Sort != "duration" && filter.Sort != "content":
+		return fieldError("sort", "invalid", "must be date, duration or content")
+	case filter.Order != "asc" && filter.Order != "desc":
+		return fieldError("order", "invalid", "must be asc or desc")
+	case filter.Limit < 1 || filter.Limit > maxRecordLimit:
+		return fieldError("limit", "out_of_range", "must be between 1 and %d", maxRecordLimit)
+	case filter.MinDuration < 0:
+		return fieldError("minDuration", "too_small", "must not be negative")
+	case filter.MaxDuration < 0:
+		return fieldError("maxDuration", "too_small", "must not be negative")
+	case filter.MaxDuration > 0 && filter.MinDuration > filter.MaxDuration:
+		return fieldError("minDuration", "out_of_range", "must not be greater than maxDuration")
+	}
+
+	for _, d := range []struct{ field, value string }{{"from", filter.From}, {"to", filter.To}} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := model.ParseDate(d.value); err != nil {
+			return fieldError(d.field, "invalid_date", "must be a calendar date written as YYYY-MM-DD")
+		}
+	}
+	if filter.From != "" && filter.To != "" && filter.From > filter.To {
+		return fieldError("from", "out_of_range", "must not be after to")
+	}
+
+	if filter.After != "" {
+		cursor, err := decodeRecordCursor(filter.After, filter.Sort)
+		if err != nil {
+			return fieldError("after", "invalid", "is not a cursor of this listing")
+		}
+		filter.Cursor = cursor
+	}
+	return nil
+}
+
+func encodeRecordCursor(sort string, last *model.Record) string {
+	cursor := model.RecordCursor{Sort: sort, ID: last.ID}
+	switch sort {
+	case "duration":
+		cursor.Value = last.Duration
+	case "content":
+		cursor.Value = last.Content
+	default:
+		cursor.Value = last.Date.String()
+	}
+
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeRecordCursor(after, sort string) (*model.RecordCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor model.RecordCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Sort != sort {
+		return nil, errors.New("cursor was issued for a different sort")
+	}
+
+	switch v := cursor.Value.(type) {
+	case float64:
+		if sort != "duration" {
+			return nil, errors.New("cursor value has wrong type")
+		}
+		cursor.Value = int(v)
+	case string:
+		if sort == "duration" {
+			return nil, errors.New("cursor value has wrong type")
+		}
+	default:
+		return nil, errors.New("cursor value has wrong type")
+	}
+	return &cursor, nil
+}
+
+func (s *recordService) Update(actor *model.Actor, id, version int64, cal *model.Calendar, req *model.UpdateRecordRequest) (*model.Record, error) {
+	record, err := s.update(s.repo, s.habits, actor, id, version, cal, req)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(model.EventRecordUpdated, record)
+	return record, nil
+}
+
+func (s *recordService) update(records repository.RecordWriter, habits repository.HabitRepository, actor *model.Actor, id, version int64, cal *model.Calendar, req *model.UpdateRecordRequest) (*model.Record, error) {
+	date, err := s.checkRequest(req, req.Date, cal)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := current(records, actor.UserID, id, version)
+	if err != nil {
+		return nil, err
+	}
+	return save(records, habits, actor, existing, date, req)
+}
+
+// Patch applies a JSON Merge Patch (RFC 7386) to a record: fields in patch
+// replace the record's, null removes them, and the rest are kept. The merged
+// record is validated like an update.
+func (s *recordService) Patch(actor *model.Actor, id, version int64, cal *model.Calendar, patch []byte) (*model.Record, error) {
+	var changes map[string]interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return nil, fmt.Errorf("%w: patch must be a JSON object", ErrInvalidInput)
+	}
+
+	existing, err := current(s.repo, actor.UserID, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := patchedRequest(existing, changes)
+	if err != nil {
+		return nil, err
+	}
+	date, err := s.checkRequest(req, req.Date, cal)
+	if err != nil {
+		return nil, err
+	}
+	record, err := save(s.repo, s.habits, actor, existing, date, req)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(model.EventRecordUpdated, record)
+	return record, nil
+}
+
+// patchedRequest merges changes into the update request that would leave
+// existing as it is.
+func patchedRequest(existing *model.Record, changes map[string]interface{}) (*model.UpdateRecordRequest, error) {
+	current, err := json.Marshal(&model.UpdateRecordRequest{
+		HabitID:  existing.HabitID,
+		Date:     existing.Date.String(),
+		Content:  existing.Content,
+		Duration: existing.Duration,
+		Notes:    existing.Notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(current, &doc); err != nil {
+		return nil, err
+	}
+	merged, err := json.Marshal(mergePatch(doc, changes))
+	if err != nil {
+		return nil, err
+	}
+
+	var req model.UpdateRecordRequest
+	if err := json.Unmarshal(merged, &req); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, fieldError(typeErr.Field, "invalid", "must be a %s", jsonKind(typeErr.Type.Kind()))
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+// mergePatch applies patch to target as RFC 7386 describes.
+func mergePatch(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]interface{})
+	if !ok {
+		doc = make(map[string]interface{})
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(doc, key)
+		} else {
+			doc[key] = mergePatch(doc[key], value)
+		}
+	}
+	return doc
+}
+
+func jsonKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "whole number"
+	default:
+		return kind.String()
+	}
+}
+
+// current loads the record a change is based on, checking it is still at
+// version unless version is 0.
+func current(records repository.RecordWriter, userID, id, version int64) (*model.Record, error) {
+	existing, err := records.GetByID(userID, id)
 	if err != nil {
 		return nil, err
 	}
 	if existing == nil {
 		return nil, ErrRecordNotFound
 	}
+	if version != 0 && existing.Version != version {
+		return nil, ErrRecordModified
+	}
+	return existing, nil
+}
 
-	existing.Date = req.Date
-	existing.Content = req.Content
+// save applies a validated update to existing and stores it, provided no
+// other write got there first.
+func save(records repository.RecordWriter, habits repository.HabitRepository, actor *model.Actor, existing *model.Record, date model.Date, req *model.UpdateRecordRequest) (*model.Record, error) {
+	habit, err := resolveHabit(habits, actor.UserID, req.HabitID, req.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	existing.HabitID = habit.ID
+	existing.Date = date
+	existing.Content = recordContent(req.Content, habit)
 	existing.Duration = req.Duration
 	existing.Notes = req.Notes
 
-	if err := s.repo.Update(existing); err != nil {
-		return nil, err
+	if err := records.Update(actor, existing); err != nil {
+		return nil, recordWriteError(err)
 	}
 
 	return existing, nil
 }
 
-func (s *recordService) Delete(id int64) error {
-	if err := s.repo.Delete(id); err != nil {
-		return ErrRecordNotFound
+// Delete loads the record first, for the record.deleted event.
+func (s *recordService) Delete(actor *model.Actor, id, version int64) error {
+	existing, err := current(s.repo, actor.UserID, id, version)
+	if err != nil {
+		return err
+	}
+	// Delete the version that was read, so that the event describes the
+	// record that went to the trash.
+	if err := s.repo.Delete(actor, id, existing.Version); err != nil {
+		return recordWriteError(err)
 	}
+	s.publish(model.EventRecordDeleted, existing)
 	return nil
 }
 
-func (s *recordService) GetStats() (*model.Stats, error) {
-	return s.repo.GetStats()
+// recordWriteError translates the ways a versioned write can miss its record.
+func recordWriteError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrRecordNotFound
+	case errors.Is(err, repository.ErrStaleVersion):
+		return ErrRecordModified
+	}
+	return err
+}
+
+// GetStats counts this week's and this month's records as of today in cal.
+func (s *recordService) GetStats(userID int64, cal *model.Calendar) (*model.Stats, error) {
+	day := today(cal, s.now())
+	monthStart := model.NewDate(day.Time().Year(), day.Time().Month(), 1)
+	return s.repo.GetStats(userID, startOfWeek(day, cal.WeekStart).String(), monthStart.String())
+}
+
+// Export calls fn for every record matching filter together with the name of
+// its habit. The filter's cursor and limit are ignored.
+func (s *recordService) Export(userID int64, filter *model.RecordFilter, fn func(record *model.Record, habit string) error) error {
+	query := *filter
+	query.After, query.Limit = "", 0
+	if err := normalizeRecordFilter(&query); err != nil {
+		return err
+	}
+	query.Limit = 0
+
+	habits, err := s.habits.GetAll(userID, true)
+	if err != nil {
+		return err
+	}
+	names := make(map[int64]string, len(habits))
+	for _, h := range habits {
+		names[h.ID] = h.Name
+	}
+
+	return s.repo.Stream(userID, &query, func(record *model.Record) error {
+		return fn(record, names[record.HabitID])
+	})
+}
+
+// Import validates every row with the rules of Create and, when all of them
+// pass, writes them in one transaction. Otherwise nothing is written and the
+// result lists the errors of each failing row.
+func (s *recordService) Import(actor *model.Actor, cal *model.Calendar, rows []model.ImportRow) (*model.ImportResult, error) {
+	result := &model.ImportResult{Errors: []model.ImportError{}}
+	records := make([]model.ImportedRecord, 0, len(rows))
+	for _, row := range rows {
+		record, err := s.importedRecord(row, cal)
+		if err != nil {
+			result.Errors = append(result.Errors, model.ImportError{Line: row.Line, Error: err.Error()})
+			continue
+		}
+		records = append(records, *record)
+	}
+
+	if len(result.Errors) > 0 || len(records) == 0 {
+		return result, nil
+	}
+
+	if err := s.repo.Import(actor, records); err != nil {
+		return nil, err
+	}
+	for i := range records {
+		s.publish(model.EventRecordCreated, &records[i].Record)
+	}
+	result.Imported = len(records)
+	return result, nil
+}
+
+// importedRecord converts a CSV row the way Create treats a request: the
+// habit is named by the habit column, falling back to the content.
+func (s *recordService) importedRecord(row model.ImportRow, cal *model.Calendar) (*model.ImportedRecord, error) {
+	duration, err := strconv.Atoi(strings.TrimSpace(row.Duration))
+	if err != nil {
+		return nil, fieldError("duration", "invalid", "must be a whole number")
+	}
+	req := &model.CreateRecordRequest{Date: strings.TrimSpace(row.Date), Content: row.Content, Duration: duration, Notes: row.Notes}
+	date, err := s.checkRequest(req, req.Date, cal)
+	if err != nil {
+		return nil, err
+	}
+
+	name, field := strings.TrimSpace(row.Habit), "habit"
+	if name == "" {
+		name, field = strings.TrimSpace(row.Content), "content"
+	}
+	if name == "" {
+		return nil, errMissingHabit
+	}
+	if utf8.RuneCountInString(name) > maxHabitName {
+		return nil, fieldError(field, "too_long", "must be at most %d characters to name a new habit", maxHabitName)
+	}
+
+	return &model.ImportedRecord{
+		Record: model.Record{
+			Date:     date,
+			Content:  recordContent(row.Content, &model.Habit{Name: name}),
+			Duration: duration,
+			Notes:    row.Notes,
+		},
+		HabitName: name,
+	}, nil
+}
+
+// checkRequest validates a create or update request against its validate
+// tags and checks its date against cal, reporting every invalid field at
+// once. It returns the parsed date.
+func (s *recordService) checkRequest(req interface{}, dateText string, cal *model.Calendar) (model.Date, error) {
+	errs := validateStruct(req)
+	var date model.Date
+	if !errs.has("date") {
+		var err error
+		if date, err = s.recordDate(dateText, cal); err != nil {
+			errs.add(err)
+		}
+	}
+	return date, errs.err()
+}
+
+// recordDate reads the date of a record written by the user, which may be at
+// most maxFutureDays past today in cal.
+func (s *recordService) recordDate(text string, cal *model.Calendar) (model.Date, error) {
+	if text == "" {
+		return model.Date{}, fieldError("date", "required", "is required")
+	}
+	date, err := model.ParseDate(text)
+	if err != nil {
+		return model.Date{}, fieldError("date", "invalid_date", "must be a calendar date written as YYYY-MM-DD")
+	}
+	if latest := today(cal, s.now()).AddDays(s.maxFutureDays); date.After(latest) {
+		return model.Date{}, fieldError("date", "too_late", "must not be later than %s", latest)
+	}
+	return date, nil
+}
+
+// validateRecord holds the rules shared by every way of writing a record,
+// for records that arrive already parsed, such as those in a backup.
+func validateRecord(record *model.Record) error {
+	return validateStruct(&model.CreateRecordRequest{
+		Date:     record.Date.String(),
+		Content:  record.Content,
+		Duration: record.Duration,
+		Notes:    record.Notes,
+	}).err()
+}
+
+// recordContent keeps the free-text content of a record, falling back to the
+// habit name when a client only sent a habit reference.
+func recordContent(content string, habit *model.Habit) string {
+	if content = strings.TrimSpace(content); content != "" {
+		return content
+	}
+	return habit.Name
 }
@@ -1,14 +1,32 @@
 package service
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
 )
 
+const testUserID int64 = 1
+
+var testCalendar = &model.Calendar{Location: time.UTC, WeekStart: time.Sunday}
+
+var testActor = &model.Actor{UserID: testUserID, RequestID: "test-request"}
+
 type mockRepository struct {
-	records []model.Record
-	nextID  int64
+	records   []model.Record
+	trash     []model.Record
+	imported  []model.ImportedRecord
+	revisions []model.RecordRevision
+	nextID    int64
 }
 
 func newMockRepository() *mockRepository {
@@ -18,60 +36,294 @@ func newMockRepository() *mockRepository {
 	}
 }
 
-func (m *mockRepository) Create(record *model.Record) error {
+func (m *mockRepository) Create(actor *model.Actor, record *model.Record) error {
 	record.ID = m.nextID
+	record.Version = 1
 	m.nextID++
 	m.records = append(m.records, *record)
+	m.revise(actor, model.RevisionCreate, record.ID, record.Version, nil, record)
 	return nil
 }
 
-func (m *mockRepository) GetByID(id int64) (*model.Record, error) {
+func (m *mockRepository) revise(actor *model.Actor, action string, id, version int64, before, after *model.Record) {
+	rev := model.RecordRevision{
+		ID:        int64(len(m.revisions) + 1),
+		RecordID:  id,
+		Version:   version,
+		Action:    action,
+		UserID:    actor.UserID,
+		APIKeyID:  actor.APIKeyID,
+		RequestID: actor.RequestID,
+	}
+	if before != nil {
+		rev.Before = model.SnapshotOf(before)
+	}
+	if after != nil {
+		rev.After = model.SnapshotOf(after)
+	}
+	m.revisions = append(m.revisions, rev)
+}
+
+func (m *mockRepository) GetByID(userID, id int64) (*model.Record, error) {
 	for _, r := range m.records {
-		if r.ID == id {
+		if r.ID == id && r.UserID == userID {
 			return &r, nil
 		}
 	}
 	return nil, nil
 }
 
-func (m *mockRepository) GetAll() ([]model.Record, error) {
-	return m.records, nil
+func (m *mockRepository) List(userID int64, filter *model.RecordFilter) ([]model.Record, error) {
+	var records []model.Record
+	for _, r := range m.records {
+		if r.UserID != userID || (filter.Cursor != nil && r.ID <= filter.Cursor.ID) {
+			continue
+		}
+		records = append(records, r)
+		if filter.Limit > 0 && len(records) == filter.Limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+func (m *mockRepository) Stream(userID int64, filter *model.RecordFilter, fn func(*model.Record) error) error {
+	records, _ := m.List(userID, filter)
+	for i := range records {
+		if err := fn(&records[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Import(actor *model.Actor, rows []model.ImportedRecord) error {
+	for i := range rows {
+		rows[i].Record.UserID = actor.UserID
+		m.Create(actor, &rows[i].Record)
+	}
+	m.imported = append(m.imported, rows...)
+	return nil
+}
+
+func (m *mockRepository) Count(userID int64, filter *model.RecordFilter) (int, error) {
+	count := 0
+	for _, r := range m.records {
+		if r.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
 }
 
-func (m *mockRepository) Update(record *model.Record) error {
+func (m *mockRepository) Update(actor *model.Actor, record *model.Record) error {
 	for i, r := range m.records {
-		if r.ID == record.ID {
+		if r.ID == record.ID && r.UserID == record.UserID {
+			if r.Version != record.Version {
+				return repository.ErrStaleVersion
+			}
+			record.Version++
 			m.records[i] = *record
+			m.revise(actor, model.RevisionUpdate, r.ID, record.Version, &r, record)
 			return nil
 		}
 	}
-	return nil
+	return sql.ErrNoRows
 }
 
-func (m *mockRepository) Delete(id int64) error {
+func (m *mockRepository) Delete(actor *model.Actor, id, version int64) error {
 	for i, r := range m.records {
-		if r.ID == id {
+		if r.ID == id && r.UserID == actor.UserID {
+			if version != 0 && r.Version != version {
+				return repository.ErrStaleVersion
+			}
+			before := r
+			deletedAt := time.Now()
+			r.Version++
+			r.DeletedAt = &deletedAt
+			m.trash = append(m.trash, r)
 			m.records = append(m.records[:i], m.records[i+1:]...)
+			m.revise(actor, model.RevisionDelete, r.ID, r.Version, &before, nil)
 			return nil
 		}
 	}
-	return nil
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) ListTrash(userID int64) ([]model.Record, error) {
+	var records []model.Record
+	for _, r := range m.trash {
+		if r.UserID == userID {
+			records = append(records, r)
+		}
+	}
+	return records, nil
 }
 
-func (m *mockRepository) GetStats() (*model.Stats, error) {
-	total := 0
+func (m *mockRepository) Restore(actor *model.Actor, id int64) error {
+	for i, r := range m.trash {
+		if r.ID == id && r.UserID == actor.UserID {
+			trashed := r
+			r.Version++
+			r.DeletedAt = nil
+			m.records = append(m.records, r)
+			m.trash = append(m.trash[:i], m.trash[i+1:]...)
+			m.revise(actor, model.RevisionRestore, r.ID, r.Version, &trashed, &r)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockRepository) PurgeDeleted(before time.Time) (int64, error) {
+	var kept []model.Record
+	for _, r := range m.trash {
+		if !r.DeletedAt.Before(before) {
+			kept = append(kept, r)
+		}
+	}
+	purged := int64(len(m.trash) - len(kept))
+	m.trash = kept
+	return purged, nil
+}
+
+func (m *mockRepository) ListRevisions(userID, recordID int64) ([]model.RecordRevision, error) {
+	var revisions []model.RecordRevision
+	for _, rev := range m.revisions {
+		if rev.RecordID == recordID && rev.UserID == userID {
+			revisions = append(revisions, rev)
+		}
+	}
+	return revisions, nil
+}
+
+// InTx runs fn against the repository itself, restoring its records when fn
+// fails. Habits created in the transaction are kept.
+func (m *mockRepository) InTx(fn func(tx repository.RecordTx) error) error {
+	return m.restoreOnError(func() error {
+		return fn(&mockRecordTx{mockRepository: m, habits: newMockHabitRepository()})
+	})
+}
+
+func (m *mockRepository) restoreOnError(fn func() error) error {
+	records := append([]model.Record(nil), m.records...)
+	trash := append([]model.Record(nil), m.trash...)
+	revisions := append([]model.RecordRevision(nil), m.revisions...)
+	nextID := m.nextID
+	err := fn()
+	if err != nil {
+		m.records, m.trash, m.revisions, m.nextID = records, trash, revisions, nextID
+	}
+	return err
+}
+
+type mockRecordTx struct {
+	*mockRepository
+	habits repository.HabitRepository
+}
+
+func (t *mockRecordTx) Habits() repository.HabitRepository { return t.habits }
+
+func (t *mockRecordTx) Savepoint(fn func() error) error { return t.restoreOnError(fn) }
+
+func (m *mockRepository) GetStats(userID int64, weekStart, monthStart string) (*model.Stats, error) {
+	stats := &model.Stats{}
+	for _, r := range m.records {
+		if r.UserID != userID {
+			continue
+		}
+		stats.TotalRecords++
+		stats.TotalDuration += r.Duration
+		if r.Date.String() >= weekStart {
+			stats.ThisWeek++
+		}
+		if r.Date.String() >= monthStart {
+			stats.ThisMonth++
+		}
+	}
+	return stats, nil
+}
+
+func (m *mockRepository) GetActivityDates(userID int64) ([]model.ActivityDate, error) {
+	var dates []model.ActivityDate
+	for _, r := range m.records {
+		if r.UserID != userID {
+			continue
+		}
+		dates = append(dates, model.ActivityDate{HabitID: r.HabitID, Date: r.Date})
+	}
+	return dates, nil
+}
+
+func (m *mockRepository) GetDailyTotals(userID int64, filter *model.RecordFilter) ([]model.DayTotal, error) {
+	byDate := make(map[model.Date]*model.DayTotal)
+	var totals []model.DayTotal
 	for _, r := range m.records {
-		total += r.Duration
+		if r.UserID != userID || (filter.From != "" && r.Date.String() < filter.From) || (filter.To != "" && r.Date.String() > filter.To) ||
+			(filter.HabitID != 0 && r.HabitID != filter.HabitID) {
+			continue
+		}
+		if byDate[r.Date] == nil {
+			byDate[r.Date] = &model.DayTotal{Date: r.Date}
+		}
+		byDate[r.Date].Count++
+		byDate[r.Date].Duration += r.Duration
+	}
+	for _, t := range byDate {
+		totals = append(totals, *t)
 	}
-	return &model.Stats{
-		TotalRecords:  len(m.records),
-		TotalDuration: total,
-	}, nil
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Date.Before(totals[j].Date) })
+	return totals, nil
+}
+
+func (m *mockRepository) GetSeries(userID int64, filter *model.RecordFilter, interval string, weekStart time.Weekday, groupByContent bool) ([]model.SeriesTotal, error) {
+	byKey := make(map[[2]string]*model.SeriesTotal)
+	var keys [][2]string
+	for _, r := range m.records {
+		if r.UserID != userID || (filter.From != "" && r.Date.String() < filter.From) || (filter.To != "" && r.Date.String() > filter.To) ||
+			(filter.HabitID != 0 && r.HabitID != filter.HabitID) {
+			continue
+		}
+		day := r.Date
+		switch interval {
+		case "week":
+			day = day.AddDays(-((int(day.Weekday()) - int(weekStart) + 7) % 7))
+		case "month":
+			day = day.AddDays(1 - day.Time().Day())
+		case "year":
+			day = day.AddDays(1 - day.Time().YearDay())
+		}
+		key := [2]string{day.String(), ""}
+		if groupByContent {
+			key[1] = r.Content
+		}
+		if byKey[key] == nil {
+			byKey[key] = &model.SeriesTotal{Bucket: day, Key: key[1]}
+			keys = append(keys, key)
+		}
+		byKey[key].Count++
+		byKey[key].Duration += r.Duration
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i][0] < keys[j][0] })
+	totals := make([]model.SeriesTotal, len(keys))
+	for i, key := range keys {
+		totals[i] = *byKey[key]
+	}
+	return totals, nil
+}
+
+func mustDate(s string) model.Date {
+	d, err := model.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
 }
 
 func TestRecordService_Create(t *testing.T) {
 	repo := newMockRepository()
-	svc := NewRecordService(repo)
+	svc := NewRecordService(repo, newMockHabitRepository(), nil, 1)
 
 	tests := []struct {
 		name    string
@@ -117,7 +369,7 @@ func TestRecordService_Create(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			record, err := svc.Create(tt.req)
+			record, err := svc.Create(testActor, testCalendar, tt.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Create() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -129,48 +381,170 @@ func TestRecordService_Create(t *testing.T) {
 	}
 }
 
-func TestRecordService_GetAll(t *testing.T) {
+func TestRecordService_List(t *testing.T) {
 	repo := newMockRepository()
-	svc := NewRecordService(repo)
+	svc := NewRecordService(repo, newMockHabitRepository(), nil, 1)
 
 	// Create some records
-	svc.Create(&model.CreateRecordRequest{
+	svc.Create(testActor, testCalendar, &model.CreateRecordRequest{
 		Date:     "2024-01-15",
 		Content:  "Test 1",
 		Duration: 30,
 	})
-	svc.Create(&model.CreateRecordRequest{
+	svc.Create(testActor, testCalendar, &model.CreateRecordRequest{
 		Date:     "2024-01-16",
 		Content:  "Test 2",
 		Duration: 45,
 	})
 
-	records, err := svc.GetAll()
+	page, err := svc.List(testUserID, &model.RecordFilter{})
 	if err != nil {
-		t.Fatalf("GetAll() error = %v", err)
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if len(page.Items) != 2 {
+		t.Errorf("List() returned %d records, want 2", len(page.Items))
+	}
+	if page.Total != 2 {
+		t.Errorf("List() total = %d, want 2", page.Total)
+	}
+	if page.NextCursor != "" {
+		t.Errorf("List() nextCursor = %q, want none", page.NextCursor)
+	}
+}
+
+func TestRecordService_ListPagination(t *testing.T) {
+	repo := newMockRepository()
+	svc := NewRecordService(repo, newMockHabitRepository(), nil, 1)
+
+	for _, date := range []string{"2024-01-15", "2024-01-16", "2024-01-17"} {
+		svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: date, Content: "Test", Duration: 30})
+	}
+
+	first, err := svc.List(testUserID, &model.RecordFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(first.Items) != 2 || first.NextCursor == "" {
+		t.Fatalf("List() first page = %d items, cursor %q; want 2 items and a cursor", len(first.Items), first.NextCursor)
+	}
+
+	second, err := svc.List(testUserID, &model.RecordFilter{Limit: 2, After: first.NextCursor})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(second.Items) != 1 || second.NextCursor != "" {
+		t.Errorf("List() second page = %d items, cursor %q; want 1 item and no cursor", len(second.Items), second.NextCursor)
+	}
+
+	if _, err := svc.List(testUserID, &model.RecordFilter{Sort: "duration", After: first.NextCursor}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("List() with cursor from another sort error = %v, want %v", err, ErrInvalidInput)
+	}
+}
+
+func TestRecordService_ListInvalidFilter(t *testing.T) {
+	svc := NewRecordService(newMockRepository(), newMockHabitRepository(), nil, 1)
+
+	tests := []struct {
+		name   string
+		filter model.RecordFilter
+	}{
+		{name: "unknown sort", filter: model.RecordFilter{Sort: "notes"}},
+		{name: "unknown order", filter: model.RecordFilter{Order: "up"}},
+		{name: "limit too large", filter: model.RecordFilter{Limit: maxRecordLimit + 1}},
+		{name: "inverted duration range", filter: model.RecordFilter{MinDuration: 60, MaxDuration: 30}},
+		{name: "inverted date range", filter: model.RecordFilter{From: "2024-02-01", To: "2024-01-01"}},
+		{name: "malformed date", filter: model.RecordFilter{From: "yesterday"}},
+		{name: "malformed cursor", filter: model.RecordFilter{After: "not-a-cursor"}},
 	}
 
-	if len(records) != 2 {
-		t.Errorf("GetAll() returned %d records, want 2", len(records))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.List(testUserID, &tt.filter); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("List() error = %v, want %v", err, ErrInvalidInput)
+			}
+		})
+	}
+}
+
+func TestRecordService_CreateRejectsBadDates(t *testing.T) {
+	svc := &recordService{
+		repo:          newMockRepository(),
+		habits:        newMockHabitRepository(),
+		maxFutureDays: 1,
+		now:           func() time.Time { return time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC) },
+	}
+
+	tests := []struct {
+		date     string
+		wantCode string
+	}{
+		{"2024-03-10", ""},
+		{"2024-03-11", ""},
+		{"2024-03-12", "too_late"},
+		{"2024-13-45", "invalid_date"},
+		{"2024-02-30", "invalid_date"},
+		{"2024-3-1", "invalid_date"},
+		{"yesterday", "invalid_date"},
+		{"", "required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			_, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: tt.date, Content: "Running", Duration: 30})
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Errorf("Create() error = %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.Is(err, ErrInvalidInput) || !errors.As(err, &verr) || len(verr.Fields) != 1 ||
+				verr.Fields[0].Field != "date" || verr.Fields[0].Code != tt.wantCode {
+				t.Errorf("Create() error = %v, want a %s error on date", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRecordService_CreateReportsEveryField(t *testing.T) {
+	svc := NewRecordService(newMockRepository(), newMockHabitRepository(), nil, 1)
+
+	_, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{
+		Date:     "2024-3-1",
+		Content:  strings.Repeat("跑", 256),
+		Duration: 1441,
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Create() error = %v, want a ValidationError", err)
+	}
+	got := make(map[string]string)
+	for _, f := range verr.Fields {
+		got[f.Field] = f.Code
+	}
+	want := map[string]string{"date": "invalid_date", "content": "too_long", "duration": "too_large"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Create() field errors = %v, want %v", got, want)
 	}
 }
 
 func TestRecordService_GetStats(t *testing.T) {
 	repo := newMockRepository()
-	svc := NewRecordService(repo)
+	svc := NewRecordService(repo, newMockHabitRepository(), nil, 1)
 
-	svc.Create(&model.CreateRecordRequest{
+	svc.Create(testActor, testCalendar, &model.CreateRecordRequest{
 		Date:     "2024-01-15",
 		Content:  "Test 1",
 		Duration: 30,
 	})
-	svc.Create(&model.CreateRecordRequest{
+	svc.Create(testActor, testCalendar, &model.CreateRecordRequest{
 		Date:     "2024-01-16",
 		Content:  "Test 2",
 		Duration: 45,
 	})
 
-	stats, err := svc.GetStats()
+	stats, err := svc.GetStats(testUserID, testCalendar)
 	if err != nil {
 		t.Fatalf("GetStats() error = %v", err)
 	}
@@ -183,3 +557,396 @@ func TestRecordService_GetStats(t *testing.T) {
 		t.Errorf("GetStats() TotalDuration = %d, want 75", stats.TotalDuration)
 	}
 }
+
+func TestRecordService_GetStatsUsesCalendar(t *testing.T) {
+	repo := newMockRepository()
+	svc := &recordService{
+		repo:          repo,
+		habits:        newMockHabitRepository(),
+		maxFutureDays: 1,
+		// Sunday evening in UTC, Monday morning in Shanghai.
+		now: func() time.Time { return time.Date(2024, 1, 14, 20, 0, 0, 0, time.UTC) },
+	}
+	for _, date := range []string{"2023-12-31", "2024-01-13", "2024-01-14", "2024-01-15"} {
+		if _, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: date, Content: "Running", Duration: 30}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	tests := []struct {
+		name        string
+		cal         *model.Calendar
+		week, month int
+	}{
+		{"utc", testCalendar, 2, 3},
+		{"shanghai", &model.Calendar{Location: shanghai, WeekStart: time.Sunday}, 2, 3},
+		{"shanghai from monday", &model.Calendar{Location: shanghai, WeekStart: time.Monday}, 1, 3},
+		{"utc from monday", &model.Calendar{Location: time.UTC, WeekStart: time.Monday}, 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := svc.GetStats(testUserID, tt.cal)
+			if err != nil {
+				t.Fatalf("GetStats() error = %v", err)
+			}
+			if stats.ThisWeek != tt.week || stats.ThisMonth != tt.month {
+				t.Errorf("GetStats() this week = %d, this month = %d, want %d and %d", stats.ThisWeek, stats.ThisMonth, tt.week, tt.month)
+			}
+		})
+	}
+}
+
+func TestRecordService_CreateGroupsByHabit(t *testing.T) {
+	repo := newMockRepository()
+	habits := newMockHabitRepository()
+	svc := NewRecordService(repo, habits, nil, 1)
+
+	first, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	second, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-16", Content: "running ", Duration: 20})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if first.HabitID == 0 || first.HabitID != second.HabitID {
+		t.Errorf("Create() habit ids = %d, %d, want the same non-zero id", first.HabitID, second.HabitID)
+	}
+	if len(habits.habits) != 1 {
+		t.Errorf("Create() created %d habits, want 1", len(habits.habits))
+	}
+
+	byID, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{HabitID: first.HabitID, Date: "2024-01-17", Duration: 10})
+	if err != nil {
+		t.Fatalf("Create() by habit id error = %v", err)
+	}
+	if byID.Content != "Running" {
+		t.Errorf("Create() content = %q, want habit name %q", byID.Content, "Running")
+	}
+
+	_, err = svc.Create(testActor, testCalendar, &model.CreateRecordRequest{HabitID: 99, Date: "2024-01-17", Duration: 10})
+	if !errors.Is(err, ErrHabitNotFound) {
+		t.Errorf("Create() with unknown habit error = %v, want %v", err, ErrHabitNotFound)
+	}
+}
+
+func TestRecordService_Patch(t *testing.T) {
+	svc := NewRecordService(newMockRepository(), newMockHabitRepository(), nil, 1)
+	record, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30, Notes: "easy"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	patched, err := svc.Patch(testActor, record.ID, 0, testCalendar, []byte(`{"notes":"hard","duration":45}`))
+	if err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if patched.Notes != "hard" || patched.Duration != 45 || patched.Date.String() != "2024-01-15" || patched.Content != "Running" || patched.HabitID != record.HabitID {
+		t.Errorf("Patch() = %+v, want only notes and duration changed", patched)
+	}
+
+	patched, err = svc.Patch(testActor, record.ID, 0, testCalendar, []byte(`{"notes":null}`))
+	if err != nil || patched.Notes != "" || patched.Duration != 45 {
+		t.Errorf("Patch() removing notes = %+v, %v", patched, err)
+	}
+
+	tests := []struct {
+		name  string
+		patch string
+		field string
+	}{
+		{"removing a required field", `{"duration":null}`, "duration"},
+		{"merged result is validated", `{"date":"2024-1-16"}`, "date"},
+		{"wrong type", `{"duration":"long"}`, "duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Patch(testActor, record.ID, 0, testCalendar, []byte(tt.patch))
+			var verr *ValidationError
+			var ferr *FieldError
+			switch {
+			case errors.As(err, &verr) && verr.Fields[0].Field == tt.field:
+			case errors.As(err, &ferr) && ferr.Field == tt.field:
+			default:
+				t.Errorf("Patch(%s) error = %v, want an error on %s", tt.patch, err, tt.field)
+			}
+		})
+	}
+
+	if _, err := svc.Patch(testActor, record.ID, 0, testCalendar, []byte(`[1]`)); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Patch() with an array error = %v, want %v", err, ErrInvalidInput)
+	}
+	if _, err := svc.Patch(&model.Actor{UserID: testUserID + 1}, record.ID, 0, testCalendar, []byte(`{"notes":"x"}`)); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Patch() by another user error = %v, want %v", err, ErrRecordNotFound)
+	}
+}
+
+func TestRecordService_RejectsStaleVersions(t *testing.T) {
+	svc := NewRecordService(newMockRepository(), newMockHabitRepository(), nil, 1)
+	record, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	req := &model.UpdateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 40}
+	updated, err := svc.Update(testActor, record.ID, record.Version, testCalendar, req)
+	if err != nil || updated.Version != record.Version+1 {
+		t.Fatalf("Update() = %+v, %v, want version %d", updated, err, record.Version+1)
+	}
+
+	if _, err := svc.Update(testActor, record.ID, record.Version, testCalendar, req); !errors.Is(err, ErrRecordModified) {
+		t.Errorf("Update() of a stale version error = %v, want %v", err, ErrRecordModified)
+	}
+	if _, err := svc.Patch(testActor, record.ID, record.Version, testCalendar, []byte(`{"notes":"x"}`)); !errors.Is(err, ErrRecordModified) {
+		t.Errorf("Patch() of a stale version error = %v, want %v", err, ErrRecordModified)
+	}
+	if err := svc.Delete(testActor, record.ID, record.Version); !errors.Is(err, ErrRecordModified) {
+		t.Errorf("Delete() of a stale version error = %v, want %v", err, ErrRecordModified)
+	}
+	if err := svc.Delete(testActor, record.ID, updated.Version); err != nil {
+		t.Errorf("Delete() of the current version error = %v", err)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7386, appendix A.
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		var target, patch interface{}
+		json.Unmarshal([]byte(tt.target), &target)
+		json.Unmarshal([]byte(tt.patch), &patch)
+		got, _ := json.Marshal(mergePatch(target, patch))
+		if string(got) != tt.want {
+			t.Errorf("mergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestRecordService_UserIsolation(t *testing.T) {
+	repo := newMockRepository()
+	svc := NewRecordService(repo, newMockHabitRepository(), nil, 1)
+	const otherUserID int64 = 2
+
+	record, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := svc.GetByID(otherUserID, record.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("GetByID() by another user error = %v, want %v", err, ErrRecordNotFound)
+	}
+	if _, err := svc.Update(&model.Actor{UserID: otherUserID}, record.ID, 0, testCalendar, &model.UpdateRecordRequest{Date: "2024-01-16", Content: "Hijack", Duration: 1}); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Update() by another user error = %v, want %v", err, ErrRecordNotFound)
+	}
+	if err := svc.Delete(&model.Actor{UserID: otherUserID}, record.ID, 0); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Delete() by another user error = %v, want %v", err, ErrRecordNotFound)
+	}
+
+	page, err := svc.List(otherUserID, &model.RecordFilter{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("List() by another user total = %d, want 0", page.Total)
+	}
+
+	stats, err := svc.GetStats(otherUserID, testCalendar)
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if stats.TotalRecords != 0 {
+		t.Errorf("GetStats() by another user TotalRecords = %d, want 0", stats.TotalRecords)
+	}
+}
+
+func TestRecordService_Import(t *testing.T) {
+	rows := []model.ImportRow{
+		{Line: 2, Date: "2024-01-15", Habit: "Running", Content: "5k", Duration: "30"},
+		{Line: 3, Date: "2024-01-16", Content: "Reading", Duration: "20", Notes: "novel"},
+		{Line: 4, Date: "2024-01-16", Habit: "Running", Duration: " 25 "},
+	}
+
+	repo := newMockRepository()
+	svc := NewRecordService(repo, newMockHabitRepository(), nil, 1)
+
+	result, err := svc.Import(testActor, testCalendar, rows)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.Imported != 3 || len(result.Errors) != 0 {
+		t.Fatalf("Import() = %+v, want 3 imported and no errors", result)
+	}
+
+	want := []struct{ habit, content string }{{"Running", "5k"}, {"Reading", "Reading"}, {"Running", "Running"}}
+	for i, w := range want {
+		got := repo.imported[i]
+		if got.HabitName != w.habit || got.Record.Content != w.content {
+			t.Errorf("row %d = habit %q content %q, want %q %q", i, got.HabitName, got.Record.Content, w.habit, w.content)
+		}
+	}
+}
+
+func TestRecordService_ImportReportsEveryBadRow(t *testing.T) {
+	rows := []model.ImportRow{
+		{Line: 2, Date: "2024-01-15", Content: "Running", Duration: "30"},
+		{Line: 3, Date: "15/01/2024", Content: "Running", Duration: "30"},
+		{Line: 4, Date: "2024-01-15", Content: "Running", Duration: "half an hour"},
+		{Line: 5, Date: "2024-01-15", Duration: "10"},
+		{Line: 6, Date: "2024-01-15", Content: "Running", Duration: "0"},
+		{Line: 7, Date: "2024-01-15", Habit: strings.Repeat("r", maxHabitName+1), Duration: "30"},
+	}
+
+	repo := newMockRepository()
+	svc := NewRecordService(repo, newMockHabitRepository(), nil, 1)
+
+	result, err := svc.Import(testActor, testCalendar, rows)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.Imported != 0 || len(repo.records) != 0 {
+		t.Errorf("Import() wrote %d records, want none", len(repo.records))
+	}
+
+	var lines []int
+	for _, e := range result.Errors {
+		lines = append(lines, e.Line)
+	}
+	if fmt.Sprint(lines) != "[3 4 5 6 7]" {
+		t.Errorf("Import() error lines = %v, want [3 4 5 6 7]", lines)
+	}
+	if last := result.Errors[len(result.Errors)-1].Error; !strings.Contains(last, "habit") {
+		t.Errorf("Import() error on line 7 = %q, want it to name the habit", last)
+	}
+}
+
+func TestRecordService_Export(t *testing.T) {
+	repo := newMockRepository()
+	habits := newMockHabitRepository()
+	svc := NewRecordService(repo, habits, nil, 1)
+
+	for i := 0; i < maxRecordLimit+5; i++ {
+		if _, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	count := 0
+	err := svc.Export(testUserID, &model.RecordFilter{Limit: 10}, func(record *model.Record, habit string) error {
+		if habit != "Running" {
+			t.Errorf("Export() habit = %q, want %q", habit, "Running")
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if count != maxRecordLimit+5 {
+		t.Errorf("Export() streamed %d records, want %d", count, maxRecordLimit+5)
+	}
+}
+
+// recordingPublisher keeps the events it is told about as "event id".
+type recordingPublisher struct {
+	events []string
+}
+
+func (p *recordingPublisher) Publish(userID int64, event string, data interface{}) error {
+	p.events = append(p.events, fmt.Sprintf("%s %d", event, data.(*model.RecordEvent).Record.ID))
+	return nil
+}
+
+func TestRecordService_PublishesEvents(t *testing.T) {
+	repo := newMockRepository()
+	events := &recordingPublisher{}
+	svc := NewRecordService(repo, newMockHabitRepository(), events, 1)
+	expect := func(step string, want ...string) {
+		t.Helper()
+		if !reflect.DeepEqual(events.events, want) {
+			t.Errorf("%s published %q, want %q", step, events.events, want)
+		}
+		events.events = nil
+	}
+
+	record, _ := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	expect("Create()", "record.created 1")
+	svc.Update(testActor, record.ID, 0, testCalendar, &model.UpdateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 35})
+	expect("Update()", "record.updated 1")
+	svc.Patch(testActor, record.ID, 0, testCalendar, []byte(`{"notes": "windy"}`))
+	expect("Patch()", "record.updated 1")
+	svc.Delete(testActor, record.ID, 0)
+	expect("Delete()", "record.deleted 1")
+	svc.Restore(testActor, record.ID)
+	expect("Restore()", "record.created 1")
+
+	svc.Update(testActor, record.ID, 1, testCalendar, &model.UpdateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 40})
+	svc.Delete(testActor, 99, 0)
+	expect("failed writes")
+
+	svc.Import(testActor, testCalendar, []model.ImportRow{{Line: 2, Date: "2024-01-16", Content: "Reading", Duration: "20"}})
+	expect("Import()", "record.created 2")
+
+	ops := []model.BatchOperation{
+		{Op: "create", Record: &model.UpdateRecordRequest{Date: "2024-01-17", Content: "Reading", Duration: 20}},
+		{Op: "delete", ID: record.ID},
+		{Op: "delete", ID: 99},
+	}
+	svc.Batch(testActor, testCalendar, &model.BatchRequest{Operations: ops})
+	expect("atomic Batch() that failed")
+	outcomes, _ := svc.Batch(testActor, testCalendar, &model.BatchRequest{Mode: model.BatchBestEffort, Operations: ops})
+	expect("best effort Batch()", fmt.Sprintf("record.created %d", outcomes[0].Record.ID), "record.deleted 1")
+	if outcomes[1].Record != nil {
+		t.Errorf("Batch() delete outcome = %+v, want no record", outcomes[1])
+	}
+}
+
+// racingRepository lets another write update a record right after each read
+// of it.
+type racingRepository struct {
+	*mockRepository
+}
+
+func (m racingRepository) GetByID(userID, id int64) (*model.Record, error) {
+	record, err := m.mockRepository.GetByID(userID, id)
+	for i := range m.records {
+		if m.records[i].ID == id {
+			m.records[i].Version++
+		}
+	}
+	return record, err
+}
+
+func TestRecordService_DeleteChecksTheVersionRead(t *testing.T) {
+	repo := racingRepository{newMockRepository()}
+	events := &recordingPublisher{}
+	svc := NewRecordService(repo, newMockHabitRepository(), events, 1)
+	record, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	events.events = nil
+
+	if err := svc.Delete(testActor, record.ID, 0); !errors.Is(err, ErrRecordModified) {
+		t.Errorf("Delete() of a record changed after it was read error = %v, want %v", err, ErrRecordModified)
+	}
+	if len(repo.records) != 1 || len(events.events) != 0 {
+		t.Errorf("Delete() left %d records and published %q, want the record kept and no event", len(repo.records), events.events)
+	}
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/notify"
+	"habit-tracker/internal/repository"
+	"habit-tracker/pkg/logger"
+)
+
+var ErrReminderNotFound = errors.New("reminder not found")
+
+type ReminderService interface {
+	Create(userID int64, req *model.ReminderRequest) (*model.Reminder, error)
+	GetByID(userID, id int64) (*model.Reminder, error)
+	GetAll(userID int64) ([]model.Reminder, error)
+	Update(userID, id int64, req *model.ReminderRequest) (*model.Reminder, error)
+	Delete(userID, id int64) error
+	// Dispatch sends every reminder that is due at now and has not been
+	// sent yet that day. It is meant to run every minute or so; a run that
+	// finds the time already passed, say after a restart, catches up.
+	Dispatch(ctx context.Context, now time.Time) error
+}
+
+type reminderService struct {
+	reminders repository.ReminderRepository
+	habits    repository.HabitRepository
+	records   repository.RecordRepository
+	users     repository.UserRepository
+	calendars CalendarService
+	notifiers map[string]notify.Notifier
+}
+
+// NewReminderService returns a service that sends reminders through
+// notifiers, keyed by channel name.
+func NewReminderService(reminders repository.ReminderRepository, habits repository.HabitRepository, records repository.RecordRepository,
+	users repository.UserRepository, calendars CalendarService, notifiers map[string]notify.Notifier) ReminderService {
+	return &reminderService{reminders: reminders, habits: habits, records: records, users: users, calendars: calendars, notifiers: notifiers}
+}
+
+func (s *reminderService) Create(userID int64, req *model.ReminderRequest) (*model.Reminder, error) {
+	reminder := &model.Reminder{UserID: userID}
+	if err := s.apply(reminder, req); err != nil {
+		return nil, err
+	}
+	if err := s.reminders.Create(reminder); err != nil {
+		return nil, err
+	}
+	return reminder, nil
+}
+
+func (s *reminderService) GetByID(userID, id int64) (*model.Reminder, error) {
+	reminder, err := s.reminders.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if reminder == nil {
+		return nil, ErrReminderNotFound
+	}
+	return reminder, nil
+}
+
+func (s *reminderService) GetAll(userID int64) ([]model.Reminder, error) {
+	reminders, err := s.reminders.GetAll(userID)
+	if err != nil {
+		return nil, err
+	}
+	if reminders == nil {
+		return []model.Reminder{}, nil
+	}
+	return reminders, nil
+}
+
+func (s *reminderService) Update(userID, id int64, req *model.ReminderRequest) (*model.Reminder, error) {
+	reminder, err := s.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(reminder, req); err != nil {
+		return nil, err
+	}
+	if err := s.reminders.Update(reminder); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReminderNotFound
+		}
+		return nil, err
+	}
+	return reminder, nil
+}
+
+func (s *reminderService) Delete(userID, id int64) error {
+	if err := s.reminders.Delete(userID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrReminderNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// checkReminderTime adds what is wrong with the time, weekdays and timezone of
+// req to errs, and returns the weekdays and timezone normalized.
+func checkReminderTime(errs *ValidationError, req *model.ReminderRequest) ([]string, string) {
+	if req.Time != "" {
+		if _, err := time.Parse("15:04", req.Time); err != nil || len(req.Time) != len("15:04") {
+			errs.add(fieldError("time", "invalid_time", "must be a time of day written as HH:MM"))
+		}
+	}
+	weekdays := normalizeWeekdays(req.Weekdays, errs)
+	timezone := strings.TrimSpace(req.Timezone)
+	if timezone != "" {
+		if _, err := userLocation(timezone); err != nil {
+			errs.add(err)
+		}
+	}
+	return weekdays, timezone
+}
+
+// apply validates req, reporting every invalid field at once, and copies it
+// into reminder.
+func (s *reminderService) apply(reminder *model.Reminder, req *model.ReminderRequest) error {
+	errs := validateStruct(req)
+	weekdays, timezone := checkReminderTime(errs, req)
+	channel := req.Channel
+	if channel == "" {
+		channel = notify.Log
+	}
+	if _, ok := s.notifiers[channel]; !ok {
+		errs.add(fieldError("channel", "invalid", "must be one of %s", strings.Join(s.channels(), ", ")))
+	} else if channel == notify.Email {
+		user, err := s.users.GetByID(reminder.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil || user.Email == "" {
+			errs.add(fieldError("channel", "no_email", "needs an email address in the account settings"))
+		}
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	habit, err := s.habits.GetByID(reminder.UserID, req.HabitID)
+	if err != nil {
+		return err
+	}
+	if habit == nil {
+		return ErrHabitNotFound
+	}
+
+	reminder.HabitID = habit.ID
+	reminder.Time = req.Time
+	reminder.Weekdays = weekdays
+	reminder.Timezone = timezone
+	reminder.Channel = channel
+	reminder.Enabled = req.Enabled == nil || *req.Enabled
+	return nil
+}
+
+func (s *reminderService) channels() []string {
+	names := make([]string, 0, len(s.notifiers))
+	for name := range s.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *reminderService) Dispatch(ctx context.Context, now time.Time) error {
+	reminders, err := s.reminders.ListEnabled()
+	if err != nil {
+		return err
+	}
+
+	for i := range reminders {
+		if err := s.dispatch(ctx, &reminders[i], now); err != nil {
+			logger.Error("Failed to send reminder %d: %v", reminders[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// dispatch sends reminder if it is due. The day is claimed before sending,
+// so that a reminder is sent at most once a day however many runs, or
+// servers, see it due; a failed send gives the claim back to be retried,
+// unless the user has no address to send it to.
+func (s *reminderService) dispatch(ctx context.Context, reminder *model.Reminder, now time.Time) error {
+	n, day, err := s.due(reminder, now)
+	if err != nil || n == nil {
+		return err
+	}
+
+	claimed, err := s.reminders.SetLastFired(reminder.ID, reminder.LastFiredOn, &day)
+	if err != nil || !claimed {
+		return err
+	}
+
+	notifier, ok := s.notifiers[reminder.Channel]
+	if !ok {
+		err = fmt.Errorf("no notifier for channel %q", reminder.Channel)
+	} else {
+		err = notifier.Notify(ctx, n)
+	}
+	if errors.Is(err, notify.ErrNoAddress) {
+		// Keep the claim: retrying will not help until the user gives an
+		// address, so the reminder is skipped for the day.
+		return err
+	}
+	if err != nil {
+		if _, rerr := s.reminders.SetLastFired(reminder.ID, &day, reminder.LastFiredOn); rerr != nil {
+			logger.Error("Failed to release reminder %d: %v", reminder.ID, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// due returns the notification for reminder and the local day it is for, or
+// nil if the reminder should not fire at now: it already fired today, its
+// time has not come, today is not one of its weekdays, or the habit is not
+// due today or has been recorded already.
+func (s *reminderService) due(reminder *model.Reminder, now time.Time) (*model.Notification, model.Date, error) {
+	user, err := s.users.GetByID(reminder.UserID)
+	if err != nil || user == nil {
+		return nil, model.Date{}, err
+	}
+	cal, err := s.calendars.Calendar(user, reminder.Timezone)
+	if err != nil {
+		return nil, model.Date{}, err
+	}
+
+	local := now.In(cal.Location)
+	day := model.DateOf(local)
+	if reminder.LastFiredOn != nil && !reminder.LastFiredOn.Before(day) {
+		return nil, day, nil
+	}
+	if local.Format("15:04") < reminder.Time {
+		return nil, day, nil
+	}
+	if len(reminder.Weekdays) > 0 && !containsWeekday(reminder.Weekdays, day.Weekday()) {
+		return nil, day, nil
+	}
+
+	habit, err := s.habits.GetByID(reminder.UserID, reminder.HabitID)
+	if err != nil || habit == nil || habit.Archived {
+		return nil, day, err
+	}
+	occurrences := ExpandSchedule(habit.Schedule, day, day, cal.WeekStart)
+	if len(occurrences) == 0 {
+		return nil, day, nil
+	}
+
+	totals, err := s.records.GetDailyTotals(reminder.UserID, &model.RecordFilter{
+		HabitID: habit.ID,
+		From:    occurrences[0].Start.String(),
+		To:      day.String(),
+	})
+	if err != nil {
+		return nil, day, err
+	}
+	active := make(map[model.Date]bool, len(totals))
+	for _, t := range totals {
+		if t.Count > 0 {
+			active[t.Date] = true
+		}
+	}
+	markOccurrences(occurrences, active, day)
+	if active[day] || occurrences[0].Met {
+		return nil, day, nil
+	}
+
+	return &model.Notification{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Channel:  reminder.Channel,
+		Subject:  fmt.Sprintf("Reminder: %s", habit.Name),
+		Body:     fmt.Sprintf("Nothing has been recorded for %s today (%s) yet.", habit.Name, day),
+	}, day, nil
+}
+
+func containsWeekday(names []string, day time.Weekday) bool {
+	for _, name := range names {
+		if d, ok := parseWeekday(name); ok && d == day {
+			return true
+		}
+	}
+	return false
+}
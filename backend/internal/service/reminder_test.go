@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/notify"
+)
+
+type mockReminderRepository struct {
+	reminders []model.Reminder
+	nextID    int64
+}
+
+func newMockReminderRepository() *mockReminderRepository {
+	return &mockReminderRepository{nextID: 1}
+}
+
+func (m *mockReminderRepository) Create(reminder *model.Reminder) error {
+	reminder.ID = m.nextID
+	m.nextID++
+	m.reminders = append(m.reminders, *reminder)
+	return nil
+}
+
+func (m *mockReminderRepository) GetByID(userID, id int64) (*model.Reminder, error) {
+	for _, r := range m.reminders {
+		if r.ID == id && r.UserID == userID {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockReminderRepository) GetAll(userID int64) ([]model.Reminder, error) {
+	var reminders []model.Reminder
+	for _, r := range m.reminders {
+		if r.UserID == userID {
+			reminders = append(reminders, r)
+		}
+	}
+	return reminders, nil
+}
+
+func (m *mockReminderRepository) Update(reminder *model.Reminder) error {
+	for i, r := range m.reminders {
+		if r.ID == reminder.ID && r.UserID == reminder.UserID {
+			reminder.LastFiredOn = r.LastFiredOn
+			m.reminders[i] = *reminder
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockReminderRepository) Delete(userID, id int64) error {
+	for i, r := range m.reminders {
+		if r.ID == id && r.UserID == userID {
+			m.reminders = append(m.reminders[:i], m.reminders[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockReminderRepository) ListEnabled() ([]model.Reminder, error) {
+	var reminders []model.Reminder
+	for _, r := range m.reminders {
+		if r.Enabled {
+			reminders = append(reminders, r)
+		}
+	}
+	return reminders, nil
+}
+
+func (m *mockReminderRepository) SetLastFired(id int64, from, to *model.Date) (bool, error) {
+	for i, r := range m.reminders {
+		if r.ID != id {
+			continue
+		}
+		if (r.LastFiredOn == nil) != (from == nil) || (from != nil && *r.LastFiredOn != *from) {
+			return false, nil
+		}
+		m.reminders[i].LastFiredOn = to
+		return true, nil
+	}
+	return false, nil
+}
+
+// recordingNotifier keeps what it is asked to send, failing while err is set.
+type recordingNotifier struct {
+	sent []model.Notification
+	err  error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification *model.Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, *notification)
+	return nil
+}
+
+type reminderFixture struct {
+	svc       ReminderService
+	reminders *mockReminderRepository
+	habits    *mockHabitRepository
+	records   *mockRepository
+	users     *mockUserRepository
+	notifier  *recordingNotifier
+}
+
+// newReminderFixture sets up a user in Shanghai, eight hours ahead of UTC,
+// with a Gym habit due on Mondays, Wednesdays and Fridays.
+func newReminderFixture() *reminderFixture {
+	f := &reminderFixture{
+		reminders: newMockReminderRepository(),
+		habits:    newMockHabitRepository(),
+		records:   newMockRepository(),
+		users:     newMockUserRepository(),
+		notifier:  &recordingNotifier{},
+	}
+	f.users.Create(&model.User{Username: "bob", Timezone: "Asia/Shanghai"})
+	f.habits.Create(&model.Habit{UserID: testUserID, Name: "Gym", Schedule: &model.Schedule{
+		Frequency: model.ScheduleWeekly, Interval: 1, Weekdays: []string{"monday", "wednesday", "friday"},
+	}})
+	f.svc = f.restart()
+	return f
+}
+
+// restart returns a new service over the same stored state.
+func (f *reminderFixture) restart() ReminderService {
+	return NewReminderService(f.reminders, f.habits, f.records, f.users, NewCalendarService(f.users, testCalendar, true),
+		map[string]notify.Notifier{notify.Log: notify.LogNotifier{}, "test": f.notifier})
+}
+
+func (f *reminderFixture) dispatch(t *testing.T, svc ReminderService, now string) int {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(f.notifier.sent)
+	if err := svc.Dispatch(context.Background(), at); err != nil {
+		t.Fatalf("Dispatch(%s) error = %v", now, err)
+	}
+	return len(f.notifier.sent) - before
+}
+
+func TestReminderService_Validates(t *testing.T) {
+	f := newReminderFixture()
+
+	_, err := f.svc.Create(testUserID, &model.ReminderRequest{HabitID: 1, Time: "8:00", Weekdays: []string{"funday"}, Timezone: "Mars/Olympus", Channel: "pigeon"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Create() error = %v, want a ValidationError", err)
+	}
+	got := make(map[string]string)
+	for _, f := range verr.Fields {
+		got[f.Field] = f.Code
+	}
+	want := map[string]string{"time": "invalid_time", "weekdays[0]": "invalid", "timezone": "invalid", "channel": "invalid"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Create() field errors = %v, want %v", got, want)
+	}
+
+	if _, err := f.svc.Create(testUserID, &model.ReminderRequest{HabitID: 2, Time: "08:00"}); !errors.Is(err, ErrHabitNotFound) {
+		t.Errorf("Create() for a missing habit error = %v, want %v", err, ErrHabitNotFound)
+	}
+
+	reminder, err := f.svc.Create(testUserID, &model.ReminderRequest{HabitID: 1, Time: "08:00", Weekdays: []string{"Friday", "monday"}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if reminder.Channel != notify.Log || !reminder.Enabled || !reflect.DeepEqual(reminder.Weekdays, []string{"monday", "friday"}) {
+		t.Errorf("Create() = %+v, want an enabled log reminder on monday and friday", reminder)
+	}
+	disabled := false
+	if updated, err := f.svc.Update(testUserID, reminder.ID, &model.ReminderRequest{HabitID: 1, Time: "21:30", Enabled: &disabled}); err != nil || updated.Enabled || updated.Weekdays != nil {
+		t.Errorf("Update() = %+v, %v, want a disabled reminder on every day", updated, err)
+	}
+	if _, err := f.svc.GetByID(testUserID+1, reminder.ID); !errors.Is(err, ErrReminderNotFound) {
+		t.Errorf("GetByID() by another user error = %v, want %v", err, ErrReminderNotFound)
+	}
+}
+
+func TestReminderService_Dispatch(t *testing.T) {
+	f := newReminderFixture()
+	if _, err := f.svc.Create(testUserID, &model.ReminderRequest{HabitID: 1, Time: "20:00", Channel: "test"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// Monday 2024-03-11 in Shanghai.
+	if n := f.dispatch(t, f.svc, "2024-03-11T11:59:00Z"); n != 0 {
+		t.Errorf("Dispatch() before the time sent %d reminders, want 0", n)
+	}
+	if n := f.dispatch(t, f.svc, "2024-03-11T12:00:00Z"); n != 1 {
+		t.Fatalf("Dispatch() at the time sent %d reminders, want 1", n)
+	}
+	if sent := f.notifier.sent[0]; sent.Username != "bob" || sent.Subject != "Reminder: Gym" {
+		t.Errorf("Dispatch() sent %+v, want a Gym reminder for bob", sent)
+	}
+	if n := f.dispatch(t, f.svc, "2024-03-11T12:01:00Z"); n != 0 {
+		t.Errorf("Dispatch() again sent %d reminders, want 0", n)
+	}
+	if n := f.dispatch(t, f.restart(), "2024-03-11T15:00:00Z"); n != 0 {
+		t.Errorf("Dispatch() after a restart sent %d reminders, want 0", n)
+	}
+
+	// Tuesday is not a gym day.
+	if n := f.dispatch(t, f.svc, "2024-03-12T13:00:00Z"); n != 0 {
+		t.Errorf("Dispatch() on a day off sent %d reminders, want 0", n)
+	}
+
+	// Wednesday has been recorded already.
+	f.records.records = append(f.records.records, model.Record{UserID: testUserID, HabitID: 1, Date: mustDate("2024-03-13")})
+	if n := f.dispatch(t, f.svc, "2024-03-13T13:00:00Z"); n != 0 {
+		t.Errorf("Dispatch() on a recorded day sent %d reminders, want 0", n)
+	}
+
+	// A restart late on Friday catches up, retrying when the send fails.
+	f.notifier.err = errors.New("connection refused")
+	if n := f.dispatch(t, f.svc, "2024-03-15T15:00:00Z"); n != 0 {
+		t.Errorf("Dispatch() with a failing notifier sent %d reminders, want 0", n)
+	}
+	if fired := f.reminders.reminders[0].LastFiredOn; *fired != mustDate("2024-03-11") {
+		t.Errorf("last fired on = %v after a failed send, want 2024-03-11", fired)
+	}
+	f.notifier.err = nil
+	if n := f.dispatch(t, f.restart(), "2024-03-15T15:01:00Z"); n != 1 {
+		t.Errorf("Dispatch() after the notifier recovered sent %d reminders, want 1", n)
+	}
+	// Past midnight in Shanghai it is Saturday.
+	if n := f.dispatch(t, f.svc, "2024-03-15T16:30:00Z"); n != 0 {
+		t.Errorf("Dispatch() on Saturday sent %d reminders, want 0", n)
+	}
+}
+
+func TestReminderService_DispatchRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      model.ReminderRequest
+		schedule *model.Schedule
+		records  []string
+		now      string
+		want     int
+	}{
+		{
+			name: "the reminder's own time zone",
+			req:  model.ReminderRequest{Time: "08:00", Timezone: "America/New_York"},
+			now:  "2024-03-11T12:00:00Z", // 08:00 in New York, 20:00 in Shanghai
+			want: 1,
+		},
+		{
+			name: "before the time in the reminder's zone",
+			req:  model.ReminderRequest{Time: "08:00", Timezone: "America/New_York"},
+			now:  "2024-03-11T11:59:00Z",
+		},
+		{
+			name: "not one of the reminder's weekdays",
+			req:  model.ReminderRequest{Time: "08:00", Weekdays: []string{"wednesday"}},
+			now:  "2024-03-11T12:00:00Z",
+		},
+		{
+			name:     "times a week not yet met",
+			req:      model.ReminderRequest{Time: "08:00"},
+			schedule: &model.Schedule{Frequency: model.ScheduleWeekly, Interval: 1, Times: 2},
+			records:  []string{"2024-03-10"},
+			now:      "2024-03-12T12:00:00Z",
+			want:     1,
+		},
+		{
+			name:     "times a week already met",
+			req:      model.ReminderRequest{Time: "08:00"},
+			schedule: &model.Schedule{Frequency: model.ScheduleWeekly, Interval: 1, Times: 2},
+			records:  []string{"2024-03-10", "2024-03-11"},
+			now:      "2024-03-12T12:00:00Z",
+		},
+		{
+			name: "disabled",
+			req:  model.ReminderRequest{Time: "08:00", Enabled: new(bool)},
+			now:  "2024-03-11T12:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newReminderFixture()
+			if tt.schedule != nil {
+				f.habits.habits[0].Schedule = tt.schedule
+			}
+			for _, date := range tt.records {
+				f.records.records = append(f.records.records, model.Record{UserID: testUserID, HabitID: 1, Date: mustDate(date)})
+			}
+			tt.req.HabitID, tt.req.Channel = 1, "test"
+			if _, err := f.svc.Create(testUserID, &tt.req); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if n := f.dispatch(t, f.svc, tt.now); n != tt.want {
+				t.Errorf("Dispatch() sent %d reminders, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+// emailNotifier records notifications like the email channel would accept
+// them.
+type emailNotifier struct {
+	recordingNotifier
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, notification *model.Notification) error {
+	if notification.Email == "" {
+		return notify.ErrNoAddress
+	}
+	return n.recordingNotifier.Notify(ctx, notification)
+}
+
+func TestReminderService_Email(t *testing.T) {
+	f := newReminderFixture()
+	email := &emailNotifier{}
+	svc := NewReminderService(f.reminders, f.habits, f.records, f.users, NewCalendarService(f.users, testCalendar, true),
+		map[string]notify.Notifier{notify.Email: email})
+
+	_, err := svc.Create(testUserID, &model.ReminderRequest{HabitID: 1, Time: "20:00", Channel: notify.Email})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Code != "no_email" {
+		t.Fatalf("Create() without an address error = %v, want channel no_email", err)
+	}
+
+	f.users.users[0].Email = "bob@example.com"
+	if _, err := svc.Create(testUserID, &model.ReminderRequest{HabitID: 1, Time: "20:00", Channel: notify.Email}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := svc.Dispatch(context.Background(), mustTime(t, "2024-03-11T12:00:00Z")); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if len(email.sent) != 1 || email.sent[0].Email != "bob@example.com" {
+		t.Fatalf("Dispatch() sent %+v, want one email to bob@example.com", email.sent)
+	}
+
+	// Without an address Wednesday's reminder is skipped, not retried.
+	f.users.users[0].Email = ""
+	if err := svc.Dispatch(context.Background(), mustTime(t, "2024-03-13T12:00:00Z")); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if fired := f.reminders.reminders[0].LastFiredOn; len(email.sent) != 1 || *fired != mustDate("2024-03-13") {
+		t.Errorf("Dispatch() without an address sent %d, last fired on %v, want 1 and 2024-03-13", len(email.sent), fired)
+	}
+}
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return at
+}
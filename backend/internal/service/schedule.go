@@ -0,0 +1,309 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+)
+
+const (
+	defaultCompletionDays = 30
+	maxCompletionDays     = 5 * 366
+	maxScheduleInterval   = 365
+)
+
+type ScheduleService interface {
+	// Completion reports how well one of the user's habits kept to its
+	// schedule over a range of dates in cal.
+	Completion(userID, habitID int64, cal *model.Calendar, query *model.CompletionQuery) (*model.Completion, error)
+}
+
+type scheduleService struct {
+	habits  repository.HabitRepository
+	records repository.RecordRepository
+	now     func() time.Time
+}
+
+func NewScheduleService(habits repository.HabitRepository, records repository.RecordRepository) ScheduleService {
+	return &scheduleService{habits: habits, records: records, now: time.Now}
+}
+
+func (s *scheduleService) Completion(userID, habitID int64, cal *model.Calendar, query *model.CompletionQuery) (*model.Completion, error) {
+	day := today(cal, s.now())
+	from, to, err := dateRange(query.From, query.To, day, defaultCompletionDays, maxCompletionDays)
+	if err != nil {
+		return nil, err
+	}
+
+	habit, err := s.habits.GetByID(userID, habitID)
+	if err != nil {
+		return nil, err
+	}
+	if habit == nil {
+		return nil, ErrHabitNotFound
+	}
+
+	occurrences := ExpandSchedule(habit.Schedule, from, to, cal.WeekStart)
+	completion := &model.Completion{HabitID: habit.ID, Schedule: habit.Schedule, From: from, To: to, Occurrences: occurrences}
+	if len(occurrences) == 0 {
+		return completion, nil
+	}
+
+	// Occurrences keep their full span, so count the days they reach
+	// outside the range too.
+	totals, err := s.records.GetDailyTotals(userID, &model.RecordFilter{
+		HabitID: habit.ID,
+		From:    occurrences[0].Start.String(),
+		To:      occurrences[len(occurrences)-1].End.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[model.Date]bool, len(totals))
+	for _, t := range totals {
+		if t.Count > 0 {
+			active[t.Date] = true
+		}
+	}
+
+	markOccurrences(occurrences, active, day)
+	for _, o := range occurrences {
+		if o.Finished {
+			completion.Finished++
+			if o.Met {
+				completion.Met++
+			}
+		}
+	}
+	if completion.Finished > 0 {
+		completion.Rate = percent(completion.Met, completion.Finished)
+	}
+	return completion, nil
+}
+
+// normalizeSchedule checks schedule, reporting every invalid field at once,
+// and fills in its defaults: an interval of 1, once a month, and weekdays
+// named in lower case in week order.
+func normalizeSchedule(schedule *model.Schedule) error {
+	errs := &ValidationError{}
+
+	switch schedule.Frequency {
+	case model.ScheduleDaily, model.ScheduleWeekly, model.ScheduleMonthly:
+	case "":
+		errs.add(fieldError("frequency", "required", "is required"))
+	default:
+		errs.add(fieldError("frequency", "invalid", "must be %s, %s or %s", model.ScheduleDaily, model.ScheduleWeekly, model.ScheduleMonthly))
+	}
+
+	if schedule.Interval == 0 {
+		schedule.Interval = 1
+	}
+	if schedule.Interval < 1 || schedule.Interval > maxScheduleInterval {
+		errs.add(fieldError("interval", "out_of_range", "must be between 1 and %d", maxScheduleInterval))
+	}
+
+	schedule.Weekdays = normalizeWeekdays(schedule.Weekdays, errs)
+	weekdays := len(schedule.Weekdays)
+
+	if schedule.Frequency == model.ScheduleMonthly && schedule.Times == 0 {
+		schedule.Times = 1
+	}
+	switch schedule.Frequency {
+	case model.ScheduleDaily:
+		if weekdays > 0 {
+			errs.add(fieldError("weekdays", "invalid", "only applies to weekly schedules"))
+		}
+		if schedule.Times != 0 {
+			errs.add(fieldError("times", "invalid", "only applies to weekly and monthly schedules"))
+		}
+	case model.ScheduleWeekly:
+		switch {
+		case weekdays > 0 && schedule.Times != 0:
+			errs.add(fieldError("times", "invalid", "cannot be combined with weekdays"))
+		case weekdays == 0 && schedule.Times == 0 && !errs.has("weekdays[0]"):
+			errs.add(fieldError("weekdays", "required", "is required unless times is given"))
+		case schedule.Times != 0 && (schedule.Times < 1 || schedule.Times > 7):
+			errs.add(fieldError("times", "out_of_range", "must be between 1 and 7"))
+		}
+	case model.ScheduleMonthly:
+		if weekdays > 0 {
+			errs.add(fieldError("weekdays", "invalid", "only applies to weekly schedules"))
+		}
+		if schedule.Times < 1 || schedule.Times > 31 {
+			errs.add(fieldError("times", "out_of_range", "must be between 1 and 31"))
+		}
+	}
+	if schedule.Times != 0 && schedule.Interval > 1 && !errs.has("times") {
+		errs.add(fieldError("interval", "invalid", "must be 1 when times is given"))
+	}
+	if schedule.Interval > 1 && schedule.Anchor == nil {
+		errs.add(fieldError("anchor", "required", "is required when interval is more than 1"))
+	}
+
+	return errs.err()
+}
+
+// normalizeWeekdays names days of the week in lower case and week order,
+// dropping repeats, and adds an error to errs for each unknown name.
+func normalizeWeekdays(names []string, errs *ValidationError) []string {
+	days := make(map[time.Weekday]bool)
+	for i, name := range names {
+		day, ok := parseWeekday(strings.TrimSpace(name))
+		if !ok {
+			errs.add(fieldError(fmt.Sprintf("weekdays[%d]", i), "invalid", "must be a day of the week such as monday"))
+			continue
+		}
+		days[day] = true
+	}
+
+	var weekdays []string
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if days[day] {
+			weekdays = append(weekdays, strings.ToLower(day.String()))
+		}
+	}
+	return weekdays
+}
+
+// ExpandSchedule returns the occurrences of schedule that overlap from..to,
+// in order. A nil schedule is due every day. Occurrences keep their full
+// span, so a week or month may reach outside the range. Weeks start on
+// weekStart.
+func ExpandSchedule(schedule *model.Schedule, from, to model.Date, weekStart time.Weekday) []model.Occurrence {
+	occurrences := []model.Occurrence{}
+	if schedule == nil {
+		schedule = &model.Schedule{Frequency: model.ScheduleDaily, Interval: 1}
+	}
+	interval := schedule.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	anchor := from
+	if schedule.Anchor != nil {
+		anchor = *schedule.Anchor
+	}
+
+	if schedule.Times > 0 {
+		start := startOfWeek(from, weekStart)
+		if schedule.Frequency == model.ScheduleMonthly {
+			t := from.Time()
+			start = model.NewDate(t.Year(), t.Month(), 1)
+		}
+		for !start.After(to) {
+			next := start.AddDays(7)
+			if schedule.Frequency == model.ScheduleMonthly {
+				t := start.Time()
+				next = model.NewDate(t.Year(), t.Month()+1, 1)
+			}
+			occurrences = append(occurrences, model.Occurrence{Start: start, End: next.AddDays(-1), Required: schedule.Times})
+			start = next
+		}
+		return occurrences
+	}
+
+	weekdays := make(map[time.Weekday]bool)
+	for _, name := range schedule.Weekdays {
+		if day, ok := parseWeekday(name); ok {
+			weekdays[day] = true
+		}
+	}
+	for day := from; !day.After(to); day = day.AddDays(1) {
+		due := floorMod(daysBetween(anchor, day), interval) == 0
+		if schedule.Frequency == model.ScheduleWeekly {
+			weeks := daysBetween(startOfWeek(anchor, weekStart), startOfWeek(day, weekStart)) / 7
+			due = weekdays[day.Weekday()] && floorMod(weeks, interval) == 0
+		}
+		if due {
+			occurrences = append(occurrences, model.Occurrence{Start: day, End: day, Required: 1})
+		}
+	}
+	return occurrences
+}
+
+// markOccurrences counts the active days up to today in each occurrence and
+// sets whether it was met and whether it is over.
+func markOccurrences(occurrences []model.Occurrence, active map[model.Date]bool, today model.Date) {
+	for i := range occurrences {
+		o := &occurrences[i]
+		o.Done = 0
+		for day := o.Start; !day.After(o.End) && !day.After(today); day = day.AddDays(1) {
+			if active[day] {
+				o.Done++
+			}
+		}
+		o.Met = o.Done >= o.Required
+		o.Finished = o.End.Before(today)
+	}
+}
+
+// scheduledStreak is calculateStreak for a habit with a schedule. A streak
+// counts consecutive occurrences that were met: days off the schedule
+// neither extend nor break it, and the occurrence under way only counts once
+// it is met. Dates after today are ignored.
+func scheduledStreak(schedule *model.Schedule, dates []model.Date, today model.Date, weekStart time.Weekday) model.Streak {
+	active := make(map[model.Date]bool)
+	var days []model.Date
+	for _, day := range dates {
+		if day.After(today) || active[day] {
+			continue
+		}
+		active[day] = true
+		days = append(days, day)
+	}
+
+	var streak model.Streak
+	if len(days) == 0 {
+		return streak
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	occurrences := ExpandSchedule(schedule, days[0], today, weekStart)
+	markOccurrences(occurrences, active, today)
+	if n := len(occurrences); n > 0 && !occurrences[n-1].Finished && !occurrences[n-1].Met {
+		occurrences = occurrences[:n-1]
+	}
+
+	run := 0
+	var runStart model.Date
+	for _, o := range occurrences {
+		if !o.Met {
+			run = 0
+			continue
+		}
+		if run == 0 {
+			runStart = o.Start
+		}
+		run++
+		end := o.End
+		if end.After(today) {
+			end = today
+		}
+		if run > streak.Longest {
+			streak.Longest = run
+			streak.LongestStart = runStart.String()
+			streak.LongestEnd = end.String()
+		}
+		streak.Current = run
+		streak.CurrentStart = runStart.String()
+		streak.CurrentEnd = end.String()
+	}
+	if run == 0 {
+		streak.Current, streak.CurrentStart, streak.CurrentEnd = 0, "", ""
+	}
+	return streak
+}
+
+// daysBetween returns the number of days from a to b, negative when b comes
+// first.
+func daysBetween(a, b model.Date) int {
+	return int(b.Time().Sub(a.Time()).Hours() / 24)
+}
+
+// floorMod is n modulo m, never negative for a positive m.
+func floorMod(n, m int) int {
+	return ((n % m) + m) % m
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+// occurrenceSpans lists occurrences as start..end/required, for compact
+// expectations.
+func occurrenceSpans(occurrences []model.Occurrence) []string {
+	spans := make([]string, len(occurrences))
+	for i, o := range occurrences {
+		spans[i] = o.Start.String()
+		if o.End != o.Start {
+			spans[i] += ".." + o.End.String()
+		}
+		if o.Required != 1 {
+			spans[i] += "/" + strconv.Itoa(o.Required)
+		}
+	}
+	return spans
+}
+
+func TestNormalizeSchedule(t *testing.T) {
+	anchor := mustDate("2024-03-04")
+
+	tests := []struct {
+		name     string
+		schedule model.Schedule
+		want     model.Schedule
+		errs     map[string]string
+	}{
+		{
+			name:     "weekdays are named in order",
+			schedule: model.Schedule{Frequency: "weekly", Weekdays: []string{"Friday", " monday", "WEDNESDAY", "friday"}},
+			want:     model.Schedule{Frequency: "weekly", Interval: 1, Weekdays: []string{"monday", "wednesday", "friday"}},
+		},
+		{
+			name:     "monthly defaults to once",
+			schedule: model.Schedule{Frequency: "monthly"},
+			want:     model.Schedule{Frequency: "monthly", Interval: 1, Times: 1},
+		},
+		{
+			name:     "interval with an anchor",
+			schedule: model.Schedule{Frequency: "daily", Interval: 3, Anchor: &anchor},
+			want:     model.Schedule{Frequency: "daily", Interval: 3, Anchor: &anchor},
+		},
+		{
+			name:     "unknown frequency and bad weekday",
+			schedule: model.Schedule{Frequency: "hourly", Weekdays: []string{"mon"}},
+			errs:     map[string]string{"frequency": "invalid", "weekdays[0]": "invalid"},
+		},
+		{
+			name:     "weekly needs days or times",
+			schedule: model.Schedule{Frequency: "weekly"},
+			errs:     map[string]string{"weekdays": "required"},
+		},
+		{
+			name:     "weekdays and times together",
+			schedule: model.Schedule{Frequency: "weekly", Weekdays: []string{"monday"}, Times: 2},
+			errs:     map[string]string{"times": "invalid"},
+		},
+		{
+			name:     "too many times a week",
+			schedule: model.Schedule{Frequency: "weekly", Times: 8},
+			errs:     map[string]string{"times": "out_of_range"},
+		},
+		{
+			name:     "daily with weekdays and times",
+			schedule: model.Schedule{Frequency: "daily", Weekdays: []string{"monday"}, Times: 2},
+			errs:     map[string]string{"weekdays": "invalid", "times": "invalid"},
+		},
+		{
+			name:     "interval without anchor",
+			schedule: model.Schedule{Frequency: "weekly", Interval: 2, Weekdays: []string{"monday"}},
+			errs:     map[string]string{"anchor": "required"},
+		},
+		{
+			name:     "interval with times",
+			schedule: model.Schedule{Frequency: "monthly", Interval: 2, Times: 3, Anchor: &anchor},
+			errs:     map[string]string{"interval": "invalid"},
+		},
+		{
+			name:     "interval out of range",
+			schedule: model.Schedule{Frequency: "daily", Interval: -1},
+			errs:     map[string]string{"interval": "out_of_range"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := normalizeSchedule(&tt.schedule)
+			if tt.errs == nil {
+				if err != nil || !reflect.DeepEqual(tt.schedule, tt.want) {
+					t.Errorf("normalizeSchedule() = %+v, %v, want %+v", tt.schedule, err, tt.want)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("normalizeSchedule() error = %v, want a ValidationError", err)
+			}
+			got := make(map[string]string)
+			for _, f := range verr.Fields {
+				got[f.Field] = f.Code
+			}
+			if !reflect.DeepEqual(got, tt.errs) {
+				t.Errorf("normalizeSchedule() field errors = %v, want %v", got, tt.errs)
+			}
+		})
+	}
+}
+
+func TestExpandSchedule(t *testing.T) {
+	anchor := mustDate("2024-03-01")
+
+	tests := []struct {
+		name      string
+		schedule  *model.Schedule
+		from, to  string
+		weekStart time.Weekday
+		want      []string
+	}{
+		{
+			name: "no schedule is every day",
+			from: "2024-03-01",
+			to:   "2024-03-03",
+			want: []string{"2024-03-01", "2024-03-02", "2024-03-03"},
+		},
+		{
+			name:     "every third day from the anchor",
+			schedule: &model.Schedule{Frequency: "daily", Interval: 3, Anchor: &anchor},
+			from:     "2024-02-25",
+			to:       "2024-03-08",
+			want:     []string{"2024-02-27", "2024-03-01", "2024-03-04", "2024-03-07"},
+		},
+		{
+			name:     "weekdays",
+			schedule: &model.Schedule{Frequency: "weekly", Interval: 1, Weekdays: []string{"monday", "wednesday", "friday"}},
+			from:     "2024-03-01",
+			to:       "2024-03-10",
+			want:     []string{"2024-03-01", "2024-03-04", "2024-03-06", "2024-03-08"},
+		},
+		{
+			name:      "every other week from the anchor's week",
+			schedule:  &model.Schedule{Frequency: "weekly", Interval: 2, Weekdays: []string{"monday", "saturday"}, Anchor: &anchor},
+			from:      "2024-02-19",
+			to:        "2024-03-17",
+			weekStart: time.Monday,
+			want:      []string{"2024-02-26", "2024-03-02", "2024-03-11", "2024-03-16"},
+		},
+		{
+			name:      "week start decides which weeks",
+			schedule:  &model.Schedule{Frequency: "weekly", Interval: 2, Weekdays: []string{"sunday"}, Anchor: &anchor},
+			from:      "2024-02-25",
+			to:        "2024-03-10",
+			weekStart: time.Monday,
+			want:      []string{"2024-03-03"},
+		},
+		{
+			name:      "times per week keep whole weeks",
+			schedule:  &model.Schedule{Frequency: "weekly", Interval: 1, Times: 3},
+			from:      "2024-03-06",
+			to:        "2024-03-12",
+			weekStart: time.Monday,
+			want:      []string{"2024-03-04..2024-03-10/3", "2024-03-11..2024-03-17/3"},
+		},
+		{
+			name:     "times per month",
+			schedule: &model.Schedule{Frequency: "monthly", Interval: 1, Times: 4},
+			from:     "2024-01-31",
+			to:       "2024-02-01",
+			want:     []string{"2024-01-01..2024-01-31/4", "2024-02-01..2024-02-29/4"},
+		},
+		{
+			name:     "empty range",
+			schedule: &model.Schedule{Frequency: "weekly", Interval: 1, Weekdays: []string{"monday"}},
+			from:     "2024-03-05",
+			to:       "2024-03-10",
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := occurrenceSpans(ExpandSchedule(tt.schedule, mustDate(tt.from), mustDate(tt.to), tt.weekStart))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandSchedule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduledStreak(t *testing.T) {
+	today := mustDate("2024-03-13") // a Wednesday
+	mwf := &model.Schedule{Frequency: "weekly", Interval: 1, Weekdays: []string{"monday", "wednesday", "friday"}}
+	thrice := &model.Schedule{Frequency: "weekly", Interval: 1, Times: 3}
+
+	tests := []struct {
+		name     string
+		schedule *model.Schedule
+		dates    []string
+		want     model.Streak
+	}{
+		{
+			name:     "days off the schedule do not break a streak",
+			schedule: mwf,
+			dates:    []string{"2024-03-04", "2024-03-06", "2024-03-08", "2024-03-11"},
+			want: model.Streak{
+				Current: 4, CurrentStart: "2024-03-04", CurrentEnd: "2024-03-11",
+				Longest: 4, LongestStart: "2024-03-04", LongestEnd: "2024-03-11",
+			},
+		},
+		{
+			name:     "days off the schedule do not count",
+			schedule: mwf,
+			dates:    []string{"2024-03-05", "2024-03-07", "2024-03-11", "2024-03-12", "2024-03-13"},
+			want: model.Streak{
+				Current: 2, CurrentStart: "2024-03-11", CurrentEnd: "2024-03-13",
+				Longest: 2, LongestStart: "2024-03-11", LongestEnd: "2024-03-13",
+			},
+		},
+		{
+			name:     "a missed scheduled day breaks it",
+			schedule: mwf,
+			dates:    []string{"2024-03-01", "2024-03-04", "2024-03-06", "2024-03-11"},
+			want: model.Streak{
+				Current: 1, CurrentStart: "2024-03-11", CurrentEnd: "2024-03-11",
+				Longest: 3, LongestStart: "2024-03-01", LongestEnd: "2024-03-06",
+			},
+		},
+		{
+			name:     "missing the last scheduled day ends it",
+			schedule: mwf,
+			dates:    []string{"2024-03-04", "2024-03-06", "2024-03-08"},
+			want: model.Streak{
+				Longest: 3, LongestStart: "2024-03-04", LongestEnd: "2024-03-08",
+			},
+		},
+		{
+			name:     "weeks in progress count once met",
+			schedule: thrice,
+			dates:    []string{"2024-02-26", "2024-02-27", "2024-03-01", "2024-03-04", "2024-03-05", "2024-03-09", "2024-03-11", "2024-03-12", "2024-03-13"},
+			want: model.Streak{
+				Current: 3, CurrentStart: "2024-02-25", CurrentEnd: "2024-03-13",
+				Longest: 3, LongestStart: "2024-02-25", LongestEnd: "2024-03-13",
+			},
+		},
+		{
+			name:     "a week in progress does not break it",
+			schedule: thrice,
+			dates:    []string{"2024-03-04", "2024-03-05", "2024-03-09", "2024-03-12"},
+			want: model.Streak{
+				Current: 1, CurrentStart: "2024-03-03", CurrentEnd: "2024-03-09",
+				Longest: 1, LongestStart: "2024-03-03", LongestEnd: "2024-03-09",
+			},
+		},
+		{
+			name:     "no records",
+			schedule: mwf,
+			want:     model.Streak{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scheduledStreak(tt.schedule, mustDates(tt.dates...), today, time.Sunday); got != tt.want {
+				t.Errorf("scheduledStreak() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduledStreak_DailyMatchesCalculateStreak(t *testing.T) {
+	today := mustDate("2024-03-10")
+	daily := &model.Schedule{Frequency: "daily", Interval: 1}
+	for _, dates := range [][]string{
+		{"2024-03-10"},
+		{"2024-03-07", "2024-03-08", "2024-03-09"},
+		{"2024-03-07", "2024-03-08"},
+		{"2024-02-01", "2024-02-02", "2024-02-03", "2024-03-09", "2024-03-10", "2024-03-11"},
+	} {
+		if got, want := scheduledStreak(daily, mustDates(dates...), today, time.Sunday), calculateStreak(mustDates(dates...), today); got != want {
+			t.Errorf("scheduledStreak(%v) = %+v, want %+v", dates, got, want)
+		}
+	}
+}
+
+func TestScheduleService_Completion(t *testing.T) {
+	habits := newMockHabitRepository()
+	habits.Create(&model.Habit{UserID: testUserID, Name: "Gym", Schedule: &model.Schedule{Frequency: "weekly", Interval: 1, Weekdays: []string{"monday", "wednesday", "friday"}}})
+	records := newMockRepository()
+	for _, date := range []string{"2024-03-01", "2024-03-02", "2024-03-04", "2024-03-08", "2024-03-13"} {
+		records.records = append(records.records, model.Record{UserID: testUserID, HabitID: 1, Date: mustDate(date)})
+	}
+	svc := &scheduleService{habits: habits, records: records, now: func() time.Time {
+		return time.Date(2024, 3, 13, 8, 0, 0, 0, time.UTC)
+	}}
+
+	completion, err := svc.Completion(testUserID, 1, testCalendar, &model.CompletionQuery{From: "2024-03-01", To: "2024-03-15"})
+	if err != nil {
+		t.Fatalf("Completion() error = %v", err)
+	}
+	var met []string
+	for _, o := range completion.Occurrences {
+		if o.Met {
+			met = append(met, o.Start.String())
+		}
+	}
+	if want := []string{"2024-03-01", "2024-03-04", "2024-03-08", "2024-03-13"}; !reflect.DeepEqual(met, want) {
+		t.Errorf("Completion() met occurrences = %v, want %v", met, want)
+	}
+	if len(completion.Occurrences) != 7 || completion.Finished != 5 || completion.Met != 3 || completion.Rate != 60 {
+		t.Errorf("Completion() = %d occurrences, %d finished, %d met, rate %v, want 7, 5, 3, 60",
+			len(completion.Occurrences), completion.Finished, completion.Met, completion.Rate)
+	}
+
+	if _, err := svc.Completion(testUserID+1, 1, testCalendar, &model.CompletionQuery{}); !errors.Is(err, ErrHabitNotFound) {
+		t.Errorf("Completion() of another user's habit error = %v, want %v", err, ErrHabitNotFound)
+	}
+	if _, err := svc.Completion(testUserID, 1, testCalendar, &model.CompletionQuery{From: "2024-03-20", To: "2024-03-15"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Completion() of a reversed range error = %v, want %v", err, ErrInvalidInput)
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+)
+
+const (
+	defaultHeatmapDays = 365
+	maxHeatmapDays     = 5 * 366
+	// heatmapLevels is the number of levels for days with activity; level 0
+	// is reserved for days without.
+	heatmapLevels = 4
+)
+
+type seriesInterval struct {
+	defaultDays int
+	maxDays     int
+}
+
+// seriesIntervals keeps every series to about a thousand buckets at most.
+var seriesIntervals = map[string]seriesInterval{
+	"day":   {defaultDays: 30, maxDays: 3 * 366},
+	"week":  {defaultDays: 12 * 7, maxDays: 10 * 366},
+	"month": {defaultDays: 365, maxDays: 20 * 366},
+	"year":  {defaultDays: 5 * 365, maxDays: 100 * 366},
+}
+
+type StatsService interface {
+	GetHeatmap(userID int64, cal *model.Calendar, query *model.HeatmapQuery) (*model.Heatmap, error)
+	GetSeries(userID int64, cal *model.Calendar, query *model.SeriesQuery) (*model.Series, error)
+}
+
+type statsService struct {
+	records repository.RecordRepository
+	now     func() time.Time
+}
+
+func NewStatsService(records repository.RecordRepository) StatsService {
+	return &statsService{records: records, now: time.Now}
+}
+
+// GetHeatmap totals the user's activity per day and sorts the active days
+// into levels by the quartiles of their values, so that every client draws
+// the same intensities.
+func (s *statsService) GetHeatmap(userID int64, cal *model.Calendar, query *model.HeatmapQuery) (*model.Heatmap, error) {
+	metric := query.Metric
+	if metric == "" {
+		metric = "count"
+	}
+	if metric != "count" && metric != "duration" {
+		return nil, fieldError("metric", "invalid", "must be count or duration")
+	}
+
+	from, to, err := dateRange(query.From, query.To, today(cal, s.now()), defaultHeatmapDays, maxHeatmapDays)
+	if err != nil {
+		return nil, err
+	}
+
+	totals, err := s.records.GetDailyTotals(userID, &model.RecordFilter{From: from.String(), To: to.String(), HabitID: query.HabitID})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]int, len(totals))
+	for i, t := range totals {
+		values[i] = t.Count
+		if metric == "duration" {
+			values[i] = t.Duration
+		}
+	}
+	thresholds := quantileThresholds(values, heatmapLevels)
+
+	heatmap := &model.Heatmap{
+		From:       from,
+		To:         to,
+		Metric:     metric,
+		Thresholds: thresholds,
+		Days:       make([]model.HeatmapDay, len(totals)),
+	}
+	for i, t := range totals {
+		heatmap.Days[i] = model.HeatmapDay{DayTotal: t, Value: values[i], Level: levelOf(values[i], thresholds)}
+	}
+	return heatmap, nil
+}
+
+// GetSeries totals the user's activity per interval, filling in the buckets
+// without any, and optionally per content as well. Weeks start on the
+// calendar's first day.
+func (s *statsService) GetSeries(userID int64, cal *model.Calendar, query *model.SeriesQuery) (*model.Series, error) {
+	interval := query.Interval
+	if interval == "" {
+		interval = "day"
+	}
+	limits, ok := seriesIntervals[interval]
+	if !ok {
+		return nil, fieldError("interval", "invalid", "must be day, week, month or year")
+	}
+	if query.GroupBy != "" && query.GroupBy != "content" {
+		return nil, fieldError("groupBy", "invalid", "must be content")
+	}
+
+	from, to, err := dateRange(query.From, query.To, today(cal, s.now()), limits.defaultDays, limits.maxDays)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &model.RecordFilter{From: from.String(), To: to.String(), HabitID: query.HabitID}
+	totals, err := s.records.GetSeries(userID, filter, interval, cal.WeekStart, query.GroupBy != "")
+	if err != nil {
+		return nil, err
+	}
+
+	starts := bucketStarts(from, to, interval, cal.WeekStart)
+	index := make(map[model.Date]int, len(starts))
+	for i, start := range starts {
+		index[start] = i
+	}
+
+	series := &model.Series{
+		Interval: interval,
+		From:     from,
+		To:       to,
+		GroupBy:  query.GroupBy,
+		Buckets:  emptyBuckets(starts),
+	}
+	groups := make(map[string]*model.SeriesGroup)
+	for _, t := range totals {
+		i, ok := index[t.Bucket]
+		if !ok {
+			return nil, fmt.Errorf("bucket %s is not a %s in %s..%s", t.Bucket, interval, from, to)
+		}
+		addToBucket(&series.Buckets[i], t)
+
+		if query.GroupBy != "" {
+			group := groups[t.Key]
+			if group == nil {
+				group = &model.SeriesGroup{Key: t.Key, Buckets: emptyBuckets(starts)}
+				groups[t.Key] = group
+			}
+			addToBucket(&group.Buckets[i], t)
+		}
+	}
+
+	for _, group := range groups {
+		series.Groups = append(series.Groups, *group)
+	}
+	sort.Slice(series.Groups, func(i, j int) bool { return series.Groups[i].Key < series.Groups[j].Key })
+	return series, nil
+}
+
+// bucketStarts lists the first day of every bucket overlapping from..to.
+func bucketStarts(from, to model.Date, interval string, weekStart time.Weekday) []model.Date {
+	start := from
+	switch interval {
+	case "week":
+		start = startOfWeek(from, weekStart)
+	case "month":
+		start = model.NewDate(from.Time().Year(), from.Time().Month(), 1)
+	case "year":
+		start = model.NewDate(from.Time().Year(), 1, 1)
+	}
+
+	var starts []model.Date
+	for d := start; !d.After(to); {
+		starts = append(starts, d)
+		t := d.Time()
+		switch interval {
+		case "week":
+			d = d.AddDays(7)
+		case "month":
+			d = model.NewDate(t.Year(), t.Month()+1, 1)
+		case "year":
+			d = model.NewDate(t.Year()+1, 1, 1)
+		default:
+			d = d.AddDays(1)
+		}
+	}
+	return starts
+}
+
+func emptyBuckets(starts []model.Date) []model.SeriesBucket {
+	buckets := make([]model.SeriesBucket, len(starts))
+	for i, start := range starts {
+		buckets[i].Start = start
+	}
+	return buckets
+}
+
+func addToBucket(b *model.SeriesBucket, t model.SeriesTotal) {
+	b.Count += t.Count
+	b.Duration += t.Duration
+	b.Average = math.Round(float64(b.Duration)/float64(b.Count)*100) / 100
+}
+
+// dateRange validates an inclusive from/to range of YYYY-MM-DD dates. Missing
+// ends default to a range of defaultDays ending on today, a civil date.
+func dateRange(from, to string, today model.Date, defaultDays, maxDays int) (model.Date, model.Date, error) {
+	end := today
+	if to != "" {
+		d, err := model.ParseDate(to)
+		if err != nil {
+			return model.Date{}, model.Date{}, fieldError("to", "invalid_date", "must be a calendar date written as YYYY-MM-DD")
+		}
+		end = d
+	}
+
+	start := end.AddDays(1 - defaultDays)
+	if from != "" {
+		d, err := model.ParseDate(from)
+		if err != nil {
+			return model.Date{}, model.Date{}, fieldError("from", "invalid_date", "must be a calendar date written as YYYY-MM-DD")
+		}
+		start = d
+	}
+
+	switch {
+	case start.After(end):
+		return model.Date{}, model.Date{}, fieldError("from", "out_of_range", "must not be after to")
+	case daysBetween(start, end) >= maxDays:
+		return model.Date{}, model.Date{}, fieldError("from", "out_of_range", "must be less than %d days before to", maxDays)
+	}
+	return start, end, nil
+}
+
+// quantileThresholds returns the upper bounds of the first levels-1 of levels
+// equally populated groups of values, using the nearest-rank method.
+func quantileThresholds(values []int, levels int) []int {
+	thresholds := []int{}
+	if len(values) == 0 {
+		return thresholds
+	}
+
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	for i := 1; i < levels; i++ {
+		rank := int(math.Ceil(float64(i) / float64(levels) * float64(len(sorted))))
+		thresholds = append(thresholds, sorted[rank-1])
+	}
+	return thresholds
+}
+
+// levelOf places value in the levels bounded by thresholds, counting from 1.
+func levelOf(value int, thresholds []int) int {
+	for i, t := range thresholds {
+		if value <= t {
+			return i + 1
+		}
+	}
+	return len(thresholds) + 1
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+func TestQuantileThresholds(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		want   []int
+	}{
+		{"empty", nil, []int{}},
+		{"single", []int{5}, []int{5, 5, 5}},
+		{"spread", []int{8, 1, 4, 2, 6, 3, 7, 5}, []int{2, 4, 6}},
+		{"ties", []int{1, 1, 1, 1, 9}, []int{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quantileThresholds(tt.values, 4); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("quantileThresholds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsService_GetHeatmap(t *testing.T) {
+	repo := newMockRepository()
+	records := NewRecordService(repo, newMockHabitRepository(), nil, 1)
+	for _, req := range []model.CreateRecordRequest{
+		{Date: "2024-03-01", Content: "Running", Duration: 10},
+		{Date: "2024-03-02", Content: "Running", Duration: 20},
+		{Date: "2024-03-02", Content: "Reading", Duration: 20},
+		{Date: "2024-03-03", Content: "Running", Duration: 30},
+		{Date: "2024-03-04", Content: "Running", Duration: 90},
+		{Date: "2023-01-01", Content: "Running", Duration: 90},
+	} {
+		req := req
+		if _, err := records.Create(testActor, testCalendar, &req); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	svc := &statsService{
+		records: repo,
+		now:     func() time.Time { return time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC) },
+	}
+
+	heatmap, err := svc.GetHeatmap(testUserID, testCalendar, &model.HeatmapQuery{From: "2024-03-01", Metric: "duration"})
+	if err != nil {
+		t.Fatalf("GetHeatmap() error = %v", err)
+	}
+	if heatmap.To != mustDate("2024-03-10") {
+		t.Errorf("GetHeatmap() to = %s, want today", heatmap.To)
+	}
+	if want := []int{10, 30, 40}; !reflect.DeepEqual(heatmap.Thresholds, want) {
+		t.Errorf("GetHeatmap() thresholds = %v, want %v", heatmap.Thresholds, want)
+	}
+	wantLevels := map[string]int{"2024-03-01": 1, "2024-03-02": 3, "2024-03-03": 2, "2024-03-04": 4}
+	if len(heatmap.Days) != len(wantLevels) {
+		t.Fatalf("GetHeatmap() returned %d days, want %d", len(heatmap.Days), len(wantLevels))
+	}
+	for _, d := range heatmap.Days {
+		if d.Level != wantLevels[d.Date.String()] {
+			t.Errorf("GetHeatmap() %s level = %d, want %d", d.Date, d.Level, wantLevels[d.Date.String()])
+		}
+	}
+
+	heatmap, err = svc.GetHeatmap(testUserID, testCalendar, &model.HeatmapQuery{})
+	if err != nil {
+		t.Fatalf("GetHeatmap() error = %v", err)
+	}
+	if heatmap.Metric != "count" || heatmap.From != mustDate("2023-03-12") || len(heatmap.Days) != 4 {
+		t.Errorf("GetHeatmap() defaults = %s %s..%s with %d days, want count over the last 365 days",
+			heatmap.Metric, heatmap.From, heatmap.To, len(heatmap.Days))
+	}
+}
+
+func TestStatsService_GetHeatmapRejectsBadQueries(t *testing.T) {
+	svc := NewStatsService(newMockRepository())
+
+	for _, query := range []model.HeatmapQuery{
+		{Metric: "calories"},
+		{From: "03/01/2024"},
+		{From: "2024-03-02", To: "2024-03-01"},
+		{From: "2010-01-01", To: "2024-01-01"},
+	} {
+		query := query
+		if _, err := svc.GetHeatmap(testUserID, testCalendar, &query); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("GetHeatmap(%+v) error = %v, want ErrInvalidInput", query, err)
+		}
+	}
+}
+
+func TestStatsService_GetSeries(t *testing.T) {
+	repo := newMockRepository()
+	records := NewRecordService(repo, newMockHabitRepository(), nil, 1)
+	for _, req := range []model.CreateRecordRequest{
+		{Date: "2024-02-28", Content: "Running", Duration: 10},
+		{Date: "2024-03-02", Content: "Running", Duration: 20},
+		{Date: "2024-03-02", Content: "Reading", Duration: 40},
+		{Date: "2024-03-12", Content: "Running", Duration: 30},
+	} {
+		req := req
+		if _, err := records.Create(testActor, testCalendar, &req); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	svc := &statsService{
+		records: repo,
+		now:     func() time.Time { return time.Date(2024, 3, 14, 8, 0, 0, 0, time.UTC) },
+	}
+
+	series, err := svc.GetSeries(testUserID, testCalendar, &model.SeriesQuery{Interval: "week", From: "2024-03-01"})
+	if err != nil {
+		t.Fatalf("GetSeries() error = %v", err)
+	}
+	want := []model.SeriesBucket{
+		{Start: mustDate("2024-02-25"), Count: 2, Duration: 60, Average: 30},
+		{Start: mustDate("2024-03-03")},
+		{Start: mustDate("2024-03-10"), Count: 1, Duration: 30, Average: 30},
+	}
+	if !reflect.DeepEqual(series.Buckets, want) {
+		t.Errorf("GetSeries() buckets = %+v, want %+v", series.Buckets, want)
+	}
+
+	series, err = svc.GetSeries(testUserID, testCalendar, &model.SeriesQuery{Interval: "month", From: "2024-02-01", GroupBy: "content"})
+	if err != nil {
+		t.Fatalf("GetSeries() error = %v", err)
+	}
+	if len(series.Buckets) != 2 || series.Buckets[0].Count != 1 || series.Buckets[1].Average != 30 {
+		t.Errorf("GetSeries() buckets = %+v, want February and March", series.Buckets)
+	}
+	if len(series.Groups) != 2 || series.Groups[0].Key != "Reading" || series.Groups[1].Buckets[1].Duration != 50 {
+		t.Errorf("GetSeries() groups = %+v, want Reading then Running", series.Groups)
+	}
+
+	series, err = svc.GetSeries(testUserID, testCalendar, &model.SeriesQuery{})
+	if err != nil {
+		t.Fatalf("GetSeries() error = %v", err)
+	}
+	if series.Interval != "day" || len(series.Buckets) != 30 || series.Buckets[29].Start != mustDate("2024-03-14") {
+		t.Errorf("GetSeries() defaults = %s with %d buckets, want the last 30 days", series.Interval, len(series.Buckets))
+	}
+}
+
+func TestStatsService_GetSeriesRejectsBadQueries(t *testing.T) {
+	svc := NewStatsService(newMockRepository())
+
+	for _, query := range []model.SeriesQuery{
+		{Interval: "hour"},
+		{GroupBy: "notes"},
+		{Interval: "day", From: "2020-01-01", To: "2024-01-01"},
+	} {
+		query := query
+		if _, err := svc.GetSeries(testUserID, testCalendar, &query); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("GetSeries(%+v) error = %v, want ErrInvalidInput", query, err)
+		}
+	}
+}
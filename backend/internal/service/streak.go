@@ -0,0 +1,124 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+)
+
+type StreakService interface {
+	GetStreaks(userID int64, cal *model.Calendar) (*model.StreakReport, error)
+}
+
+type streakService struct {
+	records repository.RecordRepository
+	habits  repository.HabitRepository
+	now     func() time.Time
+}
+
+func NewStreakService(records repository.RecordRepository, habits repository.HabitRepository) StreakService {
+	return &streakService{records: records, habits: habits, now: time.Now}
+}
+
+// GetStreaks reports the user's streaks as of today in cal. The overall
+// streak counts every day with activity; those of habits with a schedule
+// count the days, weeks or months the habit was due.
+func (s *streakService) GetStreaks(userID int64, cal *model.Calendar) (*model.StreakReport, error) {
+	activity, err := s.records.GetActivityDates(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	habits, err := s.habits.GetAll(userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []model.Date
+	byHabit := make(map[int64][]model.Date)
+	for _, a := range activity {
+		all = append(all, a.Date)
+		if a.HabitID != 0 {
+			byHabit[a.HabitID] = append(byHabit[a.HabitID], a.Date)
+		}
+	}
+
+	day := today(cal, s.now())
+	report := &model.StreakReport{
+		Overall: calculateStreak(all, day),
+		Habits:  []model.HabitStreak{},
+	}
+	for _, h := range habits {
+		report.Habits = append(report.Habits, model.HabitStreak{
+			HabitID:  h.ID,
+			Name:     h.Name,
+			Schedule: h.Schedule,
+			Streak:   habitStreak(&h, byHabit[h.ID], day, cal.WeekStart),
+		})
+	}
+
+	return report, nil
+}
+
+// habitStreak finds the streaks of habit in the dates it was active, by its
+// schedule if it has one.
+func habitStreak(habit *model.Habit, dates []model.Date, today model.Date, weekStart time.Weekday) model.Streak {
+	if habit.Schedule != nil {
+		return scheduledStreak(habit.Schedule, dates, today, weekStart)
+	}
+	return calculateStreak(dates, today)
+}
+
+// calculateStreak finds runs of consecutive days in dates. Dates may repeat
+// and come in any order; dates after today are ignored. The current streak
+// is the run ending today, or yesterday when today has not been logged yet.
+func calculateStreak(dates []model.Date, today model.Date) model.Streak {
+	seen := make(map[model.Date]bool)
+	var days []model.Date
+	for _, day := range dates {
+		if day.After(today) || seen[day] {
+			continue
+		}
+		seen[day] = true
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	var streak model.Streak
+	if len(days) == 0 {
+		return streak
+	}
+
+	runStart := days[0]
+	runLength := 1
+	closeRun := func(end model.Date) {
+		if runLength > streak.Longest {
+			streak.Longest = runLength
+			streak.LongestStart = runStart.String()
+			streak.LongestEnd = end.String()
+		}
+	}
+
+	for i := 1; i < len(days); i++ {
+		if days[i] == days[i-1].AddDays(1) {
+			runLength++
+			continue
+		}
+		closeRun(days[i-1])
+		runStart = days[i]
+		runLength = 1
+	}
+
+	last := days[len(days)-1]
+	closeRun(last)
+
+	if !last.Before(today.AddDays(-1)) {
+		streak.Current = runLength
+		streak.CurrentStart = runStart.String()
+		streak.CurrentEnd = last.String()
+	}
+
+	return streak
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+func TestCalculateStreak(t *testing.T) {
+	today := mustDate("2024-03-10")
+
+	tests := []struct {
+		name  string
+		dates []string
+		want  model.Streak
+	}{
+		{
+			name:  "no records",
+			dates: nil,
+			want:  model.Streak{},
+		},
+		{
+			name:  "single record today",
+			dates: []string{"2024-03-10"},
+			want: model.Streak{
+				Current: 1, CurrentStart: "2024-03-10", CurrentEnd: "2024-03-10",
+				Longest: 1, LongestStart: "2024-03-10", LongestEnd: "2024-03-10",
+			},
+		},
+		{
+			name:  "run ending yesterday is still current",
+			dates: []string{"2024-03-07", "2024-03-08", "2024-03-09"},
+			want: model.Streak{
+				Current: 3, CurrentStart: "2024-03-07", CurrentEnd: "2024-03-09",
+				Longest: 3, LongestStart: "2024-03-07", LongestEnd: "2024-03-09",
+			},
+		},
+		{
+			name:  "run ending two days ago is broken",
+			dates: []string{"2024-03-07", "2024-03-08"},
+			want: model.Streak{
+				Longest: 2, LongestStart: "2024-03-07", LongestEnd: "2024-03-08",
+			},
+		},
+		{
+			name:  "multiple records on the same date count once",
+			dates: []string{"2024-03-09", "2024-03-10", "2024-03-10", "2024-03-09"},
+			want: model.Streak{
+				Current: 2, CurrentStart: "2024-03-09", CurrentEnd: "2024-03-10",
+				Longest: 2, LongestStart: "2024-03-09", LongestEnd: "2024-03-10",
+			},
+		},
+		{
+			name: "gap splits runs and longest is kept",
+			dates: []string{
+				"2024-02-01", "2024-02-02", "2024-02-03", "2024-02-04",
+				"2024-03-09", "2024-03-10",
+			},
+			want: model.Streak{
+				Current: 2, CurrentStart: "2024-03-09", CurrentEnd: "2024-03-10",
+				Longest: 4, LongestStart: "2024-02-01", LongestEnd: "2024-02-04",
+			},
+		},
+		{
+			name:  "unordered input across a month boundary",
+			dates: []string{"2024-03-01", "2024-02-28", "2024-02-29"},
+			want: model.Streak{
+				Longest: 3, LongestStart: "2024-02-28", LongestEnd: "2024-03-01",
+			},
+		},
+		{
+			name:  "earliest of equal runs is the longest",
+			dates: []string{"2024-01-01", "2024-01-02", "2024-01-05", "2024-01-06"},
+			want: model.Streak{
+				Longest: 2, LongestStart: "2024-01-01", LongestEnd: "2024-01-02",
+			},
+		},
+		{
+			name:  "future dates are ignored",
+			dates: []string{"2024-03-10", "2024-03-11", "2024-04-01"},
+			want: model.Streak{
+				Current: 1, CurrentStart: "2024-03-10", CurrentEnd: "2024-03-10",
+				Longest: 1, LongestStart: "2024-03-10", LongestEnd: "2024-03-10",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateStreak(mustDates(tt.dates...), today)
+			if got != tt.want {
+				t.Errorf("calculateStreak() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustDates(s ...string) []model.Date {
+	dates := make([]model.Date, len(s))
+	for i := range s {
+		dates[i] = mustDate(s[i])
+	}
+	return dates
+}
+
+func TestStreakService_GetStreaks(t *testing.T) {
+	repo := newMockRepository()
+	habits := newMockHabitRepository()
+	records := NewRecordService(repo, habits, nil, 1)
+	habits.Create(&model.Habit{UserID: testUserID, Name: "Gym", Schedule: &model.Schedule{Frequency: "weekly", Interval: 1, Weekdays: []string{"monday", "wednesday", "friday"}}})
+
+	for _, req := range []model.CreateRecordRequest{
+		{Date: "2024-03-04", Content: "Gym", Duration: 60},
+		{Date: "2024-03-06", Content: "Gym", Duration: 60},
+		{Date: "2024-03-08", Content: "Gym", Duration: 60},
+		{Date: "2024-03-08", Content: "Running", Duration: 30},
+		{Date: "2024-03-09", Content: "Running", Duration: 30},
+		{Date: "2024-03-10", Content: "Reading", Duration: 15},
+	} {
+		req := req
+		if _, err := records.Create(testActor, testCalendar, &req); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	svc := &streakService{
+		records: repo,
+		habits:  habits,
+		now:     func() time.Time { return time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC) },
+	}
+
+	report, err := svc.GetStreaks(testUserID, testCalendar)
+	if err != nil {
+		t.Fatalf("GetStreaks() error = %v", err)
+	}
+
+	if report.Overall.Current != 3 {
+		t.Errorf("GetStreaks() overall current = %d, want 3", report.Overall.Current)
+	}
+
+	// Gym is only due on Mondays, Wednesdays and Fridays.
+	want := map[string]int{"Running": 2, "Reading": 1, "Gym": 3}
+	if len(report.Habits) != len(want) {
+		t.Fatalf("GetStreaks() returned %d habits, want %d", len(report.Habits), len(want))
+	}
+	for _, h := range report.Habits {
+		if h.Current != want[h.Name] {
+			t.Errorf("GetStreaks() %s current = %d, want %d", h.Name, h.Current, want[h.Name])
+		}
+	}
+}
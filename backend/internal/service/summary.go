@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/notify"
+	"habit-tracker/internal/repository"
+	"habit-tracker/pkg/logger"
+)
+
+type SummaryService interface {
+	// Dispatch sends each user who asked for weekly summaries the totals of
+	// the week before, on the first day of the user's week. It is meant to
+	// run every hour or so.
+	Dispatch(ctx context.Context, now time.Time) error
+}
+
+type summaryService struct {
+	users     repository.UserRepository
+	habits    repository.HabitRepository
+	records   repository.RecordRepository
+	calendars CalendarService
+	notifier  notify.Notifier
+}
+
+// NewSummaryService returns a service that sends weekly summaries by email
+// through notifier.
+func NewSummaryService(users repository.UserRepository, habits repository.HabitRepository, records repository.RecordRepository,
+	calendars CalendarService, notifier notify.Notifier) SummaryService {
+	return &summaryService{users: users, habits: habits, records: records, calendars: calendars, notifier: notifier}
+}
+
+func (s *summaryService) Dispatch(ctx context.Context, now time.Time) error {
+	users, err := s.users.ListSummaryRecipients()
+	if err != nil {
+		return err
+	}
+
+	for i := range users {
+		if err := s.dispatch(ctx, &users[i], now); err != nil {
+			logger.Error("Failed to send the weekly summary of user %d: %v", users[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// dispatch sends user's summary if this week's has not gone out yet. Like a
+// reminder's day, the week is claimed before sending and given back if the
+// summary cannot be queued.
+func (s *summaryService) dispatch(ctx context.Context, user *model.User, now time.Time) error {
+	cal, err := s.calendars.Calendar(user, "")
+	if err != nil {
+		return err
+	}
+	day := today(cal, now)
+	week := startOfWeek(day, cal.WeekStart)
+	if day != week || (user.SummarySentOn != nil && !user.SummarySentOn.Before(week)) {
+		return nil
+	}
+
+	n, err := s.summary(user, week.AddDays(-7), week.AddDays(-1))
+	if err != nil {
+		return err
+	}
+	claimed, err := s.users.SetSummarySent(user.ID, user.SummarySentOn, &week)
+	if err != nil || !claimed {
+		return err
+	}
+
+	err = s.notifier.Notify(ctx, n)
+	if err != nil && !errors.Is(err, notify.ErrNoAddress) {
+		if _, rerr := s.users.SetSummarySent(user.ID, &week, user.SummarySentOn); rerr != nil {
+			logger.Error("Failed to release the weekly summary of user %d: %v", user.ID, rerr)
+		}
+	}
+	return err
+}
+
+// summary sums up the records user made from from to to, per habit.
+func (s *summaryService) summary(user *model.User, from, to model.Date) (*model.Notification, error) {
+	habits, err := s.habits.GetAll(user.ID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var count, duration int
+	var lines []string
+	for _, habit := range habits {
+		totals, err := s.records.GetDailyTotals(user.ID, &model.RecordFilter{HabitID: habit.ID, From: from.String(), To: to.String()})
+		if err != nil {
+			return nil, err
+		}
+		var c, d int
+		for _, t := range totals {
+			c += t.Count
+			d += t.Duration
+		}
+		if c > 0 {
+			lines = append(lines, fmt.Sprintf("%s %s (%d minutes)", habit.Name, times(c), d))
+		}
+		count += c
+		duration += d
+	}
+
+	body := fmt.Sprintf("Nothing was recorded from %s to %s.", from, to)
+	if count > 0 {
+		body = fmt.Sprintf("From %s to %s you kept up your habits %s, %d minutes in all: %s.", from, to, times(count), duration, strings.Join(lines, ", "))
+	}
+	return &model.Notification{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Channel:  notify.Email,
+		Subject:  fmt.Sprintf("Your week from %s to %s", from, to),
+		Body:     body,
+	}, nil
+}
+
+func times(n int) string {
+	if n == 1 {
+		return "once"
+	}
+	return fmt.Sprintf("%d times", n)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+func TestSummaryService_Dispatch(t *testing.T) {
+	users := newMockUserRepository()
+	users.Create(&model.User{Username: "bob", Email: "bob@example.com", Timezone: "Asia/Shanghai", WeekStart: "monday", WeeklySummary: true})
+	users.Create(&model.User{Username: "carol", Email: "carol@example.com"})
+	habits := newMockHabitRepository()
+	gym := &model.Habit{UserID: testUserID, Name: "Gym"}
+	reading := &model.Habit{UserID: testUserID, Name: "Reading"}
+	habits.Create(gym)
+	habits.Create(reading)
+	records := newMockRepository()
+	for _, r := range []model.Record{
+		{HabitID: gym.ID, Date: mustDate("2024-03-03"), Duration: 60}, // the week before
+		{HabitID: gym.ID, Date: mustDate("2024-03-04"), Duration: 30},
+		{HabitID: gym.ID, Date: mustDate("2024-03-06"), Duration: 45},
+		{HabitID: reading.ID, Date: mustDate("2024-03-10"), Duration: 20},
+		{HabitID: gym.ID, Date: mustDate("2024-03-11"), Duration: 30}, // this week
+	} {
+		r.UserID = testUserID
+		records.Create(testActor, &r)
+	}
+	notifier := &recordingNotifier{}
+	svc := NewSummaryService(users, habits, records, NewCalendarService(users, &model.Calendar{Location: time.UTC}, true), notifier)
+
+	sunday := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC) // 23:00 in Shanghai
+	if err := svc.Dispatch(context.Background(), sunday); err != nil || len(notifier.sent) != 0 {
+		t.Fatalf("Dispatch() on the last day of the week sent %d summaries, %v, want none", len(notifier.sent), err)
+	}
+
+	notifier.err = errors.New("queue unavailable")
+	monday := sunday.Add(90 * time.Minute)
+	svc.Dispatch(context.Background(), monday)
+	notifier.err = nil
+	for i := 0; i < 2; i++ {
+		if err := svc.Dispatch(context.Background(), monday.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+	if len(notifier.sent) != 1 {
+		t.Fatalf("Dispatch() sent %d summaries, want 1 once the failed one was retried", len(notifier.sent))
+	}
+
+	n := notifier.sent[0]
+	if n.UserID != testUserID || n.Email != "bob@example.com" || n.Subject != "Your week from 2024-03-04 to 2024-03-10" {
+		t.Errorf("summary = %+v, want bob's summary of 2024-03-04 to 2024-03-10", n)
+	}
+	for _, want := range []string{"3 times, 95 minutes in all", "Gym 2 times (75 minutes)", "Reading once (20 minutes)"} {
+		if !strings.Contains(n.Body, want) {
+			t.Errorf("summary body = %q, want it to contain %q", n.Body, want)
+		}
+	}
+}
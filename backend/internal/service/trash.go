@@ -0,0 +1,52 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/pkg/logger"
+)
+
+// ListTrash returns the user's deleted records, most recently deleted first.
+func (s *recordService) ListTrash(userID int64) ([]model.Record, error) {
+	records, err := s.repo.ListTrash(userID)
+	if err != nil {
+		return nil, err
+	}
+	if records == nil {
+		return []model.Record{}, nil
+	}
+	return records, nil
+}
+
+// Restore takes a record back out of the trash. To webhooks, the record is
+// created again.
+func (s *recordService) Restore(actor *model.Actor, id int64) (*model.Record, error) {
+	if err := s.repo.Restore(actor, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	record, err := s.GetByID(actor.UserID, id)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(model.EventRecordCreated, record)
+	return record, nil
+}
+
+// PurgeTrash permanently removes records that have been in the trash for
+// longer than retention.
+func (s *recordService) PurgeTrash(retention time.Duration) error {
+	purged, err := s.repo.PurgeDeleted(s.now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Purged %d records from the trash", purged)
+	}
+	return nil
+}
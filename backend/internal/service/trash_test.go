@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+func TestRecordService_Trash(t *testing.T) {
+	repo := newMockRepository()
+	svc := &recordService{repo: repo, habits: newMockHabitRepository(), maxFutureDays: 1, now: time.Now}
+	record, err := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := svc.Delete(testActor, record.ID, 0); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := svc.GetByID(testUserID, record.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("GetByID() of a deleted record error = %v, want %v", err, ErrRecordNotFound)
+	}
+	if trash, err := svc.ListTrash(testUserID); err != nil || len(trash) != 1 || trash[0].DeletedAt == nil {
+		t.Fatalf("ListTrash() = %+v, %v, want the deleted record", trash, err)
+	}
+	if trash, _ := svc.ListTrash(testUserID + 1); len(trash) != 0 {
+		t.Errorf("ListTrash() of another user = %+v, want none", trash)
+	}
+
+	if _, err := svc.Restore(&model.Actor{UserID: testUserID + 1}, record.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Restore() by another user error = %v, want %v", err, ErrRecordNotFound)
+	}
+	restored, err := svc.Restore(testActor, record.ID)
+	if err != nil || restored.DeletedAt != nil || restored.Version != record.Version+2 {
+		t.Fatalf("Restore() = %+v, %v, want the record back at version %d", restored, err, record.Version+2)
+	}
+	if _, err := svc.Restore(testActor, record.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("Restore() of a record not in the trash error = %v, want %v", err, ErrRecordNotFound)
+	}
+}
+
+func TestRecordService_PurgeTrash(t *testing.T) {
+	repo := newMockRepository()
+	events := &recordingPublisher{}
+	svc := &recordService{repo: repo, habits: newMockHabitRepository(), events: events, maxFutureDays: 1, now: time.Now}
+	record, _ := svc.Create(testActor, testCalendar, &model.CreateRecordRequest{Date: "2024-01-15", Content: "Running", Duration: 30})
+	svc.Delete(testActor, record.ID, 0)
+	events.events = nil
+
+	if err := svc.PurgeTrash(time.Hour); err != nil || len(repo.trash) != 1 {
+		t.Fatalf("PurgeTrash() within retention error = %v, trash = %d records, want 1", err, len(repo.trash))
+	}
+	svc.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if err := svc.PurgeTrash(time.Hour); err != nil || len(repo.trash) != 0 {
+		t.Errorf("PurgeTrash() after retention error = %v, trash = %d records, want 0", err, len(repo.trash))
+	}
+	if len(events.events) != 0 {
+		t.Errorf("PurgeTrash() published %q, want nothing: the deletion was published when the record was trashed", events.events)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError is invalid input in one field of a request. Code is a stable,
+// machine-readable reason such as "required" or "too_long"; Message is for
+// people. It matches ErrInvalidInput, so callers that only care whether input
+// was invalid can keep using errors.Is.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+func (e *FieldError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+func fieldError(field, code, format string, args ...interface{}) *FieldError {
+	return &FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ValidationError collects every invalid field of a request, so a client can
+// fix them all in one round trip. It matches ErrInvalidInput.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// add records err, which is a FieldError or a ValidationError.
+func (e *ValidationError) add(err error) {
+	var all *ValidationError
+	var one *FieldError
+	switch {
+	case errors.As(err, &all):
+		e.Fields = append(e.Fields, all.Fields...)
+	case errors.As(err, &one):
+		e.Fields = append(e.Fields, one)
+	default:
+		e.Fields = append(e.Fields, &FieldError{Code: "invalid", Message: err.Error()})
+	}
+}
+
+func (e *ValidationError) has(field string) bool {
+	for _, f := range e.Fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// err returns e, or nil when no field failed.
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// validateStruct checks the validate tags of a request struct. The rules are
+// required, min=N and max=N, where N bounds the value of a number or the
+// length of a string in characters. Fields are named by their json names,
+// and only the first failing rule of each field is reported.
+func validateStruct(v interface{}) *ValidationError {
+	errs := &ValidationError{}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := strings.Split(rt.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = rt.Field(i).Name
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			if err := checkRule(name, rv.Field(i), rule); err != nil {
+				errs.Fields = append(errs.Fields, err)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func checkRule(field string, v reflect.Value, rule string) *FieldError {
+	if rule == "required" {
+		if v.IsZero() {
+			return fieldError(field, "required", "is required")
+		}
+		return nil
+	}
+
+	op, arg, _ := strings.Cut(rule, "=")
+	bound, err := strconv.Atoi(arg)
+	if err != nil || (op != "min" && op != "max") {
+		panic(fmt.Sprintf("service: bad validate rule %q on %s", rule, field))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		n := utf8.RuneCountInString(v.String())
+		if op == "min" && n < bound {
+			return fieldError(field, "too_short", "must be at least %d characters", bound)
+		}
+		if op == "max" && n > bound {
+			return fieldError(field, "too_long", "must be at most %d characters", bound)
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		if op == "min" && n < int64(bound) {
+			return fieldError(field, "too_small", "must be at least %d", bound)
+		}
+		if op == "max" && n > int64(bound) {
+			return fieldError(field, "too_large", "must be at most %d", bound)
+		}
+	}
+	return nil
+}
+
+// within qualifies an error about an element of a list, such as the third
+// record of a backup, with the element's path.
+func within(path string, err error) error {
+	var all *ValidationError
+	if errors.As(err, &all) {
+		qualified := &ValidationError{Fields: make([]*FieldError, len(all.Fields))}
+		for i, f := range all.Fields {
+			qualified.Fields[i] = &FieldError{Field: path + "." + f.Field, Code: f.Code, Message: f.Message}
+		}
+		return qualified
+	}
+	var one *FieldError
+	if errors.As(err, &one) {
+		return &FieldError{Field: path + "." + one.Field, Code: one.Code, Message: one.Message}
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
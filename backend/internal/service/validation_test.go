@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateStruct(t *testing.T) {
+	type request struct {
+		Name  string `json:"name" validate:"required,min=2,max=4"`
+		Count int    `json:"count,omitempty" validate:"min=1,max=10"`
+		Note  string
+	}
+
+	tests := []struct {
+		name string
+		req  request
+		want map[string]string
+	}{
+		{"valid", request{Name: "abc", Count: 5}, map[string]string{}},
+		{"first failing rule only", request{Count: 5}, map[string]string{"name": "required"}},
+		{"characters not bytes", request{Name: "日本語", Count: 1}, map[string]string{}},
+		{"bounds", request{Name: "a", Count: 11}, map[string]string{"name": "too_short", "count": "too_large"}},
+		{"long name", request{Name: "abcde", Count: 0}, map[string]string{"name": "too_long", "count": "too_small"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]string)
+			for _, f := range validateStruct(&tt.req).Fields {
+				got[f.Field] = f.Code
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("validateStruct() = %v, want %v", got, tt.want)
+			}
+			for field, code := range tt.want {
+				if got[field] != code {
+					t.Errorf("validateStruct() %s = %q, want %q", field, got[field], code)
+				}
+			}
+		})
+	}
+}
+
+func TestWithin(t *testing.T) {
+	errs := &ValidationError{}
+	errs.add(fieldError("date", "required", "is required"))
+	errs.add(fieldError("duration", "too_small", "must be at least 1"))
+
+	err := within("records[2]", errs.err())
+	var verr *ValidationError
+	if !errors.Is(err, ErrInvalidInput) || !errors.As(err, &verr) || len(verr.Fields) != 2 ||
+		verr.Fields[0].Field != "records[2].date" || verr.Fields[1].Field != "records[2].duration" {
+		t.Errorf("within() = %v, want both fields qualified", err)
+	}
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/internal/repository"
+	"habit-tracker/pkg/logger"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// webhookEvents are the events webhooks can subscribe to, in the order they
+// are listed.
+var webhookEvents = []string{
+	model.EventRecordCreated,
+	model.EventRecordUpdated,
+	model.EventRecordDeleted,
+	model.EventStreakBroken,
+}
+
+const (
+	minWebhookSecret    = 16
+	maxWebhookSecret    = 255
+	maxWebhookURL       = 2048
+	maxDeliveriesListed = 100
+)
+
+type WebhookService interface {
+	Create(userID int64, req *model.WebhookRequest) (*model.CreatedWebhook, error)
+	GetByID(userID, id int64) (*model.Webhook, error)
+	GetAll(userID int64) ([]model.Webhook, error)
+	Update(userID, id int64, req *model.WebhookRequest) (*model.Webhook, error)
+	Delete(userID, id int64) error
+	// Deliveries returns the latest deliveries to one of the user's
+	// webhooks, newest first.
+	Deliveries(userID, id int64) ([]model.WebhookDelivery, error)
+	// Publish queues event for every enabled webhook of the user that
+	// subscribes to it.
+	Publish(userID int64, event string, data interface{}) error
+	// CheckStreaks publishes streak.broken for the habits whose streak was
+	// not kept up yesterday, once per habit and day. It is meant to run
+	// every hour or so.
+	CheckStreaks(now time.Time) error
+	// Deliver posts the queued events that are due at now, retrying failed
+	// deliveries with exponential backoff. It is meant to run every few
+	// seconds.
+	Deliver(ctx context.Context, now time.Time) error
+	// PurgeDeliveries removes delivered and failed deliveries older than
+	// retention from the delivery log.
+	PurgeDeliveries(retention time.Duration) error
+}
+
+type webhookService struct {
+	webhooks  repository.WebhookRepository
+	records   repository.RecordRepository
+	habits    repository.HabitRepository
+	users     repository.UserRepository
+	calendars CalendarService
+	guard     *webhookGuard
+	client    *http.Client
+	// retryDelay is the wait before the first retry, doubled for each retry
+	// after it.
+	retryDelay time.Duration
+	now        func() time.Time
+}
+
+// NewWebhookService returns a service whose webhooks may only reach public
+// addresses, besides the hosts in allowedHosts.
+func NewWebhookService(webhooks repository.WebhookRepository, records repository.RecordRepository, habits repository.HabitRepository,
+	users repository.UserRepository, calendars CalendarService, allowedHosts []string) WebhookService {
+	guard := newWebhookGuard(allowedHosts)
+	return &webhookService{
+		webhooks:   webhooks,
+		records:    records,
+		habits:     habits,
+		users:      users,
+		calendars:  calendars,
+		guard:      guard,
+		client:     guard.client(webhookTimeout),
+		retryDelay: defaultRetryDelay,
+		now:        time.Now,
+	}
+}
+
+func (s *webhookService) Create(userID int64, req *model.WebhookRequest) (*model.CreatedWebhook, error) {
+	webhook := &model.Webhook{UserID: userID}
+	if err := s.apply(webhook, req); err != nil {
+		return nil, err
+	}
+	if webhook.Secret == "" {
+		secret, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		webhook.Secret = secret
+	}
+	if err := s.webhooks.Create(webhook); err != nil {
+		return nil, err
+	}
+	return &model.CreatedWebhook{Webhook: *webhook, Secret: webhook.Secret}, nil
+}
+
+func (s *webhookService) GetByID(userID, id int64) (*model.Webhook, error) {
+	webhook, err := s.webhooks.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (s *webhookService) GetAll(userID int64) ([]model.Webhook, error) {
+	webhooks, err := s.webhooks.GetAll(userID)
+	if err != nil {
+		return nil, err
+	}
+	if webhooks == nil {
+		return []model.Webhook{}, nil
+	}
+	return webhooks, nil
+}
+
+// Update keeps the secret when req has none. Enabling a webhook, including
+// one that was disabled after failing, starts its count of failures afresh.
+func (s *webhookService) Update(userID, id int64, req *model.WebhookRequest) (*model.Webhook, error) {
+	webhook, err := s.GetByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(webhook, req); err != nil {
+		return nil, err
+	}
+	if webhook.Enabled {
+		webhook.Failures = 0
+	}
+	if err := s.webhooks.Update(webhook); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *webhookService) Delete(userID, id int64) error {
+	if err := s.webhooks.Delete(userID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWebhookNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *webhookService) Deliveries(userID, id int64) ([]model.WebhookDelivery, error) {
+	if _, err := s.GetByID(userID, id); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.webhooks.ListDeliveries(id, maxDeliveriesListed)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		return []model.WebhookDelivery{}, nil
+	}
+	return deliveries, nil
+}
+
+// apply validates req, reporting every invalid field at once, and copies it
+// into webhook.
+func (s *webhookService) apply(webhook *model.Webhook, req *model.WebhookRequest) error {
+	errs := validateStruct(req)
+	rawURL := strings.TrimSpace(req.URL)
+	if rawURL != "" {
+		u, err := url.Parse(rawURL)
+		switch {
+		case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			errs.add(fieldError("url", "invalid_url", "must be an absolute http or https URL"))
+		case len(rawURL) > maxWebhookURL:
+			errs.add(fieldError("url", "too_long", "must be at most %d characters", maxWebhookURL))
+		case !s.guard.allows(u.Hostname()):
+			errs.add(fieldError("url", "forbidden_host", "must not point at a loopback, private or link-local address"))
+		}
+	}
+
+	subscribed := make(map[string]bool)
+	for i, event := range req.Events {
+		if !knownEvent(event) {
+			errs.add(fieldError(fmt.Sprintf("events[%d]", i), "invalid", "must be one of %s", strings.Join(webhookEvents, ", ")))
+			continue
+		}
+		subscribed[event] = true
+	}
+	if len(req.Events) == 0 && !errs.has("events") {
+		errs.add(fieldError("events", "required", "is required"))
+	}
+
+	if n := len(req.Secret); n > 0 && (n < minWebhookSecret || n > maxWebhookSecret) {
+		errs.add(fieldError("secret", "out_of_range", "must be between %d and %d characters", minWebhookSecret, maxWebhookSecret))
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	webhook.URL = rawURL
+	webhook.Events = nil
+	for _, event := range webhookEvents {
+		if subscribed[event] {
+			webhook.Events = append(webhook.Events, event)
+		}
+	}
+	if req.Secret != "" {
+		webhook.Secret = req.Secret
+	}
+	webhook.Enabled = req.Enabled == nil || *req.Enabled
+	return nil
+}
+
+func knownEvent(event string) bool {
+	for _, e := range webhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func subscribes(webhook *model.Webhook, event string) bool {
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *webhookService) Publish(userID int64, event string, data interface{}) error {
+	id, err := newEventID()
+	if err != nil {
+		return err
+	}
+	return s.publish(userID, id, event, data)
+}
+
+// publish queues the event id for the user's webhooks. A webhook that
+// already has the event queued is left alone, so an id made from what the
+// event is about publishes it at most once.
+func (s *webhookService) publish(userID int64, id, event string, data interface{}) error {
+	webhooks, err := s.webhooks.GetAll(userID)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	now := s.now()
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !subscribes(&webhook, event) {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(&model.Event{ID: id, Type: event, CreatedAt: now, Data: data})
+			if err != nil {
+				return err
+			}
+		}
+		_, err := s.webhooks.Enqueue(&model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       id,
+			Event:         event,
+			Payload:       payload,
+			Status:        model.DeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newEventID returns a random id for an event.
+func newEventID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *webhookService) CheckStreaks(now time.Time) error {
+	webhooks, err := s.webhooks.ListEnabled()
+	if err != nil {
+		return err
+	}
+
+	var userIDs []int64
+	seen := make(map[int64]bool)
+	for _, webhook := range webhooks {
+		if subscribes(&webhook, model.EventStreakBroken) && !seen[webhook.UserID] {
+			seen[webhook.UserID] = true
+			userIDs = append(userIDs, webhook.UserID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+
+	for _, userID := range userIDs {
+		if err := s.checkStreaks(userID, now); err != nil {
+			logger.Error("Failed to check streaks of user %d: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// checkStreaks compares each habit's streak as of yesterday with its streak
+// as of today in the user's calendar: a streak that was current yesterday
+// and no longer is today, or has since started over, was broken.
+func (s *webhookService) checkStreaks(userID int64, now time.Time) error {
+	user, err := s.users.GetByID(userID)
+	if err != nil || user == nil {
+		return err
+	}
+	cal, err := s.calendars.Calendar(user, "")
+	if err != nil {
+		return err
+	}
+
+	activity, err := s.records.GetActivityDates(userID)
+	if err != nil {
+		return err
+	}
+	habits, err := s.habits.GetAll(userID, false)
+	if err != nil {
+		return err
+	}
+	byHabit := make(map[int64][]model.Date)
+	for _, a := range activity {
+		byHabit[a.HabitID] = append(byHabit[a.HabitID], a.Date)
+	}
+
+	day := today(cal, now)
+	for i := range habits {
+		habit := &habits[i]
+		before := habitStreak(habit, byHabit[habit.ID], day.AddDays(-1), cal.WeekStart)
+		after := habitStreak(habit, byHabit[habit.ID], day, cal.WeekStart)
+		if before.Current == 0 || (after.Current > 0 && after.CurrentStart == before.CurrentStart) {
+			continue
+		}
+
+		id := fmt.Sprintf("%s-%d-%s", model.EventStreakBroken, habit.ID, day)
+		err := s.publish(userID, id, model.EventStreakBroken, &model.StreakBrokenEvent{
+			HabitID: habit.ID,
+			Name:    habit.Name,
+			Length:  before.Current,
+			Start:   before.CurrentStart,
+			End:     before.CurrentEnd,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
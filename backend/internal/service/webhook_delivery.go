@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"habit-tracker/internal/model"
+	"habit-tracker/pkg/logger"
+)
+
+const (
+	webhookTimeout    = 10 * time.Second
+	defaultRetryDelay = 30 * time.Second
+	// maxDeliveryAttempts gives up on a delivery after about an hour of
+	// retries with the default delay.
+	maxDeliveryAttempts = 8
+	// webhookFailureLimit is how many attempts in a row may fail before a
+	// webhook is disabled.
+	webhookFailureLimit = 20
+	deliveryBatchSize   = 50
+	maxDeliveryError    = 500
+)
+
+// Headers of webhook requests.
+const (
+	HeaderWebhookID        = "X-Webhook-Id"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+// SignWebhook returns the signature of a webhook request: the HMAC-SHA256,
+// keyed with the webhook's secret, of the timestamp header, a dot and the
+// body, in hex after "sha256=".
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *webhookService) Deliver(ctx context.Context, now time.Time) error {
+	due, err := s.webhooks.ListDue(now, deliveryBatchSize)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+	enabled, err := s.webhooks.ListEnabled()
+	if err != nil {
+		return err
+	}
+	webhooks := make(map[int64]*model.Webhook, len(enabled))
+	for i := range enabled {
+		webhooks[enabled[i].ID] = &enabled[i]
+	}
+
+	for i := range due {
+		webhook := webhooks[due[i].WebhookID]
+		if webhook == nil || !webhook.Enabled {
+			continue
+		}
+		if err := s.deliver(ctx, webhook, &due[i], now); err != nil {
+			logger.Error("Failed to deliver event %s to webhook %d: %v", due[i].EventID, webhook.ID, err)
+		}
+	}
+	return nil
+}
+
+// deliver makes one attempt at delivery. The attempt is claimed first, so
+// that however many runs, or servers, see the delivery due, one of them
+// posts it; a claim that is never finished lapses after a while and the
+// delivery is retried.
+func (s *webhookService) deliver(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery, now time.Time) error {
+	claimed, err := s.webhooks.Claim(delivery.ID, delivery.Attempts, now.Add(2*webhookTimeout))
+	if err != nil || !claimed {
+		return err
+	}
+	delivery.Attempts++
+
+	status, sendErr := s.send(ctx, webhook, delivery, now)
+	delivery.ResponseStatus = status
+	if sendErr == nil {
+		delivery.Status = model.DeliveryDelivered
+		delivery.NextAttemptAt = nil
+		delivery.Error = ""
+		delivery.DeliveredAt = &now
+		if err := s.webhooks.Finish(delivery); err != nil {
+			return err
+		}
+		return s.webhooks.ResetFailures(webhook.ID)
+	}
+
+	delivery.Error = sendErr.Error()
+	if len(delivery.Error) > maxDeliveryError {
+		delivery.Error = delivery.Error[:maxDeliveryError]
+	}
+	if delivery.Attempts >= maxDeliveryAttempts {
+		delivery.Status = model.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	} else {
+		next := now.Add(s.retryDelay << (delivery.Attempts - 1))
+		delivery.NextAttemptAt = &next
+	}
+	if err := s.webhooks.Finish(delivery); err != nil {
+		return err
+	}
+
+	disabled, err := s.webhooks.AddFailure(webhook.ID, webhookFailureLimit)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		webhook.Enabled = false
+		logger.Info("Disabled webhook %d of user %d after %d failed deliveries in a row", webhook.ID, webhook.UserID, webhookFailureLimit)
+	}
+	return nil
+}
+
+// send posts delivery to webhook and returns the status it responded with,
+// failing unless it is 2xx.
+func (s *webhookService) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "habit-tracker-webhooks")
+	req.Header.Set(HeaderWebhookID, delivery.EventID)
+	req.Header.Set(HeaderWebhookEvent, delivery.Event)
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, SignWebhook(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *webhookService) PurgeDeliveries(retention time.Duration) error {
+	purged, err := s.webhooks.PurgeDeliveries(s.now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		logger.Info("Purged %d webhook deliveries", purged)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// webhookLookupTimeout bounds the name lookup done when a webhook is saved.
+const webhookLookupTimeout = 3 * time.Second
+
+// webhookGuard keeps webhooks from reaching into the server's own network:
+// loopback, private and link-local addresses (cloud metadata endpoints among
+// them), as well as unspecified and multicast ones, are refused unless their
+// host is allowed.
+type webhookGuard struct {
+	// allowed holds the host names and IP addresses, in lower case, that
+	// webhooks may reach whatever they resolve to.
+	allowed map[string]bool
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func newWebhookGuard(allowedHosts []string) *webhookGuard {
+	g := &webhookGuard{allowed: make(map[string]bool), lookup: net.DefaultResolver.LookupIPAddr}
+	for _, host := range allowedHosts {
+		if host = strings.ToLower(strings.Trim(strings.TrimSpace(host), "[]")); host != "" {
+			g.allowed[host] = true
+		}
+	}
+	return g
+}
+
+// allows reports whether webhooks may reach host, a URL's host name or IP
+// address. A name that cannot be resolved is allowed, since it may well be
+// by the time events are delivered, when the dialer checks it again.
+func (g *webhookGuard) allows(host string) bool {
+	host = strings.ToLower(host)
+	if g.allowed[host] {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return publicIP(ip)
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookLookupTimeout)
+	defer cancel()
+	addrs, err := g.lookup(ctx, host)
+	if err != nil {
+		return true
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return false
+		}
+	}
+	return true
+}
+
+// client returns an HTTP client whose connections are checked once the
+// address they go to is known, so that a host cannot pass allows and then
+// resolve to a local address at delivery. Proxies are not used, as they would
+// make the connections on the client's behalf.
+func (g *webhookGuard) client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	guarded := &net.Dialer{Timeout: timeout, Control: func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if !publicIP(net.ParseIP(host)) {
+			return fmt.Errorf("%s is not a public address", host)
+		}
+		return nil
+	}}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if g.allowed[strings.ToLower(host)] {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return guarded.DialContext(ctx, network, addr)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// publicIP reports whether ip is a public unicast address.
+func publicIP(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
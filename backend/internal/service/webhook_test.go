@@ -0,0 +1,501 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"habit-tracker/internal/model"
+)
+
+type mockWebhookRepository struct {
+	webhooks   []model.Webhook
+	deliveries []model.WebhookDelivery
+	nextID     int64
+}
+
+func newMockWebhookRepository() *mockWebhookRepository {
+	return &mockWebhookRepository{nextID: 1}
+}
+
+func (m *mockWebhookRepository) Create(webhook *model.Webhook) error {
+	webhook.ID = m.nextID
+	m.nextID++
+	m.webhooks = append(m.webhooks, *webhook)
+	return nil
+}
+
+func (m *mockWebhookRepository) GetByID(userID, id int64) (*model.Webhook, error) {
+	for _, w := range m.webhooks {
+		if w.ID == id && w.UserID == userID {
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockWebhookRepository) GetAll(userID int64) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	for _, w := range m.webhooks {
+		if w.UserID == userID {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockWebhookRepository) ListEnabled() ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	for _, w := range m.webhooks {
+		if w.Enabled {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockWebhookRepository) Update(webhook *model.Webhook) error {
+	for i, w := range m.webhooks {
+		if w.ID == webhook.ID && w.UserID == webhook.UserID {
+			m.webhooks[i] = *webhook
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockWebhookRepository) Delete(userID, id int64) error {
+	for i, w := range m.webhooks {
+		if w.ID == id && w.UserID == userID {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *mockWebhookRepository) AddFailure(id int64, limit int) (bool, error) {
+	for i := range m.webhooks {
+		w := &m.webhooks[i]
+		if w.ID == id {
+			w.Failures++
+			if w.Enabled && w.Failures >= limit {
+				w.Enabled = false
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (m *mockWebhookRepository) ResetFailures(id int64) error {
+	for i := range m.webhooks {
+		if m.webhooks[i].ID == id {
+			m.webhooks[i].Failures = 0
+		}
+	}
+	return nil
+}
+
+func (m *mockWebhookRepository) Enqueue(delivery *model.WebhookDelivery) (bool, error) {
+	for _, d := range m.deliveries {
+		if d.WebhookID == delivery.WebhookID && d.EventID == delivery.EventID {
+			return false, nil
+		}
+	}
+	delivery.ID = int64(len(m.deliveries) + 1)
+	m.deliveries = append(m.deliveries, *delivery)
+	return true, nil
+}
+
+func (m *mockWebhookRepository) ListDue(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	enabled := make(map[int64]bool)
+	for _, w := range m.webhooks {
+		enabled[w.ID] = w.Enabled
+	}
+	var due []model.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == model.DeliveryPending && !d.NextAttemptAt.After(now) && enabled[d.WebhookID] && len(due) < limit {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (m *mockWebhookRepository) Claim(id int64, attempts int, until time.Time) (bool, error) {
+	for i := range m.deliveries {
+		d := &m.deliveries[i]
+		if d.ID == id && d.Status == model.DeliveryPending && d.Attempts == attempts {
+			d.Attempts++
+			d.NextAttemptAt = &until
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockWebhookRepository) Finish(delivery *model.WebhookDelivery) error {
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == delivery.ID {
+			m.deliveries[i] = *delivery
+		}
+	}
+	return nil
+}
+
+func (m *mockWebhookRepository) ListDeliveries(webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if m.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockWebhookRepository) PurgeDeliveries(before time.Time) (int64, error) {
+	var kept []model.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == model.DeliveryPending || !d.CreatedAt.Before(before) {
+			kept = append(kept, d)
+		}
+	}
+	purged := int64(len(m.deliveries) - len(kept))
+	m.deliveries = kept
+	return purged, nil
+}
+
+// receiver is a webhook endpoint that answers with the statuses in replies,
+// then 200, and keeps the requests it was sent.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	replies  []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, replies ...int) *receiver {
+	r := &receiver{replies: replies}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		status := http.StatusOK
+		if len(r.replies) > 0 {
+			status, r.replies = r.replies[0], r.replies[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+type webhookFixture struct {
+	svc      *webhookService
+	webhooks *mockWebhookRepository
+	records  *mockRepository
+	habits   *mockHabitRepository
+	now      time.Time
+}
+
+func newWebhookFixture() *webhookFixture {
+	f := &webhookFixture{
+		webhooks: newMockWebhookRepository(),
+		records:  newMockRepository(),
+		habits:   newMockHabitRepository(),
+		now:      time.Date(2024, 3, 12, 9, 0, 0, 0, time.UTC),
+	}
+	users := newMockUserRepository()
+	users.Create(&model.User{Username: "bob"})
+	// Receivers listen on 127.0.0.1, and names other than hooks.internal
+	// resolve to a public address.
+	f.svc = NewWebhookService(f.webhooks, f.records, f.habits, users, NewCalendarService(users, testCalendar, false), []string{"127.0.0.1"}).(*webhookService)
+	f.svc.guard.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host == "hooks.internal" {
+			return []net.IPAddr{{IP: net.ParseIP("10.0.0.7")}}, nil
+		}
+		return []net.IPAddr{{IP: net.ParseIP("93.184.216.34")}}, nil
+	}
+	f.svc.now = func() time.Time { return f.now }
+	return f
+}
+
+func (f *webhookFixture) subscribe(t *testing.T, url string, events ...string) *model.CreatedWebhook {
+	t.Helper()
+	webhook, err := f.svc.Create(testUserID, &model.WebhookRequest{URL: url, Secret: "0123456789abcdef", Events: events})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return webhook
+}
+
+func (f *webhookFixture) deliver(t *testing.T, after time.Duration) {
+	t.Helper()
+	if err := f.svc.Deliver(context.Background(), f.now.Add(after)); err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+}
+
+func TestWebhookService_Validates(t *testing.T) {
+	f := newWebhookFixture()
+
+	_, err := f.svc.Create(testUserID, &model.WebhookRequest{URL: "ftp://example.com", Secret: "short", Events: []string{"record.created", "record.renamed"}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Create() error = %v, want a ValidationError", err)
+	}
+	got := make(map[string]string)
+	for _, f := range verr.Fields {
+		got[f.Field] = f.Code
+	}
+	want := map[string]string{"url": "invalid_url", "events[1]": "invalid", "secret": "out_of_range"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Create() field errors = %v, want %v", got, want)
+	}
+	if _, err := f.svc.Create(testUserID, &model.WebhookRequest{URL: "https://example.com/hook", Events: []string{}}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Create() without events error = %v, want %v", err, ErrInvalidInput)
+	}
+
+	created, err := f.svc.Create(testUserID, &model.WebhookRequest{URL: "https://example.com/hook", Events: []string{"streak.broken", "record.created", "streak.broken"}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if len(created.Secret) < minWebhookSecret || !created.Enabled || !reflect.DeepEqual(created.Events, []string{"record.created", "streak.broken"}) {
+		t.Errorf("Create() = %+v, want a generated secret and events in order", created)
+	}
+
+	f.webhooks.webhooks[0].Enabled, f.webhooks.webhooks[0].Failures = false, webhookFailureLimit
+	updated, err := f.svc.Update(testUserID, created.ID, &model.WebhookRequest{URL: "https://example.com/other", Events: []string{"record.deleted"}})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated.Secret != created.Secret || !updated.Enabled || updated.Failures != 0 {
+		t.Errorf("Update() = %+v, want the secret kept and the webhook enabled afresh", updated)
+	}
+	if _, err := f.svc.GetByID(testUserID+1, created.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("GetByID() by another user error = %v, want %v", err, ErrWebhookNotFound)
+	}
+}
+
+func TestWebhookService_RefusesLocalAddresses(t *testing.T) {
+	f := newWebhookFixture()
+
+	for _, url := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://localhost:8080/hook",
+		"http://127.0.0.2/hook",
+		"http://[::1]/hook",
+		"https://192.168.1.20/hook",
+		"https://hooks.internal/hook",
+	} {
+		_, err := f.svc.Create(testUserID, &model.WebhookRequest{URL: url, Events: []string{model.EventRecordCreated}})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Code != "forbidden_host" {
+			t.Errorf("Create(%s) error = %v, want forbidden_host", url, err)
+		}
+	}
+
+	// A host that passed when saved is checked again when delivering, by the
+	// address connected to.
+	rcv := newReceiver(t)
+	f.subscribe(t, rcv.URL, model.EventRecordCreated)
+	guard := newWebhookGuard(nil)
+	f.svc.guard, f.svc.client = guard, guard.client(webhookTimeout)
+	f.svc.Publish(testUserID, model.EventRecordCreated, &model.RecordEvent{Record: &model.Record{ID: 1}})
+	f.deliver(t, 0)
+	if d := f.webhooks.deliveries[0]; rcv.received() != 0 || d.Status != model.DeliveryPending || !strings.Contains(d.Error, "not a public address") {
+		t.Errorf("delivery = %+v with %d requests, want it refused before connecting", d, rcv.received())
+	}
+}
+
+func TestWebhookService_DeliversSignedEvents(t *testing.T) {
+	f := newWebhookFixture()
+	rcv := newReceiver(t)
+	webhook := f.subscribe(t, rcv.URL, model.EventRecordCreated)
+	f.subscribe(t, rcv.URL, model.EventRecordDeleted)
+
+	record := &model.Record{ID: 7, UserID: testUserID, HabitID: 1, Date: mustDate("2024-03-12"), Duration: 30}
+	if err := f.svc.Publish(testUserID, model.EventRecordCreated, &model.RecordEvent{Record: record}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := f.svc.Publish(testUserID+1, model.EventRecordCreated, &model.RecordEvent{Record: record}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	f.deliver(t, 0)
+
+	if rcv.received() != 1 {
+		t.Fatalf("receiver got %d requests, want 1", rcv.received())
+	}
+	req, body := rcv.requests[0], rcv.bodies[0]
+	if got, want := req.Header.Get(HeaderWebhookSignature), SignWebhook(webhook.Secret, req.Header.Get(HeaderWebhookTimestamp), body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := req.Header.Get(HeaderWebhookTimestamp); got != "1710234000" {
+		t.Errorf("timestamp = %q, want the time of delivery", got)
+	}
+	var event struct {
+		ID   string            `json:"id"`
+		Type string            `json:"type"`
+		Data model.RecordEvent `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("body %s: %v", body, err)
+	}
+	if event.Type != model.EventRecordCreated || event.ID != req.Header.Get(HeaderWebhookID) || event.Data.Record.ID != 7 {
+		t.Errorf("body = %s, want record 7 created", body)
+	}
+
+	deliveries, err := f.svc.Deliveries(testUserID, webhook.ID)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Deliveries() = %+v, %v, want 1", deliveries, err)
+	}
+	if d := deliveries[0]; d.Status != model.DeliveryDelivered || d.Attempts != 1 || d.ResponseStatus != 200 || d.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want delivered on the first attempt", d)
+	}
+	f.deliver(t, time.Minute)
+	if rcv.received() != 1 {
+		t.Errorf("receiver got %d requests, want the event delivered once", rcv.received())
+	}
+}
+
+func TestWebhookService_RetriesWithBackoff(t *testing.T) {
+	f := newWebhookFixture()
+	rcv := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	f.subscribe(t, rcv.URL, model.EventRecordUpdated)
+	f.svc.Publish(testUserID, model.EventRecordUpdated, &model.RecordEvent{Record: &model.Record{ID: 1}})
+
+	for _, tt := range []struct {
+		after    time.Duration
+		received int
+		status   string
+	}{
+		{0, 1, model.DeliveryPending},
+		{29 * time.Second, 1, model.DeliveryPending},
+		{30 * time.Second, 2, model.DeliveryPending},
+		{89 * time.Second, 2, model.DeliveryPending},
+		{90 * time.Second, 3, model.DeliveryDelivered},
+	} {
+		f.deliver(t, tt.after)
+		d := f.webhooks.deliveries[0]
+		if rcv.received() != tt.received || d.Status != tt.status {
+			t.Errorf("after %v: %d requests, delivery %s, want %d, %s", tt.after, rcv.received(), d.Status, tt.received, tt.status)
+		}
+	}
+	if d := f.webhooks.deliveries[0]; d.Attempts != 3 || d.Error != "" {
+		t.Errorf("delivery = %+v, want delivered on the third attempt", d)
+	}
+	if w := f.webhooks.webhooks[0]; w.Failures != 0 {
+		t.Errorf("failures = %d after a delivery, want 0", w.Failures)
+	}
+}
+
+func TestWebhookService_GivesUpAndDisables(t *testing.T) {
+	f := newWebhookFixture()
+	rcv := newReceiver(t, make([]int, 100)...)
+	for i := range rcv.replies {
+		rcv.replies[i] = http.StatusGone
+	}
+	webhook := f.subscribe(t, rcv.URL, model.EventRecordCreated)
+	publish := func(id int64) {
+		f.svc.Publish(testUserID, model.EventRecordCreated, &model.RecordEvent{Record: &model.Record{ID: id}})
+	}
+	// Runs well past every retry.
+	deliverAll := func() {
+		for i := 0; i < 2*maxDeliveryAttempts; i++ {
+			f.deliver(t, time.Duration(i)*time.Hour)
+		}
+	}
+
+	publish(1)
+	deliverAll()
+	d := f.webhooks.deliveries[0]
+	if d.Status != model.DeliveryFailed || d.Attempts != maxDeliveryAttempts || d.ResponseStatus != http.StatusGone || d.Error == "" {
+		t.Errorf("delivery = %+v, want failed after %d attempts", d, maxDeliveryAttempts)
+	}
+	if found, _ := f.svc.GetByID(testUserID, webhook.ID); !found.Enabled || found.Failures != maxDeliveryAttempts {
+		t.Errorf("webhook = %+v, want still enabled with %d failures", found, maxDeliveryAttempts)
+	}
+
+	publish(2)
+	publish(3)
+	deliverAll()
+	found, _ := f.svc.GetByID(testUserID, webhook.ID)
+	if found.Enabled || found.Failures != webhookFailureLimit {
+		t.Errorf("webhook = %+v, want disabled after %d failures", found, webhookFailureLimit)
+	}
+	if rcv.received() != webhookFailureLimit {
+		t.Errorf("receiver got %d requests, want none after the webhook was disabled", rcv.received())
+	}
+	if d := f.webhooks.deliveries[2]; d.Status != model.DeliveryPending {
+		t.Errorf("delivery = %+v, want kept pending for when the webhook is enabled again", d)
+	}
+}
+
+func TestWebhookService_CheckStreaks(t *testing.T) {
+	f := newWebhookFixture()
+	rcv := newReceiver(t)
+	f.subscribe(t, rcv.URL, model.EventStreakBroken)
+	f.habits.Create(&model.Habit{UserID: testUserID, Name: "Running"})
+	f.habits.Create(&model.Habit{UserID: testUserID, Name: "Reading"})
+	for _, r := range []struct {
+		habit int64
+		date  string
+	}{
+		{1, "2024-03-08"}, {1, "2024-03-09"}, {1, "2024-03-10"},
+		{2, "2024-03-09"}, {2, "2024-03-10"}, {2, "2024-03-11"},
+	} {
+		f.records.Create(testActor, &model.Record{UserID: testUserID, HabitID: r.habit, Date: mustDate(r.date), Duration: 10})
+	}
+
+	check := func(now time.Time) {
+		t.Helper()
+		if err := f.svc.CheckStreaks(now); err != nil {
+			t.Fatalf("CheckStreaks() error = %v", err)
+		}
+	}
+	check(time.Date(2024, 3, 11, 20, 0, 0, 0, time.UTC))
+	if len(f.webhooks.deliveries) != 0 {
+		t.Fatalf("CheckStreaks() on 2024-03-11 queued %+v, want nothing while yesterday counts", f.webhooks.deliveries)
+	}
+
+	check(time.Date(2024, 3, 12, 1, 0, 0, 0, time.UTC))
+	check(time.Date(2024, 3, 12, 2, 0, 0, 0, time.UTC))
+	if len(f.webhooks.deliveries) != 1 {
+		t.Fatalf("CheckStreaks() on 2024-03-12 queued %d events, want 1", len(f.webhooks.deliveries))
+	}
+	var event struct {
+		ID   string                  `json:"id"`
+		Data model.StreakBrokenEvent `json:"data"`
+	}
+	json.Unmarshal(f.webhooks.deliveries[0].Payload, &event)
+	want := model.StreakBrokenEvent{HabitID: 1, Name: "Running", Length: 3, Start: "2024-03-08", End: "2024-03-10"}
+	if event.Data != want || event.ID != "streak.broken-1-2024-03-12" {
+		t.Errorf("event = %+v, want %+v", event, want)
+	}
+
+	// Starting over the same day still counts as breaking the streak.
+	f.records.Create(testActor, &model.Record{UserID: testUserID, HabitID: 2, Date: mustDate("2024-03-13"), Duration: 10})
+	check(time.Date(2024, 3, 13, 22, 0, 0, 0, time.UTC))
+	if len(f.webhooks.deliveries) != 2 {
+		t.Errorf("CheckStreaks() on 2024-03-13 queued %d events in all, want 2", len(f.webhooks.deliveries))
+	}
+}
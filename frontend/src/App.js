@@ -1,6 +1,86 @@
 import React, { useState, useEffect, useMemo } from 'react';
 
 const API_URL = 'http://localhost:8080/api';
+const TOKEN_KEY = 'habit-tracker-token';
+
+// 浏览器所在时区，服务端据此计算“今天”和本周/本月
+const TIMEZONE = Intl.DateTimeFormat().resolvedOptions().timeZone;
+
+// 本地日期，格式为 YYYY-MM-DD
+function formatDate(date) {
+  const pad = (n) => String(n).padStart(2, '0');
+  return `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())}`;
+}
+
+// 带登录令牌的请求，令牌失效时通知调用方重新登录
+async function apiFetch(path, token, onUnauthorized, options = {}) {
+  const headers = { ...(options.headers || {}), Authorization: `Bearer ${token}` };
+  if (TIMEZONE) headers['X-Timezone'] = TIMEZONE;
+  const res = await fetch(`${API_URL}${path}`, { ...options, headers });
+  if (res.status === 401) {
+    onUnauthorized();
+    throw new Error('unauthorized');
+  }
+  return res;
+}
+
+// 登录 / 注册组件
+function LoginForm({ onLogin }) {
+  const [mode, setMode] = useState('login');
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [error, setError] = useState('');
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setError('');
+    try {
+      const res = await fetch(`${API_URL}/auth/${mode}`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ username, password })
+      });
+      const data = await res.json();
+      if (!res.ok) {
+        setError(data.error || '请求失败');
+        return;
+      }
+      onLogin(data.token);
+    } catch (err) {
+      setError('无法连接服务器');
+    }
+  };
+
+  return (
+    <div className="container">
+      <h1>个人习惯追踪</h1>
+      <div className="form-section auth-form">
+        <h2>{mode === 'login' ? '登录' : '注册'}</h2>
+        <form onSubmit={handleSubmit}>
+          <div className="form-group">
+            <label>用户名</label>
+            <input value={username} onChange={(e) => setUsername(e.target.value)} required />
+          </div>
+          <div className="form-group">
+            <label>密码</label>
+            <input type="password" value={password} onChange={(e) => setPassword(e.target.value)} minLength={8} required />
+          </div>
+          {error && <p className="auth-error">{error}</p>}
+          <button type="submit" className="btn btn-primary">
+            {mode === 'login' ? '登录' : '注册'}
+          </button>
+          <button
+            type="button"
+            className="btn btn-cancel"
+            onClick={() => setMode(mode === 'login' ? 'register' : 'login')}
+          >
+            {mode === 'login' ? '没有账号？注册' : '已有账号？登录'}
+          </button>
+        </form>
+      </div>
+    </div>
+  );
+}
 
 // 日历组件
 function Calendar({ records, onDateClick, selectedDate }) {
@@ -30,7 +110,7 @@ function Calendar({ records, onDateClick, selectedDate }) {
     const dateStr = `${year}-${String(month + 1).padStart(2, '0')}-${String(day).padStart(2, '0')}`;
     const hasRecords = recordsByDate[dateStr];
     const isSelected = selectedDate === dateStr;
-    const isToday = dateStr === new Date().toISOString().split('T')[0];
+    const isToday = dateStr === formatDate(new Date());
 
     days.push(
       <div
@@ -62,48 +142,53 @@ function Calendar({ records, onDateClick, selectedDate }) {
   );
 }
 
-// 频率热力图组件（类似GitHub贡献图）
-function FrequencyChart({ records }) {
+// 频率热力图组件（类似GitHub贡献图），强度等级由服务端统一计算
+function FrequencyChart({ api, records }) {
   const weeks = 52;
   const today = new Date();
 
-  const recordsByDate = useMemo(() => {
-    const map = {};
-    records.forEach(r => {
-      map[r.date] = (map[r.date] || 0) + 1;
-    });
-    return map;
-  }, [records]);
-
-  const maxCount = Math.max(1, ...Object.values(recordsByDate));
-
-  const getIntensity = (count) => {
-    if (count === 0) return 0;
-    if (count <= maxCount * 0.25) return 1;
-    if (count <= maxCount * 0.5) return 2;
-    if (count <= maxCount * 0.75) return 3;
-    return 4;
-  };
-
-  const cells = [];
   const startDate = new Date(today);
   startDate.setDate(startDate.getDate() - (weeks * 7) + 1);
   startDate.setDate(startDate.getDate() - startDate.getDay());
 
+  const from = formatDate(startDate);
+  const to = formatDate(today);
+
+  const [days, setDays] = useState({});
+
+  // 记录变化后重新获取
+  useEffect(() => {
+    const fetchHeatmap = async () => {
+      try {
+        const res = await api(`/stats/heatmap?${new URLSearchParams({ from, to })}`);
+        const data = await res.json();
+        const map = {};
+        (data.days || []).forEach(d => {
+          map[d.date] = d;
+        });
+        setDays(map);
+      } catch (err) {
+        console.error('Failed to fetch heatmap:', err);
+      }
+    };
+    fetchHeatmap();
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [records, from, to]);
+
+  const cells = [];
   for (let week = 0; week < weeks; week++) {
     const weekCells = [];
     for (let day = 0; day < 7; day++) {
       const cellDate = new Date(startDate);
       cellDate.setDate(cellDate.getDate() + week * 7 + day);
-      const dateStr = cellDate.toISOString().split('T')[0];
-      const count = recordsByDate[dateStr] || 0;
-      const intensity = getIntensity(count);
+      const dateStr = formatDate(cellDate);
+      const entry = days[dateStr];
 
       weekCells.push(
         <div
           key={`${week}-${day}`}
-          className={`freq-cell intensity-${intensity}`}
-          title={`${dateStr}: ${count}次`}
+          className={`freq-cell intensity-${entry ? entry.level : 0}`}
+          title={`${dateStr}: ${entry ? entry.value : 0}次`}
         />
       );
     }
@@ -148,22 +233,54 @@ function FrequencyChart({ records }) {
 }
 
 function App() {
+  const [token, setToken] = useState(() => localStorage.getItem(TOKEN_KEY));
+
+  const handleLogin = (newToken) => {
+    localStorage.setItem(TOKEN_KEY, newToken);
+    setToken(newToken);
+  };
+
+  const handleLogout = () => {
+    localStorage.removeItem(TOKEN_KEY);
+    setToken(null);
+  };
+
+  if (!token) {
+    return <LoginForm onLogin={handleLogin} />;
+  }
+  return <Tracker token={token} onLogout={handleLogout} />;
+}
+
+function Tracker({ token, onLogout }) {
+  const api = (path, options) => apiFetch(path, token, onLogout, options);
+
   const [records, setRecords] = useState([]);
   const [stats, setStats] = useState({ totalRecords: 0, totalDuration: 0 });
   const [form, setForm] = useState({
-    date: new Date().toISOString().split('T')[0],
+    date: formatDate(new Date()),
     content: '',
     duration: '',
     notes: ''
   });
   const [editingId, setEditingId] = useState(null);
+  const [editingVersion, setEditingVersion] = useState(null);
+  const [fieldErrors, setFieldErrors] = useState({});
+  const [lastDeleted, setLastDeleted] = useState(null);
   const [selectedDate, setSelectedDate] = useState(null);
 
   const fetchRecords = async () => {
     try {
-      const res = await fetch(`${API_URL}/records`);
-      const data = await res.json();
-      setRecords(data || []);
+      let all = [];
+      let cursor = '';
+      do {
+        const params = new URLSearchParams({ limit: '500' });
+        if (cursor) params.set('after', cursor);
+        const res = await api(`/records?${params}`);
+        const data = await res.json();
+        all = all.concat(data.items || []);
+        cursor = data.nextCursor || '';
+      } while (cursor);
+      setRecords(all);
     } catch (err) {
       console.error('Failed to fetch records:', err);
     }
@@ -171,7 +288,7 @@ function App() {
 
   const fetchStats = async () => {
     try {
-      const res = await fetch(`${API_URL}/stats`);
+      const res = await api('/stats');
       const data = await res.json();
       setStats(data);
     } catch (err) {
@@ -182,7 +299,17 @@ function App() {
   useEffect(() => {
     fetchRecords();
     fetchStats();
-  }, []);
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [token]);
+
+  const handleLogoutClick = async () => {
+    try {
+      await api('/auth/logout', { method: 'POST' });
+    } catch (err) {
+      console.error('Failed to log out:', err);
+    }
+    onLogout();
+  };
 
   const handleSubmit = async (e) => {
     e.preventDefault();
@@ -192,22 +319,30 @@ function App() {
     };
 
     try {
-      if (editingId) {
-        await fetch(`${API_URL}/records/${editingId}`, {
-          method: 'PUT',
-          headers: { 'Content-Type': 'application/json' },
-          body: JSON.stringify(payload)
-        });
-        setEditingId(null);
-      } else {
-        await fetch(`${API_URL}/records`, {
-          method: 'POST',
-          headers: { 'Content-Type': 'application/json' },
-          body: JSON.stringify(payload)
-        });
+      const headers = { 'Content-Type': 'application/json' };
+      if (editingId) headers['If-Match'] = `"${editingVersion}"`;
+      const res = await api(editingId ? `/records/${editingId}` : '/records', {
+        method: editingId ? 'PUT' : 'POST',
+        headers,
+        body: JSON.stringify(payload)
+      });
+      if (res.status === 412) {
+        setFieldErrors({ form: '这条记录已在其他地方被修改，请重新编辑' });
+        fetchRecords();
+        return;
+      }
+      if (!res.ok) {
+        const data = await res.json();
+        const errors = {};
+        (data.fields || []).forEach((f) => { errors[f.field] = f.message; });
+        if (!data.fields) errors.form = data.error || '保存失败';
+        setFieldErrors(errors);
+        return;
       }
+      setFieldErrors({});
+      setEditingId(null);
       setForm({
-        date: new Date().toISOString().split('T')[0],
+        date: formatDate(new Date()),
         content: '',
         duration: '',
         notes: ''
@@ -219,10 +354,18 @@ function App() {
     }
   };
 
-  const handleDelete = async (id) => {
+  const handleDelete = async (record) => {
     if (!window.confirm('确定要删除这条记录吗？')) return;
     try {
-      await fetch(`${API_URL}/records/${id}`, { method: 'DELETE' });
+      const res = await api(`/records/${record.id}`, {
+        method: 'DELETE',
+        headers: { 'If-Match': `"${record.version}"` }
+      });
+      if (res.status === 412) {
+        window.alert('这条记录已在其他地方被修改，请确认后再删除');
+      } else if (res.ok) {
+        setLastDeleted(record);
+      }
       fetchRecords();
       fetchStats();
     } catch (err) {
@@ -230,6 +373,17 @@ function App() {
     }
   };
 
+  const handleUndoDelete = async () => {
+    try {
+      await api(`/records/${lastDeleted.id}/restore`, { method: 'POST' });
+      setLastDeleted(null);
+      fetchRecords();
+      fetchStats();
+    } catch (err) {
+      console.error('Failed to restore record:', err);
+    }
+  };
+
   const handleEdit = (record) => {
     setForm({
       date: record.date,
@@ -238,12 +392,15 @@ function App() {
       notes: record.notes
     });
     setEditingId(record.id);
+    setEditingVersion(record.version);
+    setFieldErrors({});
   };
 
   const cancelEdit = () => {
     setEditingId(null);
+    setFieldErrors({});
     setForm({
-      date: new Date().toISOString().split('T')[0],
+      date: formatDate(new Date()),
       content: '',
       duration: '',
       notes: ''
@@ -268,7 +425,10 @@ function App() {
 
   return (
     <div className="container">
-      <h1>个人习惯追踪</h1>
+      <h1>
+        个人习惯追踪
+        <button className="btn-clear" onClick={handleLogoutClick}>退出登录</button>
+      </h1>
 
       <div className="stats">
         <div className="stat-card">
@@ -281,7 +441,7 @@ function App() {
         </div>
       </div>
 
-      <FrequencyChart records={records} />
+      <FrequencyChart api={api} records={records} />
 
       <div className="main-content">
         <div className="left-panel">
@@ -305,6 +465,7 @@ function App() {
                     onChange={(e) => setForm({ ...form, date: e.target.value })}
                     required
                   />
+                  {fieldErrors.date && <p className="field-error">{fieldErrors.date}</p>}
                 </div>
                 <div className="form-group">
                   <label>时长（分钟）</label>
@@ -314,8 +475,10 @@ function App() {
                     onChange={(e) => setForm({ ...form, duration: e.target.value })}
                     placeholder="例如: 30"
                     min="1"
+                    max="1440"
                     required
                   />
+                  {fieldErrors.duration && <p className="field-error">{fieldErrors.duration}</p>}
                 </div>
               </div>
               <div className="form-group">
@@ -325,8 +488,10 @@ function App() {
                   value={form.content}
                   onChange={(e) => setForm({ ...form, content: e.target.value })}
                   placeholder="输入观看的内容名称"
+                  maxLength={255}
                   required
                 />
+                {fieldErrors.content && <p className="field-error">{fieldErrors.content}</p>}
               </div>
               <div className="form-group">
                 <label>备注</label>
@@ -336,6 +501,7 @@ function App() {
                   placeholder="可选备注..."
                 />
               </div>
+              {fieldErrors.form && <p className="field-error">{fieldErrors.form}</p>}
               <button type="submit" className="btn btn-primary">
                 {editingId ? '更新' : '保存'}
               </button>
@@ -350,6 +516,13 @@ function App() {
       </div>
 
       <div className="records-section">
+        {lastDeleted && (
+          <p className="undo-bar">
+            已删除「{lastDeleted.content}」（{lastDeleted.date}）
+            <button className="btn-clear" onClick={handleUndoDelete}>撤销</button>
+            <button className="btn-clear" onClick={() => setLastDeleted(null)}>关闭</button>
+          </p>
+        )}
         <h2>
           {selectedDate ? `${selectedDate} 的记录` : '历史记录'}
           {selectedDate && (
@@ -374,7 +547,7 @@ function App() {
                   <button className="btn btn-primary" onClick={() => handleEdit(record)}>
                     编辑
                   </button>
-                  <button className="btn btn-danger" onClick={() => handleDelete(record.id)}>
+                  <button className="btn btn-danger" onClick={() => handleDelete(record)}>
                     删除
                   </button>
                 </div>